@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"log/slog"
 	"os"
@@ -14,9 +15,33 @@ import (
 	"github.com/samber/lo"
 )
 
+// Build metadata, set at build time with
+// -ldflags "-X main.version=... -X main.commit=... -X main.date=..."
+var (
+	version = "2.0.0"
+	commit  = "unknown"
+	date    = "unknown"
+)
+
+// versionString describes the running build
+func versionString() string {
+	return fmt.Sprintf("tempest-influx %s (commit %s, built %s)", version, commit, date)
+}
+
+// isVersionRequest reports whether the arguments ask for the version, which is
+// answered before loading config so it works without any settings
+func isVersionRequest(args []string) bool {
+	return len(args) > 0 && (args[0] == "version" || args[0] == "--version")
+}
+
 func main() {
 	log.SetPrefix("tempest-influxdb: ")
 
+	if isVersionRequest(os.Args[1:]) {
+		fmt.Println(versionString())
+		return
+	}
+
 	// Create context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -28,7 +53,10 @@ func main() {
 	// Check for config path override using Lo library patterns
 	configDir := lo.CoalesceOrEmpty(os.Getenv("TEMPEST_INFLUX_CONFIG_DIR"), "/config")
 
-	cfg := config.Load(configDir, "tempest-influxdb")
+	cfg, err := config.Load(configDir, "tempest-influxdb")
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
 
 	// Initialize structured logger
 	appLogger := logger.New(cfg)
@@ -39,9 +67,33 @@ func main() {
 		cancel()
 	}()
 
+	// Toggle debug logging at runtime without a restart
+	usrCh := make(chan os.Signal, 1)
+	signal.Notify(usrCh, syscall.SIGUSR1)
+	go func() {
+		for range usrCh {
+			level := appLogger.ToggleDebug()
+			appLogger.Info("Log level changed", slog.String("level", level.String()))
+		}
+	}()
+
 	appLogger.Info("Starting tempest-influxdb",
 		slog.String("config_dir", configDir),
-		slog.String("version", "2.0.0"))
+		slog.String("version", version),
+		slog.String("commit", commit),
+		slog.String("build_date", date))
+
+	if cfg.Startup_Banner {
+		appLogger.Info("Effective settings", slog.String("summary", cfg.Banner()))
+	}
+
+	// Show where each value came from to untangle file, env and flag overrides
+	for _, setting := range cfg.Settings() {
+		appLogger.Info("Config setting",
+			slog.String("name", setting.Name),
+			slog.String("value", setting.Value),
+			slog.String("source", setting.Source))
+	}
 
 	if cfg.Debug {
 		appLogger.Debug("Configuration loaded",
@@ -64,6 +116,36 @@ func main() {
 		slog.Bool("rapid_wind", cfg.Rapid_Wind),
 		slog.String("rapid_wind_bucket", cfg.Influx_Bucket_Rapid_Wind))
 
+	if cfg.Create_Bucket {
+		if err := processor.EnsureBuckets(ctx, cfg, appLogger); err != nil {
+			appLogger.Error("Failed to create InfluxDB buckets", slog.String("error", err.Error()))
+			return
+		}
+	}
+
+	if cfg.Check_Write {
+		check, err := processor.CheckWrite(ctx, cfg, appLogger)
+		if check.URL != "" {
+			fmt.Print(check)
+		}
+		if err != nil {
+			appLogger.Error("Write check failed", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		appLogger.Info("Write check succeeded")
+		return
+	}
+
+	if cfg.Backfill {
+		processed, err := processor.Backfill(ctx, cfg, appLogger)
+		if err != nil {
+			appLogger.Error("Backfill failed", slog.String("error", err.Error()), slog.Int("obs", processed))
+			os.Exit(1)
+		}
+		appLogger.Info("Backfill complete", slog.Int("obs", processed))
+		return
+	}
+
 	// Use the service-oriented approach
 	service, err := processor.NewWeatherService(cfg, appLogger)
 	if err != nil {
@@ -71,6 +153,21 @@ func main() {
 		return
 	}
 
+	if cfg.Self_Test {
+		if err := service.SelfTest(ctx); err != nil {
+			appLogger.Error("Self-test failed", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		appLogger.Info("Self-test succeeded")
+		return
+	}
+
+	if cfg.List_Report_Types {
+		appLogger.Info("Tallying report types", slog.String("duration", cfg.List_Duration.String()))
+		fmt.Print(service.TallyReportTypes(ctx, cfg.List_Duration))
+		return
+	}
+
 	if err := service.Start(ctx); err != nil && err != context.Canceled {
 		appLogger.Error("Weather service error", slog.String("error", err.Error()))
 	}
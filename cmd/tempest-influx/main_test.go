@@ -122,11 +122,31 @@ func TestMainComponents(t *testing.T) {
 }
 
 func TestVersionOutput(t *testing.T) {
-	// Test that version string is properly formatted
-	version := "2.0.0"
+	output := versionString()
 
-	if !strings.Contains(version, "2.0.0") {
-		t.Errorf("Version string should contain '2.0.0', got %s", version)
+	if !strings.Contains(output, "2.0.0") {
+		t.Errorf("Version string should contain '2.0.0', got %s", output)
+	}
+	if !strings.Contains(output, "commit "+commit) || !strings.Contains(output, "built "+date) {
+		t.Errorf("Version string should contain commit and build date, got %s", output)
+	}
+}
+
+func TestIsVersionRequest(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"version"}, true},
+		{[]string{"--version"}, true},
+		{[]string{"--debug"}, false},
+		{nil, false},
+	}
+
+	for _, tt := range tests {
+		if got := isVersionRequest(tt.args); got != tt.want {
+			t.Errorf("isVersionRequest(%v) = %v, want %v", tt.args, got, tt.want)
+		}
 	}
 }
 
@@ -176,13 +196,13 @@ func TestMainIntegration(t *testing.T) {
 	defer cancel()
 
 	// Load config
-	cfg := config.Load("/tmp", "tempest-influxdb")
-	if cfg == nil {
-		t.Fatal("Failed to load config")
+	cfg, err := config.Load("/tmp", "tempest-influxdb")
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
 	}
 
 	// Validate config
-	err := cfg.Validate()
+	err = cfg.Validate()
 	if err != nil {
 		t.Fatalf("Config validation failed: %v", err)
 	}
@@ -219,6 +239,6 @@ func BenchmarkConfigLoad(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		config.Load("/tmp", "tempest-influxdb")
+		_, _ = config.Load("/tmp", "tempest-influxdb")
 	}
 }
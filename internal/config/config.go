@@ -1,12 +1,19 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
 	"strings"
+	"time"
 
-	"github.com/samber/lo"
+	"github.com/go-viper/mapstructure/v2"
 	"github.com/spf13/viper"
 
 	flag "github.com/spf13/pflag"
@@ -14,29 +21,182 @@ import (
 
 // Config holds all configuration settings for the tempest influx application
 type Config struct {
-	Config_Dir               string `mapstructure:"CONFIG_DIR"`
-	Listen_Address           string `mapstructure:"LISTEN_ADDRESS"`
-	Influx_URL               string `mapstructure:"INFLUX_URL"`
-	Influx_API_Path          string `mapstructure:"INFLUX_API_PATH"`
-	Influx_Org               string `mapstructure:"INFLUX_ORG"`
-	Influx_Token             string `mapstructure:"INFLUX_TOKEN"`
-	Influx_Bucket            string `mapstructure:"INFLUX_BUCKET"`
-	Influx_Bucket_Rapid_Wind string `mapstructure:"INFLUX_BUCKET_RAPID_WIND"`
-	Buffer                   int
-	Verbose                  bool
-	Debug                    bool
-	Raw_UDP                  bool `mapstructure:"RAW_UDP"`
-	Noop                     bool
-	Rapid_Wind               bool `mapstructure:"RAPID_WIND"`
+	Config_Dir                 string `mapstructure:"CONFIG_DIR"`
+	Listen_Address             string `mapstructure:"LISTEN_ADDRESS"`
+	Fallback_Listen_Address    string `mapstructure:"FALLBACK_LISTEN_ADDRESS"`
+	Influx_URL                 string `mapstructure:"INFLUX_URL"`
+	Influx_API_Path            string `mapstructure:"INFLUX_API_PATH"`
+	Influx_Org                 string `mapstructure:"INFLUX_ORG"`
+	Influx_Token               string `mapstructure:"INFLUX_TOKEN"`
+	Influx_Bucket              string `mapstructure:"INFLUX_BUCKET"`
+	Influx_Bucket_Rapid_Wind   string `mapstructure:"INFLUX_BUCKET_RAPID_WIND"`
+	Buffer                     int
+	Verbose                    bool
+	Debug                      bool
+	Raw_UDP                    bool `mapstructure:"RAW_UDP"`
+	Noop                       bool
+	JSON_Stdout                bool              `mapstructure:"JSON_STDOUT"`
+	Kafka_Brokers              []string          `mapstructure:"KAFKA_BROKERS"`
+	Kafka_Topic                string            `mapstructure:"KAFKA_TOPIC"`
+	Kafka_Format               string            `mapstructure:"KAFKA_FORMAT"`
+	Kafka_SASL_Mechanism       string            `mapstructure:"KAFKA_SASL_MECHANISM"`
+	Kafka_Username             string            `mapstructure:"KAFKA_USERNAME"`
+	Kafka_Password             string            `mapstructure:"KAFKA_PASSWORD"`
+	Kafka_TLS                  bool              `mapstructure:"KAFKA_TLS"`
+	Rapid_Wind                 bool              `mapstructure:"RAPID_WIND"`
+	Wet_Bulb                   bool              `mapstructure:"WET_BULB"`
+	Pressure_Altitude          bool              `mapstructure:"PRESSURE_ALTITUDE"`
+	Enthalpy                   bool              `mapstructure:"ENTHALPY"`
+	Collector_ID               string            `mapstructure:"COLLECTOR_ID"`
+	Schema_Tag                 string            `mapstructure:"SCHEMA_TAG"`
+	Batch_Size                 int               `mapstructure:"BATCH_SIZE"`
+	Batch_Interval             time.Duration     `mapstructure:"BATCH_INTERVAL"`
+	Batch_Retry_Budget         int               `mapstructure:"BATCH_RETRY_BUDGET"`
+	Units                      string            `mapstructure:"UNITS"`
+	Unit_Tags                  bool              `mapstructure:"UNIT_TAGS"`
+	Kelvin                     bool              `mapstructure:"KELVIN"`
+	Write_Retries              int               `mapstructure:"WRITE_RETRIES"`
+	Retry_Backoff              time.Duration     `mapstructure:"RETRY_BACKOFF"`
+	Breaker_Failure_Threshold  int               `mapstructure:"BREAKER_FAILURE_THRESHOLD"`
+	Breaker_Cooldown           time.Duration     `mapstructure:"BREAKER_COOLDOWN"`
+	List_Report_Types          bool              `mapstructure:"LIST_REPORT_TYPES"`
+	List_Duration              time.Duration     `mapstructure:"LIST_DURATION"`
+	Precision                  string            `mapstructure:"PRECISION"`
+	Metrics_Address            string            `mapstructure:"METRICS_ADDRESS"`
+	Influx_Version             string            `mapstructure:"INFLUX_VERSION"`
+	Max_Concurrent_Packets     int               `mapstructure:"MAX_CONCURRENT_PACKETS"`
+	Max_Packets                int               `mapstructure:"MAX_PACKETS"`
+	DNS_Cache_TTL              time.Duration     `mapstructure:"DNS_CACHE_TTL"`
+	Parse_Timeout              time.Duration     `mapstructure:"PARSE_TIMEOUT"`
+	Min_Write_Interval         time.Duration     `mapstructure:"MIN_WRITE_INTERVAL"`
+	Idempotency_Key            bool              `mapstructure:"IDEMPOTENCY_KEY"`
+	Emit_Source_IP             bool              `mapstructure:"EMIT_SOURCE_IP"`
+	Spool_Dir                  string            `mapstructure:"SPOOL_DIR"`
+	Quarantine_Dir             string            `mapstructure:"QUARANTINE_DIR"`
+	Quarantine_Max_Files       int               `mapstructure:"QUARANTINE_MAX_FILES"`
+	Spool_Compress             bool              `mapstructure:"SPOOL_COMPRESS"`
+	Spool_Rotate               bool              `mapstructure:"SPOOL_ROTATE"`
+	Spool_Retention            int               `mapstructure:"SPOOL_RETENTION"`
+	Capture_Dir                string            `mapstructure:"CAPTURE_DIR"`
+	Capture_Compress           bool              `mapstructure:"CAPTURE_COMPRESS"`
+	Capture_Retention          int               `mapstructure:"CAPTURE_RETENTION"`
+	Influx_Buckets             map[string]string `mapstructure:"INFLUX_BUCKETS"`
+	Influx_Orgs                map[string]string `mapstructure:"INFLUX_ORGS"`
+	Measurement_Per_Type       bool              `mapstructure:"MEASUREMENT_PER_TYPE"`
+	Workers                    int               `mapstructure:"WORKERS"`
+	Queue_Size                 int               `mapstructure:"QUEUE_SIZE"`
+	Drop_Policy                string            `mapstructure:"DROP_POLICY"`
+	Station_Ordering           bool              `mapstructure:"STATION_ORDERING"`
+	Emit_Raw                   bool              `mapstructure:"EMIT_RAW"`
+	Temp_Offset                float64           `mapstructure:"TEMP_OFFSET"`
+	Wind_Declination           float64           `mapstructure:"WIND_DECLINATION"`
+	Humidity_Offset            float64           `mapstructure:"HUMIDITY_OFFSET"`
+	Dew_Point_Min_Humidity     float64           `mapstructure:"DEW_POINT_MIN_HUMIDITY"`
+	Dew_Point                  bool              `mapstructure:"DEW_POINT"`
+	Content_Type               string            `mapstructure:"CONTENT_TYPE"`
+	Strike_Rate                bool              `mapstructure:"STRIKE_RATE"`
+	METAR_Wind                 bool              `mapstructure:"METAR_WIND"`
+	Skip_Zero_Obs              bool              `mapstructure:"SKIP_ZERO_OBS"`
+	Shutdown_Timeout           time.Duration     `mapstructure:"SHUTDOWN_TIMEOUT"`
+	Field_Name_Map             map[string]string `mapstructure:"FIELD_NAME_MAP"`
+	Output_Backend             string            `mapstructure:"OUTPUT_BACKEND"`
+	Output_Mode                string            `mapstructure:"OUTPUT_MODE"`
+	Output_File_Dir            string            `mapstructure:"OUTPUT_FILE_DIR"`
+	Output_File_Retention      int               `mapstructure:"OUTPUT_FILE_RETENTION"`
+	Merge_Rapid_Wind           bool              `mapstructure:"MERGE_RAPID_WIND"`
+	Rapid_Wind_Receipt_Time    bool              `mapstructure:"RAPID_WIND_RECEIPT_TIME"`
+	Rapid_Wind_Seq             bool              `mapstructure:"RAPID_WIND_SEQ"`
+	Conditions_String          bool              `mapstructure:"CONDITIONS_STRING"`
+	Categorical_Fields         bool              `mapstructure:"CATEGORICAL_FIELDS"`
+	Tag_Fields                 []string          `mapstructure:"TAG_FIELDS"`
+	Common_Tags                []string          `mapstructure:"COMMON_TAGS"`
+	Max_Tags                   int               `mapstructure:"MAX_TAGS"`
+	Tag_Priority               []string          `mapstructure:"TAG_PRIORITY"`
+	Honor_Sensor_Status        bool              `mapstructure:"HONOR_SENSOR_STATUS"`
+	Inbound_Gzip               bool              `mapstructure:"INBOUND_GZIP"`
+	Multi_Message              bool              `mapstructure:"MULTI_MESSAGE"`
+	Log_Split_Streams          bool              `mapstructure:"LOG_SPLIT_STREAMS"`
+	Station_Timeout            time.Duration     `mapstructure:"STATION_TIMEOUT"`
+	Emit_Recv_Time             bool              `mapstructure:"EMIT_RECV_TIME"`
+	Check_Write                bool              `mapstructure:"CHECK_WRITE"`
+	Self_Test                  bool              `mapstructure:"SELF_TEST"`
+	Backfill                   bool              `mapstructure:"BACKFILL"`
+	Backfill_Start             string            `mapstructure:"BACKFILL_START"`
+	Backfill_End               string            `mapstructure:"BACKFILL_END"`
+	Backfill_Request_Interval  time.Duration     `mapstructure:"BACKFILL_REQUEST_INTERVAL"`
+	WF_Token                   string            `mapstructure:"WF_TOKEN"`
+	WF_API_URL                 string            `mapstructure:"WF_API_URL"`
+	Station_ID                 int               `mapstructure:"STATION_ID"`
+	Hub_Status                 bool              `mapstructure:"HUB_STATUS"`
+	Seq_Gaps                   bool              `mapstructure:"SEQ_GAPS"`
+	Seq_Rollover               int               `mapstructure:"SEQ_ROLLOVER"`
+	Dual_Pressure              bool              `mapstructure:"DUAL_PRESSURE"`
+	Create_Bucket              bool              `mapstructure:"CREATE_BUCKET"`
+	Bucket_Retention           time.Duration     `mapstructure:"BUCKET_RETENTION"`
+	Frost_Risk                 bool              `mapstructure:"FROST_RISK"`
+	Frost_Temp                 float64           `mapstructure:"FROST_TEMP"`
+	Field_Units                map[string]string `mapstructure:"FIELD_UNITS"`
+	Emit_Debug_Field           bool              `mapstructure:"EMIT_DEBUG_FIELD"`
+	Startup_Banner             bool              `mapstructure:"STARTUP_BANNER"`
+	Daily_Totals               bool              `mapstructure:"DAILY_TOTALS"`
+	Temp_Min_Max               bool              `mapstructure:"TEMP_MIN_MAX"`
+	GDD                        bool              `mapstructure:"GDD"`
+	GDD_Base_Temp              float64           `mapstructure:"GDD_BASE_TEMP"`
+	Precip_Events              bool              `mapstructure:"PRECIP_EVENTS"`
+	Precip_Debounce            time.Duration     `mapstructure:"PRECIP_DEBOUNCE"`
+	Accumulator_Flush_Interval time.Duration     `mapstructure:"ACCUMULATOR_FLUSH_INTERVAL"`
+
+	// Sources records where each setting's value came from, keyed by the
+	// lowercased setting name
+	Sources map[string]string `mapstructure:"-"`
 }
 
 // Default configuration values
 const (
-	DefaultListenAddress = ":50222"
-	DefaultInfluxURL     = "https://localhost:8086"
-	DefaultInfluxAPIPath = "/api/v2/write"
-	DefaultBuffer        = 10240
-	DefaultTimeout       = 10 // seconds
+	DefaultListenAddress   = ":50222"
+	DefaultInfluxURL       = "https://localhost:8086"
+	DefaultInfluxAPIPath   = "/api/v2/write"
+	DefaultBuffer          = 10240
+	DefaultTimeout         = 10 // seconds
+	DefaultBatchInterval   = 10 * time.Second
+	DefaultUnits           = UnitsMetric
+	DefaultRetryBackoff    = 1 * time.Second
+	DefaultBreakerCooldown = 30 * time.Second
+	DefaultListDuration    = 60 * time.Second
+	DefaultPrecision       = PrecisionSeconds
+	DefaultInfluxVersion   = InfluxV2
+	DefaultQueueSize       = 100
+	DefaultDropPolicy      = DropOldest
+	DefaultContentType     = "text/plain; charset=utf-8"
+	DefaultShutdownTimeout = 25 * time.Second // inside the usual 30s termination grace period
+	DefaultOutputBackend   = BackendInfluxDB
+	DefaultOutputMode      = OutputHTTP
+	DefaultKafkaFormat     = KafkaFormatJSON
+	DefaultFrostTemp       = 2.0  // degrees C
+	DefaultGDDBaseTemp     = 10.0 // degrees C
+
+	DefaultQuarantineMaxFiles  = 1000
+	DefaultSeqRollover         = 100
+	DefaultDewPointMinHumidity = 1.0 // percent
+
+	// DefaultWFAPIURL is the WeatherFlow REST API used for backfills, and
+	// DefaultBackfillRequestInterval spaces requests to stay within its
+	// rate limits
+	DefaultWFAPIURL                = "https://swd.weatherflow.com/swd/rest"
+	DefaultBackfillRequestInterval = 1 * time.Second
+
+	// MaxBuffer bounds Buffer since a buffer is allocated per packet in
+	// flight, and MaxUDPPayload is the largest datagram a read can return
+	MaxBuffer     = 1 << 20
+	MaxUDPPayload = 65535
+
+	// DefaultVictoriaMetricsAPIPath replaces the InfluxDB API path when
+	// writing to VictoriaMetrics and no other path is configured
+	DefaultVictoriaMetricsAPIPath = "/write"
+
+	// DefaultInfluxV3APIPath replaces the InfluxDB API path when writing to
+	// InfluxDB 3.x and no other path is configured
+	DefaultInfluxV3APIPath = "/api/v3/write_lp"
 
 	// HTTP client optimization constants
 	HTTPMaxIdleConns    = 100
@@ -44,6 +204,191 @@ const (
 	HTTPIdleConnTimeout = 90 // seconds
 )
 
+// Unit systems supported by the Units option
+const (
+	UnitsMetric   = "metric"
+	UnitsImperial = "imperial"
+)
+
+// Quantities whose unit can be overridden with the Field_Units option
+const (
+	QuantityTemp     = "temp"
+	QuantityWind     = "wind"
+	QuantityPressure = "pressure"
+	QuantityPrecip   = "precip"
+	QuantityDistance = "distance"
+)
+
+// SupportedUnits lists the units each quantity can be emitted in
+var SupportedUnits = map[string][]string{
+	QuantityTemp:     {"C", "F", "K"},
+	QuantityWind:     {"m/s", "km/h", "mph", "knots"},
+	QuantityPressure: {"hPa", "kPa", "inHg", "mmHg"},
+	QuantityPrecip:   {"mm", "in"},
+	QuantityDistance: {"km", "mi"},
+}
+
+// Report values that can be named in Common_Tags; other entries are static
+// key=value tags
+const (
+	CommonTagStation          = "station"
+	CommonTagHub              = "hub"
+	CommonTagFirmwareRevision = "firmware_revision"
+)
+
+// InfluxDB API versions supported by the Influx_Version option
+const (
+	// InfluxV1 targets InfluxDB 1.8+ compatibility endpoints and gateways
+	// that don't use an organization
+	InfluxV1 = "v1"
+	InfluxV2 = "v2"
+	// InfluxV3 targets the InfluxDB 3.x write_lp endpoint, which writes to
+	// a database rather than a bucket in an organization
+	InfluxV3 = "v3"
+)
+
+// Output backends supported by the Output_Backend option. Both accept the
+// same line protocol but differ in path, authentication and query arguments.
+const (
+	BackendInfluxDB        = "influxdb"
+	BackendVictoriaMetrics = "victoriametrics"
+)
+
+// Output modes supported by the Output_Mode option: posting to the backend
+// over HTTP, appending line protocol to daily files, or both
+const (
+	OutputHTTP = "http"
+	OutputFile = "file"
+	OutputBoth = "both"
+)
+
+// WritesHTTP reports whether points are posted to the backend over HTTP
+func (c *Config) WritesHTTP() bool {
+	return c.Output_Mode != OutputFile
+}
+
+// WritesFile reports whether points are appended to line protocol files
+func (c *Config) WritesFile() bool {
+	return c.Output_Mode == OutputFile || c.Output_Mode == OutputBoth
+}
+
+// Message formats supported by the Kafka_Format option
+const (
+	KafkaFormatJSON = "json"
+	KafkaFormatAvro = "avro"
+)
+
+// SASL mechanisms supported by the Kafka_SASL_Mechanism option
+const (
+	SASLPlain       = "plain"
+	SASLScramSHA256 = "scram-sha-256"
+	SASLScramSHA512 = "scram-sha-512"
+)
+
+// Write precisions supported by the Precision option
+const (
+	PrecisionSeconds      = "s"
+	PrecisionMilliseconds = "ms"
+	PrecisionMicroseconds = "us"
+	PrecisionNanoseconds  = "ns"
+)
+
+// Drop policies supported by the Drop_Policy option, naming which end of a
+// full worker queue is discarded
+const (
+	DropOldest = "oldest"
+	DropNewest = "newest"
+)
+
+// Sources a setting's effective value can come from, in increasing precedence
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// APIPath returns the write path appended to Influx_URL, substituting the
+// VictoriaMetrics path when the InfluxDB default hasn't been changed
+func (c *Config) APIPath() string {
+	defaultPath := c.Influx_API_Path == "" || c.Influx_API_Path == DefaultInfluxAPIPath
+	switch {
+	case c.Output_Backend == BackendVictoriaMetrics && defaultPath:
+		return DefaultVictoriaMetricsAPIPath
+	case c.Influx_Version == InfluxV3 && defaultPath:
+		return DefaultInfluxV3APIPath
+	}
+	return c.Influx_API_Path
+}
+
+// UsesDB reports whether writes name their target with the db query argument
+// and no organization, as VictoriaMetrics and InfluxDB 3.x expect, rather
+// than with bucket and org
+func (c *Config) UsesDB() bool {
+	return c.Output_Backend == BackendVictoriaMetrics || c.Influx_Version == InfluxV3
+}
+
+// WriteURL joins Influx_URL and the API path with exactly one slash between
+// them, whether or not the URL ends or the path starts with one
+func (c *Config) WriteURL() string {
+	apiPath := c.APIPath()
+	if apiPath == "" {
+		return c.Influx_URL
+	}
+	return strings.TrimRight(c.Influx_URL, "/") + "/" + strings.TrimLeft(apiPath, "/")
+}
+
+// trimAPIPath removes the write path from the end of Influx_URL, a common
+// mistake that would otherwise request the path twice and fail with a 404.
+// It reports whether the URL was changed.
+func (c *Config) trimAPIPath() bool {
+	apiPath := strings.TrimSuffix(c.APIPath(), "/")
+	if apiPath == "" {
+		return false
+	}
+
+	u, err := url.Parse(c.Influx_URL)
+	if err != nil || !strings.HasSuffix(strings.TrimSuffix(u.Path, "/"), apiPath) {
+		return false
+	}
+
+	u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), apiPath)
+	u.RawPath = ""
+	c.Influx_URL = u.String()
+	return true
+}
+
+// backfillLayouts are the accepted Backfill_Start and Backfill_End formats.
+// Dates are midnight local time.
+var backfillLayouts = []string{time.RFC3339, "2006-01-02"}
+
+// BackfillRange parses Backfill_Start and Backfill_End, which defaults to now
+func (c *Config) BackfillRange() (start time.Time, end time.Time, err error) {
+	if start, err = parseBackfillTime(c.Backfill_Start); err != nil {
+		return start, end, fmt.Errorf("BACKFILL_START %w", err)
+	}
+	end = time.Now()
+	if c.Backfill_End != "" {
+		if end, err = parseBackfillTime(c.Backfill_End); err != nil {
+			return start, end, fmt.Errorf("BACKFILL_END %w", err)
+		}
+	}
+	if !start.Before(end) {
+		return start, end, errors.New("BACKFILL_START must be before BACKFILL_END")
+	}
+	return start, end, nil
+}
+
+// parseBackfillTime parses a time in one of backfillLayouts
+func parseBackfillTime(s string) (time.Time, error) {
+	for _, layout := range backfillLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("must be a date (2024-06-01) or RFC 3339 time, got %q", s)
+}
+
 // Validate validates the configuration and returns an error if invalid
 func (c *Config) Validate() error {
 	var validationErrors []string
@@ -53,18 +398,70 @@ func (c *Config) Validate() error {
 		validationErrors = append(validationErrors, "INFLUX_URL is required")
 	}
 
-	if c.Influx_Org == "" {
+	// Organizations only exist in InfluxDB 2.x; VictoriaMetrics and InfluxDB
+	// 3.x ignore them and authentication is optional in VictoriaMetrics.
+	// Writing only to files needs neither.
+	victoriaMetrics := c.Output_Backend == BackendVictoriaMetrics
+	orgless := c.Influx_Version == InfluxV1 || c.UsesDB()
+	if c.Influx_Org == "" && !orgless && c.WritesHTTP() {
 		validationErrors = append(validationErrors, "INFLUX_ORG is required")
 	}
 
-	if c.Influx_Token == "" {
+	if c.Influx_Token == "" && !victoriaMetrics && c.WritesHTTP() {
 		validationErrors = append(validationErrors, "INFLUX_TOKEN is required")
 	}
 
-	if c.Influx_Bucket == "" {
+	if c.Influx_Bucket == "" && c.WritesHTTP() {
 		validationErrors = append(validationErrors, "INFLUX_BUCKET is required")
 	}
 
+	switch c.Output_Mode {
+	case "", OutputHTTP, OutputFile, OutputBoth:
+	default:
+		validationErrors = append(validationErrors, fmt.Sprintf("OUTPUT_MODE must be %q, %q or %q", OutputHTTP, OutputFile, OutputBoth))
+	}
+	if c.WritesFile() && c.Output_File_Dir == "" {
+		validationErrors = append(validationErrors, "OUTPUT_FILE_DIR is required when writing to files")
+	}
+	if c.Output_File_Retention < 0 {
+		validationErrors = append(validationErrors, "OUTPUT_FILE_RETENTION must not be negative")
+	}
+
+	for reportType, bucket := range c.Influx_Buckets {
+		if bucket == "" {
+			validationErrors = append(validationErrors, fmt.Sprintf("INFLUX_BUCKETS entry for %s must name a bucket", reportType))
+		}
+	}
+
+	for reportType, org := range c.Influx_Orgs {
+		if org == "" {
+			validationErrors = append(validationErrors, fmt.Sprintf("INFLUX_ORGS entry for %s must name an organization", reportType))
+		}
+	}
+	if len(c.Influx_Orgs) > 0 && orgless {
+		validationErrors = append(validationErrors, "INFLUX_ORGS requires InfluxDB v2")
+	}
+
+	switch c.Output_Backend {
+	case "", BackendInfluxDB, BackendVictoriaMetrics:
+	default:
+		validationErrors = append(validationErrors, fmt.Sprintf("OUTPUT_BACKEND must be %q or %q", BackendInfluxDB, BackendVictoriaMetrics))
+	}
+
+	switch c.Influx_Version {
+	case "", InfluxV1, InfluxV2, InfluxV3:
+	default:
+		validationErrors = append(validationErrors, fmt.Sprintf("INFLUX_VERSION must be %q, %q or %q", InfluxV1, InfluxV2, InfluxV3))
+	}
+
+	// Buckets are managed through the InfluxDB 2.x API
+	if c.Create_Bucket && orgless {
+		validationErrors = append(validationErrors, "CREATE_BUCKET requires InfluxDB v2")
+	}
+	if c.Bucket_Retention < 0 {
+		validationErrors = append(validationErrors, "BUCKET_RETENTION must not be negative")
+	}
+
 	// Validate URL format
 	if c.Influx_URL != "" {
 		if _, err := url.Parse(c.Influx_URL); err != nil {
@@ -79,10 +476,232 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	// Validate collector ID can be written as a tag value without escaping
+	if strings.ContainsAny(c.Collector_ID, ",= \t\r\n\"") {
+		validationErrors = append(validationErrors, "COLLECTOR_ID must not contain commas, equals signs, quotes or whitespace")
+	}
+	if strings.ContainsAny(c.Schema_Tag, ",= \t\r\n\"") {
+		validationErrors = append(validationErrors, "SCHEMA_TAG must not contain commas, equals signs, quotes or whitespace")
+	}
+
+	// Common tags are written without escaping
+	for _, entry := range c.Common_Tags {
+		name, value, static := strings.Cut(entry, "=")
+		switch {
+		case !static && name != CommonTagStation && name != CommonTagHub && name != CommonTagFirmwareRevision:
+			validationErrors = append(validationErrors, fmt.Sprintf("COMMON_TAGS entry %q must be station, hub, firmware_revision or key=value", entry))
+		case name == "" || strings.ContainsAny(name+value, ",= \t\r\n\""):
+			validationErrors = append(validationErrors, fmt.Sprintf("COMMON_TAGS entry %q must have a key, and no commas, extra equals signs, quotes or whitespace", entry))
+		case static && (name == CommonTagStation || name == CommonTagHub || name == CommonTagFirmwareRevision):
+			validationErrors = append(validationErrors, fmt.Sprintf("COMMON_TAGS entry %q would replace the %s reported by the device", entry, name))
+		}
+	}
+
+	// Renamed fields are written as field keys without escaping
+	for field, name := range c.Field_Name_Map {
+		if name == "" || strings.ContainsAny(name, ",= \t\r\n\"") {
+			validationErrors = append(validationErrors, fmt.Sprintf("FIELD_NAME_MAP name for %s must be non-empty without commas, equals signs, quotes or whitespace", field))
+		}
+	}
+
+	// Two fields renamed alike would overwrite one another
+	renamedFrom := make(map[string][]string)
+	for field, name := range c.Field_Name_Map {
+		renamedFrom[name] = append(renamedFrom[name], field)
+	}
+	names := make([]string, 0, len(renamedFrom))
+	for name := range renamedFrom {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if fields := renamedFrom[name]; len(fields) > 1 {
+			sort.Strings(fields)
+			validationErrors = append(validationErrors, fmt.Sprintf("FIELD_NAME_MAP renames %s all to %s", strings.Join(fields, ", "), name))
+		}
+	}
+
+	// Validate metrics address format
+	if c.Metrics_Address != "" && !strings.Contains(c.Metrics_Address, ":") {
+		validationErrors = append(validationErrors, "METRICS_ADDRESS must include port (e.g., ':9090')")
+	}
+
 	// Validate buffer size
 	if c.Buffer <= 0 {
 		validationErrors = append(validationErrors, "Buffer size must be greater than 0")
 	}
+	if c.Buffer > MaxBuffer {
+		validationErrors = append(validationErrors, fmt.Sprintf("Buffer size must not exceed %d bytes", MaxBuffer))
+	}
+
+	// Validate unit system
+	if c.Units != "" && c.Units != UnitsMetric && c.Units != UnitsImperial {
+		validationErrors = append(validationErrors, fmt.Sprintf("UNITS must be %q or %q", UnitsMetric, UnitsImperial))
+	}
+
+	// Validate per quantity unit overrides
+	for quantity, unit := range c.Field_Units {
+		units, ok := SupportedUnits[quantity]
+		switch {
+		case !ok:
+			validationErrors = append(validationErrors, fmt.Sprintf("FIELD_UNITS has unknown quantity %q (temp, wind, pressure, precip or distance)", quantity))
+		case !slices.Contains(units, unit):
+			validationErrors = append(validationErrors, fmt.Sprintf("FIELD_UNITS %s unit must be one of %s", quantity, strings.Join(units, ", ")))
+		}
+	}
+
+	// Validate write precision
+	switch c.Precision {
+	case "", PrecisionSeconds, PrecisionMilliseconds, PrecisionMicroseconds, PrecisionNanoseconds:
+	default:
+		validationErrors = append(validationErrors, "PRECISION must be one of s, ms, us or ns")
+	}
+
+	// Validate batching
+	if c.Batch_Size < 0 {
+		validationErrors = append(validationErrors, "BATCH_SIZE must not be negative")
+	}
+	if c.Batch_Size > 0 && c.Batch_Interval <= 0 {
+		validationErrors = append(validationErrors, "BATCH_INTERVAL must be greater than 0 when batching is enabled")
+	}
+	if c.Batch_Retry_Budget < 0 {
+		validationErrors = append(validationErrors, "BATCH_RETRY_BUDGET must not be negative")
+	}
+
+	// Validate concurrency limit
+	if c.Max_Concurrent_Packets < 0 {
+		validationErrors = append(validationErrors, "MAX_CONCURRENT_PACKETS must not be negative")
+	}
+	if c.Max_Packets < 0 {
+		validationErrors = append(validationErrors, "MAX_PACKETS must not be negative")
+	}
+	if c.DNS_Cache_TTL < 0 {
+		validationErrors = append(validationErrors, "DNS_CACHE_TTL must not be negative")
+	}
+	if c.Parse_Timeout < 0 {
+		validationErrors = append(validationErrors, "PARSE_TIMEOUT must not be negative")
+	}
+
+	if c.Seq_Gaps && c.Seq_Rollover <= 0 {
+		validationErrors = append(validationErrors, "SEQ_ROLLOVER must be greater than 0 when seq gap detection is enabled")
+	}
+
+	if c.Max_Tags < 0 {
+		validationErrors = append(validationErrors, "MAX_TAGS must not be negative")
+	}
+
+	if c.Precip_Debounce < 0 {
+		validationErrors = append(validationErrors, "PRECIP_DEBOUNCE must not be negative")
+	}
+	if c.Precip_Debounce > 0 && !c.Precip_Events {
+		validationErrors = append(validationErrors, "PRECIP_DEBOUNCE requires PRECIP_EVENTS")
+	}
+
+	// METAR wind is computed from the rapid wind stream
+	if c.METAR_Wind && !c.Rapid_Wind {
+		validationErrors = append(validationErrors, "METAR_WIND requires RAPID_WIND")
+	}
+
+	// Validate calibration
+	if c.Dew_Point_Min_Humidity < 0 || c.Dew_Point_Min_Humidity > 100 {
+		validationErrors = append(validationErrors, "DEW_POINT_MIN_HUMIDITY must be between 0 and 100")
+	}
+	if c.Humidity_Offset < -100 || c.Humidity_Offset > 100 {
+		validationErrors = append(validationErrors, "HUMIDITY_OFFSET must be between -100 and 100")
+	}
+
+	if c.Shutdown_Timeout < 0 {
+		validationErrors = append(validationErrors, "SHUTDOWN_TIMEOUT must not be negative")
+	}
+
+	// Validate worker pool
+	if c.Workers < 0 {
+		validationErrors = append(validationErrors, "WORKERS must not be negative")
+	}
+	if c.Workers > 0 && c.Queue_Size <= 0 {
+		validationErrors = append(validationErrors, "QUEUE_SIZE must be greater than 0 when workers are enabled")
+	}
+	if c.Station_Ordering && c.Workers == 0 {
+		validationErrors = append(validationErrors, "STATION_ORDERING requires WORKERS")
+	}
+	switch c.Drop_Policy {
+	case "", DropOldest, DropNewest:
+	default:
+		validationErrors = append(validationErrors, fmt.Sprintf("DROP_POLICY must be %q or %q", DropOldest, DropNewest))
+	}
+
+	if c.Accumulator_Flush_Interval < 0 {
+		validationErrors = append(validationErrors, "ACCUMULATOR_FLUSH_INTERVAL must not be negative")
+	}
+
+	if c.Backfill {
+		if c.WF_Token == "" {
+			validationErrors = append(validationErrors, "WF_TOKEN is required for a backfill")
+		}
+		if c.Station_ID <= 0 {
+			validationErrors = append(validationErrors, "STATION_ID is required for a backfill")
+		}
+		if _, _, err := c.BackfillRange(); err != nil {
+			validationErrors = append(validationErrors, err.Error())
+		}
+	}
+	if c.Backfill_Request_Interval < 0 {
+		validationErrors = append(validationErrors, "BACKFILL_REQUEST_INTERVAL must not be negative")
+	}
+
+	if c.Spool_Retention < 0 {
+		validationErrors = append(validationErrors, "SPOOL_RETENTION must not be negative")
+	}
+
+	if len(c.Kafka_Brokers) > 0 {
+		if c.Kafka_Topic == "" {
+			validationErrors = append(validationErrors, "KAFKA_TOPIC is required when KAFKA_BROKERS is set")
+		}
+		switch c.Kafka_Format {
+		case "", KafkaFormatJSON, KafkaFormatAvro:
+		default:
+			validationErrors = append(validationErrors, fmt.Sprintf("KAFKA_FORMAT must be %q or %q", KafkaFormatJSON, KafkaFormatAvro))
+		}
+		switch c.Kafka_SASL_Mechanism {
+		case "":
+		case SASLPlain, SASLScramSHA256, SASLScramSHA512:
+			if c.Kafka_Username == "" || c.Kafka_Password == "" {
+				validationErrors = append(validationErrors, "KAFKA_USERNAME and KAFKA_PASSWORD are required for SASL")
+			}
+		default:
+			validationErrors = append(validationErrors, fmt.Sprintf("KAFKA_SASL_MECHANISM must be one of %s, %s or %s", SASLPlain, SASLScramSHA256, SASLScramSHA512))
+		}
+	}
+
+	if c.Breaker_Failure_Threshold < 0 {
+		validationErrors = append(validationErrors, "BREAKER_FAILURE_THRESHOLD must not be negative")
+	}
+	if c.Breaker_Failure_Threshold > 0 && c.Breaker_Cooldown <= 0 {
+		validationErrors = append(validationErrors, "BREAKER_COOLDOWN must be greater than 0 when the breaker is enabled")
+	}
+	if c.Capture_Retention < 0 {
+		validationErrors = append(validationErrors, "CAPTURE_RETENTION must not be negative")
+	}
+
+	if c.Quarantine_Dir != "" && c.Quarantine_Max_Files <= 0 {
+		validationErrors = append(validationErrors, "QUARANTINE_MAX_FILES must be greater than 0 when a quarantine directory is set")
+	}
+
+	if c.Station_Timeout < 0 {
+		validationErrors = append(validationErrors, "STATION_TIMEOUT must not be negative")
+	}
+
+	if c.Min_Write_Interval < 0 {
+		validationErrors = append(validationErrors, "MIN_WRITE_INTERVAL must not be negative")
+	}
+
+	// Validate retries
+	if c.Write_Retries < 0 {
+		validationErrors = append(validationErrors, "WRITE_RETRIES must not be negative")
+	}
+	if c.Retry_Backoff < 0 {
+		validationErrors = append(validationErrors, "RETRY_BACKOFF must not be negative")
+	}
 
 	if len(validationErrors) > 0 {
 		return fmt.Errorf("configuration validation failed: %s", strings.Join(validationErrors, "; "))
@@ -91,64 +710,426 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+// ErrConfigIsDirectory is returned when the expected config file path is a directory
+var ErrConfigIsDirectory = errors.New("config file path is a directory")
+
+// ErrConfigType is returned when an explicit config file has an extension
+// that isn't a supported format
+var ErrConfigType = errors.New("unsupported config file type")
+
 // Load loads configuration from file, environment variables, and command line flags
-func Load(path string, name string) *Config {
-	config_file := name + ".yml"
+func Load(path string, name string) (*Config, error) {
+	return load(flag.NewFlagSet(os.Args[0], flag.ExitOnError), os.Args[1:], path, name)
+}
+
+// load does the work of Load against an explicit flag set and argument list
+// so it can be exercised repeatedly in tests without touching global state.
+func load(flags *flag.FlagSet, args []string, path string, name string) (*Config, error) {
+	v := viper.New()
 
 	// Set defaults
-	viper.SetDefault("Listen_Address", DefaultListenAddress)
-	viper.SetDefault("Influx_URL", DefaultInfluxURL)
-	viper.SetDefault("Influx_API_Path", DefaultInfluxAPIPath)
-	viper.SetDefault("Buffer", DefaultBuffer)
-
-	flag.String("listen_address", "", "Address to listen for UDP Broadcasts")
-	flag.String("influx_url", "", "InfluxDB base URL (without /api/v2/write)")
-	flag.String("influx_api_path", "", "InfluxDB API path (default: /api/v2/write)")
-	flag.String("influx_org", "", "InfluxDB organization name")
-	flag.String("influx_token", "", "Authentication token for Influx")
-	flag.String("influx_bucket", "", "InfluxDB bucket name")
-	flag.String("influx_bucket_rapid_wind", "", "InfluxDB bucket name for rapid wind reports")
-	flag.Int("buffer", 0, "Max buffer size for the socket io")
-	flag.BoolP("verbose", "v", false, "Verbose logging")
-	flag.BoolP("debug", "d", false, "Debug logging")
-	flag.Bool("raw_udp", false, "Show raw UDP packet data in hex format")
-	flag.BoolP("noop", "n", false, "Don't post to influx")
-	flag.Bool("rapid_wind", false, "Send rapid wind reports")
-
-	viper.AddConfigPath(path)
-
-	viper.SetConfigName(config_file)
-	viper.SetConfigType("yaml")
+	v.SetDefault("Listen_Address", DefaultListenAddress)
+	v.SetDefault("Influx_URL", DefaultInfluxURL)
+	v.SetDefault("Influx_API_Path", DefaultInfluxAPIPath)
+	v.SetDefault("Buffer", DefaultBuffer)
+	v.SetDefault("Batch_Interval", DefaultBatchInterval)
+	v.SetDefault("Units", DefaultUnits)
+	v.SetDefault("Retry_Backoff", DefaultRetryBackoff)
+	v.SetDefault("Breaker_Cooldown", DefaultBreakerCooldown)
+	v.SetDefault("List_Duration", DefaultListDuration)
+	v.SetDefault("Precision", DefaultPrecision)
+	v.SetDefault("Influx_Version", DefaultInfluxVersion)
+	v.SetDefault("Queue_Size", DefaultQueueSize)
+	v.SetDefault("Dew_Point", true)
+	v.SetDefault("Startup_Banner", true)
+	v.SetDefault("Content_Type", DefaultContentType)
+	v.SetDefault("Shutdown_Timeout", DefaultShutdownTimeout)
+	v.SetDefault("Output_Backend", DefaultOutputBackend)
+	v.SetDefault("Output_Mode", DefaultOutputMode)
+	v.SetDefault("Drop_Policy", DefaultDropPolicy)
+	v.SetDefault("Frost_Temp", DefaultFrostTemp)
+	v.SetDefault("GDD_Base_Temp", DefaultGDDBaseTemp)
+	v.SetDefault("Kafka_Format", DefaultKafkaFormat)
+	v.SetDefault("Quarantine_Max_Files", DefaultQuarantineMaxFiles)
+	v.SetDefault("Dew_Point_Min_Humidity", DefaultDewPointMinHumidity)
+	v.SetDefault("Seq_Rollover", DefaultSeqRollover)
+	v.SetDefault("WF_API_URL", DefaultWFAPIURL)
+	v.SetDefault("Backfill_Request_Interval", DefaultBackfillRequestInterval)
+
+	// Accept both --flag_name and --flag-name spellings
+	flags.SetNormalizeFunc(func(_ *flag.FlagSet, name string) flag.NormalizedName {
+		return flag.NormalizedName(strings.ReplaceAll(name, "-", "_"))
+	})
+	if hostname, err := os.Hostname(); err == nil {
+		v.SetDefault("Collector_ID", hostname)
+	}
+
+	flags.String("config", "", "Explicit config file path (overrides the config directory lookup)")
+	flags.String("listen_address", "", "Address to listen for UDP Broadcasts")
+	flags.String("fallback_listen_address", "", "Address to listen on instead if listen_address is already in use")
+	flags.String("influx_url", "", "InfluxDB base URL (without /api/v2/write)")
+	flags.String("influx_api_path", "", "InfluxDB API path (default: /api/v2/write)")
+	flags.String("influx_org", "", "InfluxDB organization name")
+	flags.String("influx_version", "", "InfluxDB API version (v2, or v1 for setups without an organization)")
+	flags.String("output_backend", "", "Line protocol backend to write to (influxdb or victoriametrics)")
+	flags.String("output_mode", "", "Where points go: http to the backend, file for daily line protocol files, or both (default http)")
+	flags.String("output_file_dir", "", "Directory for daily line protocol files when output_mode is file or both")
+	flags.Int("output_file_retention", 0, "Days of line protocol files to keep (0 keeps every file)")
+	flags.String("influx_token", "", "Authentication token for Influx")
+	flags.String("influx_bucket", "", "InfluxDB bucket name")
+	flags.String("influx_bucket_rapid_wind", "", "InfluxDB bucket name for rapid wind reports")
+	flags.Bool("create_bucket", false, "Create missing buckets at startup")
+	flags.Duration("bucket_retention", 0, "Retention period for created buckets (0 keeps data forever)")
+	flags.StringToString("influx_buckets", nil, "InfluxDB bucket per report type (e.g. obs_st=weather,rapid_wind=wind)")
+	flags.StringToString("influx_orgs", nil, "InfluxDB organization per report type, defaulting to influx_org (e.g. hub_status=ops)")
+	flags.Int("buffer", 0, "Max buffer size for the socket io")
+	flags.BoolP("verbose", "v", false, "Verbose logging")
+	flags.BoolP("debug", "d", false, "Debug logging")
+	flags.Bool("log_split_streams", false, "Log errors to stderr and everything else to stdout")
+	flags.Bool("raw_udp", false, "Show raw UDP packet data in hex format")
+	flags.Bool("inbound_gzip", false, "Decompress gzipped UDP packets from relays (uncompressed packets are still accepted)")
+	flags.Bool("multi_message", false, "Split packets holding several newline-separated JSON reports and process each")
+	flags.BoolP("noop", "n", false, "Don't post to influx")
+	flags.Bool("json_stdout", false, "Also print each point to stdout as a JSON object per line, logging to stderr instead (with noop, instead of InfluxDB)")
+	flags.StringSlice("kafka_brokers", nil, "Kafka brokers to also publish each point to, such as kafka-1:9092,kafka-2:9092 (disabled if empty)")
+	flags.String("kafka_topic", "", "Kafka topic points are published to, keyed by station serial")
+	flags.String("kafka_format", "", "Kafka message format, json or avro (default json)")
+	flags.String("kafka_sasl_mechanism", "", "Kafka SASL mechanism: plain, scram-sha-256 or scram-sha-512 (disabled if empty)")
+	flags.String("kafka_username", "", "Kafka SASL username")
+	flags.String("kafka_password", "", "Kafka SASL password")
+	flags.Bool("kafka_tls", false, "Connect to the Kafka brokers over TLS")
+	flags.Bool("rapid_wind", false, "Send rapid wind reports")
+	flags.Bool("hub_status", false, "Send hub status diagnostics (uptime, RSSI, radio, MQTT and file system stats)")
+	flags.Bool("precip_events", false, "Write evt_precip rain start events as precip_start points")
+	flags.Duration("precip_debounce", 0, "Drop rain start events within this long of the station's previous one")
+	flags.Bool("seq_gaps", false, "Count hub_status reports missed according to gaps in the hub's seq")
+	flags.Int("seq_rollover", 0, "Treat a seq this far below the last one as a hub reboot or rollover rather than a late report (default 100)")
+	flags.Bool("emit_debug_field", false, "Add the hub's debug value to hub status points when it is non-zero")
+	flags.Bool("rapid_wind_receipt_time", false, "Timestamp rapid wind with the nanosecond receipt time instead of the station's whole seconds")
+	flags.Bool("rapid_wind_seq", false, "Tag rapid wind with rapid_wind_seq, counting 0-9 within each second, so same-second points stay distinct")
+	flags.Bool("merge_rapid_wind", false, "Add the latest rapid wind to the next obs point instead of writing it separately")
+	flags.Bool("measurement_per_type", false, "Write rapid wind to a rapid_wind measurement instead of weather")
+	flags.Bool("dew_point", true, "Calculate and emit dew point")
+	flags.Bool("startup_banner", true, "Log a one-line summary of the effective settings at startup")
+	flags.Bool("daily_totals", false, "Emit rain_today, wind_run_today and strikes_today, reset at local midnight")
+	flags.Bool("temp_min_max", false, "Emit temp_min and temp_max, the day's low and high, reset at local midnight")
+	flags.Bool("gdd", false, "Emit gdd, the day's growing degree days from its low and high, and the final value at local midnight")
+	flags.Float64("gdd_base_temp", 0, "Base air temperature in degrees C for growing degree days (default 10)")
+	flags.Duration("accumulator_flush_interval", 0, "Also write daily totals this often, even if a station is silent (0 only writes at midnight)")
+	flags.Bool("strike_rate", false, "Emit strike_rate_10m, the lightning strikes per station over the last 10 minutes")
+	flags.Bool("metar_wind", false, "Emit wind_avg_2m and wind_gust_10m on obs, computed from rapid wind like a METAR (requires rapid_wind)")
+	flags.Bool("wet_bulb", false, "Emit derived wet bulb temperature")
+	flags.Bool("pressure_altitude", false, "Emit pressure altitude from station pressure, in feet with imperial units")
+	flags.Bool("enthalpy", false, "Emit moist air enthalpy in kJ/kg from temperature, humidity and pressure")
+	flags.Bool("frost_risk", false, "Emit frost_risk (0 or 1) when it is cold and moist enough for frost")
+	flags.Float64("frost_temp", 0, "Air temperature in degrees C at or below which frost_risk can trip (default 2)")
+	flags.String("collector_id", "", "Collector tag added to every point (default: hostname)")
+	flags.String("schema_tag", "", "Schema version written as a schema tag on every point")
+	flags.Bool("emit_source_ip", false, "Tag points with the sender's IP address")
+	flags.Bool("emit_recv_time", false, "Also write the collector's receipt time in seconds as recv_time")
+	flags.Int("batch_size", 0, "Lines to batch per InfluxDB write (0 disables batching)")
+	flags.Duration("batch_interval", 0, "Maximum time to hold a partial batch")
+	flags.Int("batch_retry_budget", 0, "Extra write requests a rejected batch may use to rewrite its accepted lines (0 drops the batch)")
+	flags.String("units", "", "Unit system for emitted values (metric or imperial)")
+	flags.Bool("unit_tags", false, "Tag weather points with the active units")
+	flags.StringToString("field_units", nil, "Override the unit per quantity (e.g. temp=C,wind=knots,pressure=inHg)")
+	flags.Bool("dual_pressure", false, "Also emit pressure in inHg as p_inhg")
+	flags.Float64("temp_offset", 0, "Calibration offset added to air temperature in degrees C")
+	flags.Float64("wind_declination", 0, "Magnetic declination in degrees added to wind direction for wind_direction_magnetic (disabled if 0)")
+	flags.Float64("humidity_offset", 0, "Calibration offset added to relative humidity in percent (result is kept within 0-100)")
+	flags.Float64("dew_point_min_humidity", 0, "Lowest relative humidity in percent the dew point is calculated for")
+	flags.StringToString("field_name_map", nil, "Rename emitted fields (e.g. temp=temperature,p=pressure)")
+	flags.Bool("conditions_string", false, "Also write a text summary of precipitation, temperature and wind (conditions)")
+	flags.Bool("categorical_fields", false, "Also write precipitation_type_str, wind_cardinal and uv_category")
+	flags.StringSlice("tag_fields", nil, "Fields to write as tags instead, such as precipitation_type_str,wind_cardinal")
+	flags.StringSlice("common_tags", nil, "Tags to add to every point: station, hub, firmware_revision or key=value, such as station,location=backyard")
+	flags.Int("max_tags", 0, "Most tags written per point besides station, hub and rapid_wind_seq, dropping the lowest priority ones beyond it (0 for no limit)")
+	flags.StringSlice("tag_priority", nil, "Tags to keep first under max_tags, highest priority first, such as collector,schema")
+	flags.Bool("emit_raw", false, "Also write the raw obs array as a JSON string field (raw_obs)")
+	flags.Bool("kelvin", false, "Also emit temperature and dew point in Kelvin")
+	flags.String("content_type", "", "Content-Type header for write requests")
+	flags.Bool("idempotency_key", false, "Send an Idempotency-Key header derived from the written points")
+	flags.Int("write_retries", 0, "Times to retry a failed InfluxDB write")
+	flags.Duration("retry_backoff", 0, "Initial delay between write retries, doubled each attempt up to 5m")
+	flags.Int("breaker_failure_threshold", 0, "Skip writes for breaker_cooldown after this many consecutive failed writes (0 disables)")
+	flags.Duration("breaker_cooldown", 0, "How long writes are skipped once the breaker opens, before a probe write")
+	flags.String("spool_dir", "", "Directory to spool undeliverable writes to for later replay (disabled if empty)")
+	flags.Bool("spool_compress", false, "Gzip spooled writes")
+	flags.Bool("spool_rotate", false, "Start a new spool file each day (spool-YYYY-MM-DD.jsonl)")
+	flags.Int("spool_retention", 0, "Daily spool files kept when rotating, oldest removed first (0 keeps all)")
+	flags.String("capture_dir", "", "Directory to record every received packet to, one file per day (disabled if empty)")
+	flags.Bool("capture_compress", false, "Gzip captured packets")
+	flags.Int("capture_retention", 0, "Daily capture files kept, oldest removed first (0 keeps all)")
+	flags.String("quarantine_dir", "", "Directory to save malformed packets to for inspection (disabled if empty)")
+	flags.Int("quarantine_max_files", 0, "Most malformed packets kept in the quarantine directory, oldest removed first")
+	flags.Bool("list_report_types", false, "Listen for list_duration, print a tally of report types received and exit")
+	flags.Duration("list_duration", 0, "How long --list-report-types listens for")
+	flags.Bool("check_write", false, "Write a synthetic point to InfluxDB, print the response and exit")
+	flags.Bool("self_test", false, "Send a synthetic packet to the listener, write it and exit 0 on success or 1 on failure")
+	flags.Bool("backfill", false, "Write historical obs from the WeatherFlow REST API between backfill_start and backfill_end, then exit")
+	flags.String("backfill_start", "", "Start of the backfill, as a date (2024-06-01) or RFC 3339 time")
+	flags.String("backfill_end", "", "End of the backfill, as a date (2024-06-01) or RFC 3339 time (default now)")
+	flags.Duration("backfill_request_interval", 0, "Minimum time between WeatherFlow REST API requests")
+	flags.String("wf_token", "", "WeatherFlow personal access token for backfills")
+	flags.String("wf_api_url", "", "WeatherFlow REST API base URL")
+	flags.Int("station_id", 0, "WeatherFlow station ID to backfill")
+	flags.String("precision", "", "InfluxDB write precision (s, ms, us or ns)")
+	flags.String("metrics_address", "", "Address for the metrics and debug HTTP server (disabled if empty)")
+	flags.Int("max_concurrent_packets", 0, "Drop packets while this many are being processed (0 is unlimited)")
+	flags.Duration("dns_cache_ttl", 0, "Cache the InfluxDB host's addresses for this long between lookups (0 resolves on every new connection)")
+	flags.Duration("parse_timeout", 0, "Abandon parsing a packet that takes longer than this; the parse isn't cancelled and runs on in the background (0 waits forever)")
+	flags.Int("max_packets", 0, "Shut down cleanly after receiving this many packets, for scripted runs (0 is unlimited)")
+	flags.Duration("station_timeout", 0, "Warn when a station that has reported goes silent for this long (0 disables)")
+	flags.Duration("shutdown_timeout", 0, "How long to wait for in-flight packets on shutdown before abandoning them (0 waits forever)")
+	flags.Int("workers", 0, "Process packets with a fixed pool of workers (0 starts a goroutine per packet)")
+	flags.Int("queue_size", 0, "Packets queued for the worker pool before dropping")
+	flags.String("drop_policy", "", "Packet discarded when the worker queue is full (oldest or newest)")
+	flags.Bool("station_ordering", false, "Process each station's packets in order on one worker, giving every worker its own queue")
+	flags.Bool("honor_sensor_status", false, "Leave out obs fields from sensors that sensor_status reports as failed")
+	flags.Bool("skip_zero_obs", false, "Drop warm-up obs with zero temperature, pressure and humidity")
+	flags.Duration("min_write_interval", 0, "Drop obs points arriving sooner than this after the last one from the same station")
 
 	// Removed env prefix so INFLUX_TOKEN and INFLUX_BUCKET are read directly
-	viper.AutomaticEnv()
+	v.AutomaticEnv()
 
-	flag.Parse()
-	if err := viper.BindPFlags(flag.CommandLine); err != nil {
-		log.Fatalf("Failed to bind pflags: %v", err)
+	if err := flags.Parse(args); err != nil {
+		return nil, fmt.Errorf("failed to parse flags: %w", err)
 	}
-	if viper.GetBool("debug") {
-		viper.Set("verbose", true)
+	if err := v.BindPFlags(flags); err != nil {
+		return nil, fmt.Errorf("failed to bind pflags: %w", err)
+	}
+	if v.GetBool("debug") {
+		v.Set("verbose", true)
 	}
 
-	err := viper.ReadInConfig()
-	if err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-		} else {
-			log.Fatalf("%v", err)
+	if explicit, _ := flags.GetString("config"); explicit != "" {
+		if err := readExplicitConfigFile(v, explicit); err != nil {
+			return nil, err
 		}
+	} else if err := readConfigFile(v, path, name); err != nil {
+		return nil, err
 	}
 
 	var config *Config
-	err = viper.Unmarshal(&config)
-	if err != nil {
-		log.Fatalf("Failed to unmarshal config: %v", err)
+	if err := v.Unmarshal(&config, viper.DecodeHook(decodeHook)); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+	config.Sources = settingSources(v, flags)
+
+	if config.Buffer > MaxUDPPayload && config.Buffer <= MaxBuffer {
+		log.Printf("Buffer size %d is larger than any UDP packet (%d bytes), the excess is unused", config.Buffer, MaxUDPPayload)
+	}
+
+	if config.trimAPIPath() {
+		log.Printf("INFLUX_URL already ends with the API path %s, using %s instead", config.APIPath(), config.Influx_URL)
 	}
 
-	// Debug print to help diagnose missing env vars
-	fmt.Printf("DEBUG: INFLUX_TOKEN=\"%s\" INFLUX_BUCKET=\"%s\"\n", config.Influx_Token, config.Influx_Bucket)
-	// Validate configuration using Lo library patterns
-	lo.Must0(config.Validate())
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// Setting is a single effective config value and where it came from
+type Setting struct {
+	Name   string
+	Value  string
+	Source string
+}
+
+// Settings lists every setting with its effective value and source, sorted by
+// name. Tokens and passwords, including one in INFLUX_URL, are redacted so
+// the result is safe to log.
+func (c *Config) Settings() []Setting {
+	value := reflect.ValueOf(c).Elem()
+	var settings []Setting
+	for i := 0; i < value.NumField(); i++ {
+		key, ok := settingKey(value.Type().Field(i))
+		if !ok {
+			continue
+		}
+
+		s := Setting{Name: key, Value: fmt.Sprint(value.Field(i).Interface()), Source: c.Sources[key]}
+		if (key == "influx_token" || key == "wf_token" || key == "kafka_password") && s.Value != "" {
+			s.Value = "[REDACTED]"
+		}
+		// Credentials in the URL are masked, as Banner leaves them out
+		if key == "influx_url" {
+			if u, err := url.Parse(s.Value); err == nil {
+				s.Value = u.Redacted()
+			}
+		}
+		if s.Source == "" {
+			s.Source = SourceDefault
+		}
+		settings = append(settings, s)
+	}
+
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Name < settings[j].Name })
+	return settings
+}
+
+// Banner summarizes the key operational settings on one line, so a
+// deployment can be confirmed at a glance. Only the host of INFLUX_URL is
+// shown, keeping credentials in the URL and the token out of logs.
+func (c *Config) Banner() string {
+	host := c.Influx_URL
+	if u, err := url.Parse(c.Influx_URL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+
+	reportTypes := []string{"obs_st"}
+	if c.Rapid_Wind {
+		reportTypes = append(reportTypes, "rapid_wind")
+	}
+	if c.Hub_Status {
+		reportTypes = append(reportTypes, "hub_status")
+	}
+	if c.Precip_Events {
+		reportTypes = append(reportTypes, "evt_precip")
+	}
+
+	units := c.Units
+	if units == "" {
+		units = DefaultUnits
+	}
+	output := c.Output_Mode
+	if output == "" {
+		output = DefaultOutputMode
+	}
+
+	banner := fmt.Sprintf("listen=%s influx_host=%s bucket=%s", c.Listen_Address, host, c.Influx_Bucket)
+	if c.Influx_Bucket_Rapid_Wind != "" {
+		banner += " rapid_wind_bucket=" + c.Influx_Bucket_Rapid_Wind
+	}
+	return banner + fmt.Sprintf(" report_types=%s units=%s output=%s", strings.Join(reportTypes, ","), units, output)
+}
+
+// settingKey returns the viper key for a Config field, or false for fields
+// that aren't settings
+func settingKey(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("mapstructure")
+	if tag == "-" {
+		return "", false
+	}
+	if tag == "" {
+		tag = field.Name
+	}
+	return strings.ToLower(tag), true
+}
 
-	return config
+// settingSources works out which layer supplied each setting, following
+// viper's precedence of flag over env over file over default
+func settingSources(v *viper.Viper, flags *flag.FlagSet) map[string]string {
+	sources := make(map[string]string)
+	fields := reflect.TypeOf(Config{})
+	for i := 0; i < fields.NumField(); i++ {
+		key, ok := settingKey(fields.Field(i))
+		if !ok {
+			continue
+		}
+
+		// Viper ignores empty environment variables unless told otherwise
+		switch {
+		case flags.Lookup(key) != nil && flags.Lookup(key).Changed:
+			sources[key] = SourceFlag
+		case os.Getenv(strings.ToUpper(key)) != "":
+			sources[key] = SourceEnv
+		case v.InConfig(key):
+			sources[key] = SourceFile
+		default:
+			sources[key] = SourceDefault
+		}
+	}
+	return sources
+}
+
+// configExtensions are the config file formats that can be read, in the
+// order the config directory is searched for them. The format is taken from
+// the extension.
+var configExtensions = []string{".yml", ".yaml", ".json", ".toml"}
+
+// readConfigFile reads the first config file named name with one of
+// configExtensions in path into v. A missing file is not an error since
+// everything can be supplied via environment or flags, but a file that exists
+// and cannot be used is reported rather than silently ignored.
+func readConfigFile(v *viper.Viper, path string, name string) error {
+	for _, ext := range configExtensions {
+		configPath := filepath.Join(path, name+ext)
+		info, err := os.Stat(configPath)
+		switch {
+		case os.IsNotExist(err):
+			continue
+		case err != nil:
+			return fmt.Errorf("failed to access config file %s: %w", configPath, err)
+		case info.IsDir():
+			return fmt.Errorf("%w: %s", ErrConfigIsDirectory, configPath)
+		}
+
+		v.SetConfigFile(configPath)
+		if err := v.ReadInConfig(); err != nil {
+			return fmt.Errorf("failed to read config file: %w", err)
+		}
+		return nil
+	}
+
+	log.Printf("Config file %s not found, using environment and flags", filepath.Join(path, name+configExtensions[0]))
+	return nil
+}
+
+// readExplicitConfigFile reads the config file given with --config. Unlike the
+// directory lookup, the file was asked for by name so it must exist.
+func readExplicitConfigFile(v *viper.Viper, file string) error {
+	info, err := os.Stat(file)
+	switch {
+	case err != nil:
+		return fmt.Errorf("failed to access config file %s: %w", file, err)
+	case info.IsDir():
+		return fmt.Errorf("%w: %s", ErrConfigIsDirectory, file)
+	}
+
+	// Files without an extension, such as ConfigMap keys, are YAML
+	switch ext := filepath.Ext(file); {
+	case ext == "":
+		v.SetConfigType("yaml")
+	case !slices.Contains(configExtensions, ext):
+		return fmt.Errorf("%w %q for %s, use %s", ErrConfigType, ext, file, strings.Join(configExtensions, ", "))
+	}
+
+	v.SetConfigFile(file)
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	return nil
+}
+
+// decodeHook extends viper's default decoding so maps can also be given as
+// "key=value,key=value" strings, which is the only form environment variables
+// can take
+var decodeHook = mapstructure.ComposeDecodeHookFunc(
+	mapstructure.StringToTimeDurationHookFunc(),
+	mapstructure.StringToSliceHookFunc(","),
+	stringToMapHook,
+)
+
+// stringToMapHook decodes "key=value,key=value" into a map[string]string
+func stringToMapHook(from reflect.Type, to reflect.Type, data any) (any, error) {
+	if from.Kind() != reflect.String || to != reflect.TypeOf(map[string]string{}) {
+		return data, nil
+	}
+
+	result := make(map[string]string)
+	for _, pair := range strings.Split(data.(string), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid map entry %q, expected key=value", pair)
+		}
+		result[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return result, nil
 }
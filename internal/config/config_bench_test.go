@@ -3,6 +3,8 @@ package config
 import (
 	"os"
 	"testing"
+
+	flag "github.com/spf13/pflag"
 )
 
 // Benchmark tests for configuration loading and validation
@@ -26,7 +28,7 @@ func BenchmarkLoadConfig(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		Load("/tmp", "tempest_influx")
+		_, _ = load(flag.NewFlagSet("bench", flag.ContinueOnError), nil, "/tmp", "tempest_influx")
 	}
 }
 
@@ -11,8 +11,13 @@ type Data struct {
 	Timestamp int64
 	Name      string
 	Bucket    string
+	Org       string
 	Tags      map[string]string
 	Fields    map[string]string
+
+	// Precision overrides the configured write precision for this point
+	// when set, since precision applies to a whole write request
+	Precision string
 }
 
 // New creates a new InfluxData struct
@@ -23,11 +28,15 @@ func New() *Data {
 	}
 }
 
+// tagEscaper escapes the characters line protocol requires in tag keys and
+// values, where a bare comma, space or equals sign would end the tag
+var tagEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `, `=`, `\=`)
+
 // Marshal converts InfluxData into Influx wire protocol
 func (m *Data) Marshal() string {
 	tags := make([]string, 0, len(m.Tags))
 	for tag, value := range m.Tags {
-		tags = append(tags, tag+"="+value)
+		tags = append(tags, tagEscaper.Replace(tag)+"="+tagEscaper.Replace(value))
 	}
 	sort.Strings(tags)
 
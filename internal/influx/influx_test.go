@@ -20,3 +20,19 @@ func TestInfluxDataMarshal(t *testing.T) {
 		t.Errorf("InfluxData.Marshal() = %v, want %v", line, expected)
 	}
 }
+
+func TestInfluxDataMarshalEscapesTags(t *testing.T) {
+	m := New()
+	m.Name = "weather"
+	m.Tags["reset_flags"] = "BOR,PIN,POR"
+	m.Tags["location"] = "back yard=north"
+	m.Fields["temp"] = "25.5"
+	m.Timestamp = 1640995200
+
+	line := m.Marshal()
+	expected := `weather,location=back\ yard\=north,reset_flags=BOR\,PIN\,POR temp=25.5 1640995200` + "\n"
+
+	if line != expected {
+		t.Errorf("InfluxData.Marshal() = %v, want %v", line, expected)
+	}
+}
@@ -1,6 +1,8 @@
 package logger
 
 import (
+	"context"
+	"io"
 	"log/slog"
 	"os"
 
@@ -10,27 +12,108 @@ import (
 // AppLogger wraps slog.Logger to provide structured logging
 type AppLogger struct {
 	*slog.Logger
+
+	// level can be changed at runtime; base is the configured level
+	level *slog.LevelVar
+	base  slog.Level
 }
 
 // New creates a new structured logger based on configuration
 func New(cfg *config.Config) *AppLogger {
-	var handler slog.Handler
-
-	opts := &slog.HandlerOptions{
-		Level: slog.LevelInfo,
+	// JSON_Stdout keeps stdout for observations alone
+	if cfg.JSON_Stdout {
+		return newLogger(cfg, os.Stderr, os.Stderr)
 	}
+	return newLogger(cfg, os.Stdout, os.Stderr)
+}
+
+// newLogger creates the logger for New, writing to stdout and, with
+// Log_Split_Streams, errors to stderr
+func newLogger(cfg *config.Config, stdout io.Writer, stderr io.Writer) *AppLogger {
 
+	base := slog.LevelInfo
 	if cfg.Debug {
-		opts.Level = slog.LevelDebug
+		base = slog.LevelDebug
+	}
+
+	level := &slog.LevelVar{}
+	level.Set(base)
+
+	opts := &slog.HandlerOptions{
+		Level: level,
 	}
 
 	// Use JSON handler for production, text handler for development
-	if cfg.Debug {
-		handler = slog.NewTextHandler(os.Stdout, opts)
-	} else {
-		handler = slog.NewJSONHandler(os.Stdout, opts)
+	newHandler := func(w io.Writer) slog.Handler {
+		if cfg.Debug {
+			return slog.NewTextHandler(w, opts)
+		}
+		return slog.NewJSONHandler(w, opts)
+	}
+
+	handler := newHandler(stdout)
+	if cfg.Log_Split_Streams {
+		handler = &splitHandler{out: handler, err: newHandler(stderr)}
 	}
 
 	logger := slog.New(handler)
-	return &AppLogger{Logger: logger}
+	return &AppLogger{Logger: logger, level: level, base: base}
+}
+
+// Level returns the current log level
+func (l *AppLogger) Level() slog.Level {
+	if l.level == nil {
+		return slog.LevelInfo
+	}
+	return l.level.Level()
+}
+
+// DebugEnabled reports whether debug messages are currently logged
+func (l *AppLogger) DebugEnabled() bool {
+	return l.Enabled(context.Background(), slog.LevelDebug)
+}
+
+// ToggleDebug switches between the configured level and debug, returning
+// the new level
+func (l *AppLogger) ToggleDebug() slog.Level {
+	if l.level == nil {
+		return slog.LevelInfo
+	}
+
+	if l.level.Level() == slog.LevelDebug && l.base != slog.LevelDebug {
+		l.level.Set(l.base)
+	} else {
+		l.level.Set(slog.LevelDebug)
+	}
+	return l.level.Level()
+}
+
+// splitHandler sends errors to one handler and everything else to another
+type splitHandler struct {
+	out slog.Handler
+	err slog.Handler
+}
+
+// handler returns the handler for records at level
+func (h *splitHandler) handler(level slog.Level) slog.Handler {
+	if level >= slog.LevelError {
+		return h.err
+	}
+	return h.out
+}
+
+func (h *splitHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler(level).Enabled(ctx, level)
+}
+
+func (h *splitHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.handler(r.Level).Handle(ctx, r)
+}
+
+func (h *splitHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &splitHandler{out: h.out.WithAttrs(attrs), err: h.err.WithAttrs(attrs)}
+}
+
+func (h *splitHandler) WithGroup(name string) slog.Handler {
+	return &splitHandler{out: h.out.WithGroup(name), err: h.err.WithGroup(name)}
 }
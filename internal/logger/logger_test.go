@@ -224,3 +224,60 @@ func BenchmarkLoggerJSON(b *testing.B) {
 		logger.Info("benchmark message", "iteration", i, "data", "test")
 	}
 }
+
+func TestToggleDebug(t *testing.T) {
+	logger := New(&config.Config{Debug: false})
+
+	if logger.Level() != slog.LevelInfo || logger.DebugEnabled() {
+		t.Fatalf("Expected info level initially, got %v", logger.Level())
+	}
+
+	if got := logger.ToggleDebug(); got != slog.LevelDebug {
+		t.Errorf("Expected debug after first toggle, got %v", got)
+	}
+	if !logger.DebugEnabled() {
+		t.Error("Expected debug to be enabled after toggle")
+	}
+
+	if got := logger.ToggleDebug(); got != slog.LevelInfo {
+		t.Errorf("Expected info after second toggle, got %v", got)
+	}
+	if logger.DebugEnabled() {
+		t.Error("Expected debug to be disabled after toggling back")
+	}
+}
+
+func TestToggleDebugWhenConfiguredDebug(t *testing.T) {
+	logger := New(&config.Config{Debug: true})
+
+	if got := logger.ToggleDebug(); got != slog.LevelDebug {
+		t.Errorf("Expected debug level to remain when configured, got %v", got)
+	}
+}
+
+func TestSplitStreams(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	logger := newLogger(&config.Config{Log_Split_Streams: true}, &stdout, &stderr)
+
+	logger.Info("info message")
+	logger.Warn("warn message")
+	logger.Error("error message")
+
+	if out := stdout.String(); !strings.Contains(out, "info message") || !strings.Contains(out, "warn message") || strings.Contains(out, "error message") {
+		t.Errorf("Expected info and warn only on stdout, got %q", out)
+	}
+	if errOut := stderr.String(); !strings.Contains(errOut, "error message") || strings.Contains(errOut, "info message") {
+		t.Errorf("Expected error only on stderr, got %q", errOut)
+	}
+}
+
+func TestSingleStreamByDefault(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	logger := newLogger(&config.Config{}, &stdout, &stderr)
+
+	logger.Error("error message")
+
+	if !strings.Contains(stdout.String(), "error message") || stderr.Len() != 0 {
+		t.Errorf("Expected errors on stdout without split streams, got stdout %q stderr %q", stdout.String(), stderr.String())
+	}
+}
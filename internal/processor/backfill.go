@@ -0,0 +1,258 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+	"github.com/jacaudi/tempest-influxdb/internal/logger"
+	"github.com/jacaudi/tempest-influxdb/internal/tempest"
+)
+
+// backfillWindow is the span of obs requested at once. The REST API only
+// returns one minute obs for short ranges, so longer backfills are paged.
+const backfillWindow = 24 * time.Hour
+
+// Rate limited requests are retried up to backfillMaxRetries times, waiting
+// for the Retry-After header or else backfillRetryAfter
+const (
+	backfillMaxRetries = 3
+	backfillRetryAfter = 30 * time.Second
+)
+
+// tempestDeviceType is the WeatherFlow device type of Tempest sensors
+const tempestDeviceType = "ST"
+
+// Backfill writes the Tempest obs recorded between Backfill_Start and
+// Backfill_End, fetched from the WeatherFlow REST API, through the same
+// parsing and writers as live data. It needs no listener, so it can run
+// alongside the collector to fill a gap after an outage. It returns the
+// number of obs processed.
+func Backfill(ctx context.Context, cfg *config.Config, appLogger *logger.AppLogger) (int, error) {
+	start, end, err := cfg.BackfillRange()
+	if err != nil {
+		return 0, err
+	}
+
+	ws, err := newPipeline(backfillConfig(cfg, appLogger), appLogger)
+	if err != nil {
+		return 0, err
+	}
+	stopWriters := ws.runWriters()
+	defer stopWriters()
+
+	api := &weatherFlowAPI{
+		baseURL:  strings.TrimSuffix(cfg.WF_API_URL, "/"),
+		token:    cfg.WF_Token,
+		interval: cfg.Backfill_Request_Interval,
+		client:   createOptimizedHTTPClient(),
+	}
+
+	devices, err := api.devices(ctx, cfg.Station_ID)
+	if err != nil {
+		return 0, fmt.Errorf("looking up station %d: %w", cfg.Station_ID, err)
+	}
+	if len(devices) == 0 {
+		return 0, fmt.Errorf("station %d has no Tempest devices", cfg.Station_ID)
+	}
+
+	processed := 0
+	for _, device := range devices {
+		for from := start; from.Before(end); from = from.Add(backfillWindow) {
+			to := from.Add(backfillWindow)
+			if to.After(end) {
+				to = end
+			}
+
+			rows, err := api.observations(ctx, device.ID, from, to)
+			if err != nil {
+				return processed, fmt.Errorf("fetching obs for %s: %w", device.Serial, err)
+			}
+
+			for _, row := range rows {
+				// Rebuild the UDP packet so nulls are handled as they are live
+				packet := fmt.Sprintf(`{"serial_number": %q, "type": "obs_st", "obs": [%s]}`, device.Serial, row)
+				report, err := tempest.DecodeReport([]byte(packet))
+				if err != nil {
+					appLogger.Warn("Skipping undecodable obs", "station", device.Serial, "error", err.Error())
+					continue
+				}
+				ws.processReport(ctx, nil, report, time.Now())
+				processed++
+			}
+
+			appLogger.Info("Backfilled obs",
+				"station", device.Serial,
+				"from", from.Format(time.RFC3339),
+				"to", to.Format(time.RFC3339),
+				"obs", len(rows))
+		}
+	}
+	return processed, nil
+}
+
+// backfillConfig returns cfg without the options that accumulate state
+// across live obs or stamp them with the receipt time. Historical obs would
+// otherwise write partial daily totals and growing degree days over the live
+// series, and a receipt time of now.
+func backfillConfig(cfg *config.Config, appLogger *logger.AppLogger) *config.Config {
+	if cfg.Daily_Totals || cfg.Temp_Min_Max || cfg.GDD || cfg.Strike_Rate || cfg.METAR_Wind ||
+		cfg.Min_Write_Interval > 0 || cfg.Emit_Recv_Time {
+		appLogger.Info("Backfill ignores daily_totals, temp_min_max, gdd, strike_rate, metar_wind, min_write_interval and emit_recv_time")
+	}
+
+	backfill := *cfg
+	backfill.Daily_Totals = false
+	backfill.Temp_Min_Max = false
+	backfill.GDD = false
+	backfill.Strike_Rate = false
+	backfill.METAR_Wind = false
+	backfill.Min_Write_Interval = 0
+	backfill.Emit_Recv_Time = false
+	return &backfill
+}
+
+// weatherFlowAPI reads station metadata and obs from the WeatherFlow REST
+// API, spacing requests at least interval apart
+type weatherFlowAPI struct {
+	baseURL  string
+	token    string
+	interval time.Duration
+	client   HTTPClient
+
+	// last is when the previous request was sent
+	last time.Time
+}
+
+// tempestDevice is a device attached to a WeatherFlow station
+type tempestDevice struct {
+	ID     int    `json:"device_id"`
+	Serial string `json:"serial_number"`
+	Type   string `json:"device_type"`
+}
+
+// devices returns the Tempest devices of a station
+func (a *weatherFlowAPI) devices(ctx context.Context, stationID int) ([]tempestDevice, error) {
+	var response struct {
+		Stations []struct {
+			Devices []tempestDevice `json:"devices"`
+		} `json:"stations"`
+	}
+	if err := a.get(ctx, "/stations/"+strconv.Itoa(stationID), nil, &response); err != nil {
+		return nil, err
+	}
+
+	var devices []tempestDevice
+	for _, station := range response.Stations {
+		for _, device := range station.Devices {
+			if device.Type == tempestDeviceType {
+				devices = append(devices, device)
+			}
+		}
+	}
+	return devices, nil
+}
+
+// observations returns the raw obs rows a device recorded from start up to
+// end, each in the same array format as a UDP obs_st packet
+func (a *weatherFlowAPI) observations(ctx context.Context, deviceID int, start time.Time, end time.Time) ([]json.RawMessage, error) {
+	var response struct {
+		Obs []json.RawMessage `json:"obs"`
+	}
+	// time_end is inclusive, so stop short of the next window's first obs
+	query := url.Values{
+		"time_start": {strconv.FormatInt(start.Unix(), 10)},
+		"time_end":   {strconv.FormatInt(end.Unix()-1, 10)},
+	}
+	if err := a.get(ctx, "/observations/device/"+strconv.Itoa(deviceID), query, &response); err != nil {
+		return nil, err
+	}
+	return response.Obs, nil
+}
+
+// get requests path and decodes the JSON response into out, retrying when
+// rate limited. Errors name only the path since the URL carries the token.
+func (a *weatherFlowAPI) get(ctx context.Context, path string, query url.Values, out any) error {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("token", a.token)
+
+	for attempt := 0; ; attempt++ {
+		if err := a.wait(ctx, a.interval); err != nil {
+			return err
+		}
+
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, a.baseURL+path+"?"+query.Encode(), nil)
+		if err != nil {
+			return fmt.Errorf("creating request for %s: %w", path, err)
+		}
+		request.Header.Set("Accept", "application/json")
+
+		a.last = time.Now()
+		resp, err := a.client.Do(request)
+		if err != nil {
+			return fmt.Errorf("requesting %s: %w", path, errors.Unwrap(err))
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < backfillMaxRetries {
+			_ = resp.Body.Close()
+			if err := a.wait(ctx, retryAfter(resp.Header.Get("Retry-After"))); err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = decodeAPIResponse(resp, path, out)
+		_ = resp.Body.Close()
+		return err
+	}
+}
+
+// wait blocks until at least d has passed since the previous request
+func (a *weatherFlowAPI) wait(ctx context.Context, d time.Duration) error {
+	delay := time.Until(a.last.Add(d))
+	if a.last.IsZero() || delay <= 0 {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
+
+// decodeAPIResponse decodes a successful response into out
+func decodeAPIResponse(resp *http.Response, path string, out any) error {
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("WF_TOKEN was rejected: %s returned %s", path, resp.Status)
+	case resp.StatusCode >= 300:
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, maxCheckBody))
+		return fmt.Errorf("%s returned %s: %s", path, resp.Status, strings.TrimSpace(string(detail)))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding %s: %w", path, err)
+	}
+	return nil
+}
+
+// retryAfter parses a Retry-After header in seconds, falling back to
+// backfillRetryAfter
+func retryAfter(header string) time.Duration {
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return backfillRetryAfter
+}
@@ -0,0 +1,197 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+	"github.com/jacaudi/tempest-influxdb/internal/logger"
+)
+
+// fakeWeatherFlowAPI mocks the WeatherFlow REST station and obs endpoints
+type fakeWeatherFlowAPI struct {
+	mu          sync.Mutex
+	obsRequests []string
+	rateLimited int
+}
+
+func (f *fakeWeatherFlowAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Query().Get("token") != "wf-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/stations/1234":
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"stations": []map[string]any{{
+				"devices": []map[string]any{
+					{"device_id": 1, "serial_number": "HB-1", "device_type": "HB"},
+					{"device_id": 2, "serial_number": "ST-1", "device_type": "ST"},
+				},
+			}},
+		})
+	case r.URL.Path == "/observations/device/2":
+		if f.rateLimited > 0 {
+			f.rateLimited--
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		f.obsRequests = append(f.obsRequests, r.URL.Query().Get("time_start")+"-"+r.URL.Query().Get("time_end"))
+		if len(f.obsRequests) > 1 {
+			_, _ = io.WriteString(w, `{"obs": null}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"type": "obs_st", "obs": [
+			[1717200000, 0.5, 1.2, 2.1, 200, 3, 1010.5, 18.2, 70, 20000, 1.1, 150, 0, 0, 0, 0, 2.6, 1],
+			[1717200060, 0.6, 1.3, 2.2, 210, 3, 1010.4, 18.3, 69, 21000, 1.2, 160, 0.1, 1, 0, 0, 2.6, 1]
+		]}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestBackfill(t *testing.T) {
+	var mu sync.Mutex
+	var lines []string
+	influx := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		lines = append(lines, strings.Split(strings.TrimSpace(string(body)), "\n")...)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer influx.Close()
+
+	api := &fakeWeatherFlowAPI{rateLimited: 1}
+	weatherFlow := httptest.NewServer(api)
+	defer weatherFlow.Close()
+
+	start := time.Unix(1717200000, 0)
+	cfg := &config.Config{
+		Influx_URL:     influx.URL,
+		Influx_Org:     "test-org",
+		Influx_Token:   "test-token",
+		Influx_Bucket:  "weather",
+		Dew_Point:      true,
+		WF_API_URL:     weatherFlow.URL,
+		WF_Token:       "wf-token",
+		Station_ID:     1234,
+		Backfill_Start: start.Format(time.RFC3339),
+		Backfill_End:   start.Add(36 * time.Hour).Format(time.RFC3339),
+	}
+
+	processed, err := Backfill(context.Background(), cfg, logger.New(&config.Config{}))
+	if err != nil {
+		t.Fatalf("Backfill() error = %v", err)
+	}
+	if processed != 2 {
+		t.Errorf("Expected 2 obs processed, got %d", processed)
+	}
+
+	// 36 hours is paged as a full day then the remaining 12 hours
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if len(api.obsRequests) != 2 || api.obsRequests[0] != "1717200000-1717286399" {
+		t.Errorf("Expected two daily pages, got %v", api.obsRequests)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 points written, got %v", lines)
+	}
+	for i, want := range []string{"temp=18.20", "temp=18.30"} {
+		if !strings.Contains(lines[i], "station=ST-1") || !strings.Contains(lines[i], want) || !strings.Contains(lines[i], "dew_point=") {
+			t.Errorf("Unexpected point %q", lines[i])
+		}
+	}
+}
+
+func TestBackfillSkipsLiveState(t *testing.T) {
+	var mu sync.Mutex
+	var lines []string
+	influx := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		lines = append(lines, strings.Split(strings.TrimSpace(string(body)), "\n")...)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer influx.Close()
+
+	weatherFlow := httptest.NewServer(&fakeWeatherFlowAPI{})
+	defer weatherFlow.Close()
+
+	start := time.Unix(1717200000, 0)
+	cfg := &config.Config{
+		Influx_URL:         influx.URL,
+		Influx_Org:         "test-org",
+		Influx_Token:       "test-token",
+		Influx_Bucket:      "weather",
+		Daily_Totals:       true,
+		Temp_Min_Max:       true,
+		GDD:                true,
+		Strike_Rate:        true,
+		Emit_Recv_Time:     true,
+		Min_Write_Interval: time.Hour,
+		WF_API_URL:         weatherFlow.URL,
+		WF_Token:           "wf-token",
+		Station_ID:         1234,
+		Backfill_Start:     start.Format(time.RFC3339),
+		Backfill_End:       start.Add(2 * time.Hour).Format(time.RFC3339),
+	}
+
+	if _, err := Backfill(context.Background(), cfg, logger.New(&config.Config{})); err != nil {
+		t.Fatalf("Backfill() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(lines) != 2 {
+		t.Fatalf("Expected both obs despite min_write_interval, got %v", lines)
+	}
+	for _, line := range lines {
+		for _, field := range []string{"rain_today=", "temp_min=", "gdd=", "strike_rate_10m=", "recv_time="} {
+			if strings.Contains(line, field) {
+				t.Errorf("Expected no %s in backfilled point %q", field, line)
+			}
+		}
+	}
+	if !cfg.Daily_Totals || cfg.Min_Write_Interval != time.Hour {
+		t.Error("Expected the caller's config to be left unchanged")
+	}
+}
+
+func TestBackfillRejectedToken(t *testing.T) {
+	weatherFlow := httptest.NewServer(&fakeWeatherFlowAPI{})
+	defer weatherFlow.Close()
+
+	cfg := &config.Config{
+		Influx_URL:     "http://localhost:8086",
+		Influx_Bucket:  "weather",
+		WF_API_URL:     weatherFlow.URL,
+		WF_Token:       "wrong",
+		Station_ID:     1234,
+		Backfill_Start: "2024-06-01",
+	}
+
+	_, err := Backfill(context.Background(), cfg, logger.New(&config.Config{}))
+	if err == nil || !strings.Contains(err.Error(), "WF_TOKEN was rejected") {
+		t.Errorf("Expected a rejected token error, got %v", err)
+	}
+	if err != nil && strings.Contains(err.Error(), "wrong") {
+		t.Errorf("Expected the token to be kept out of the error, got %v", err)
+	}
+}
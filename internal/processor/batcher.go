@@ -0,0 +1,96 @@
+package processor
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+)
+
+// flushFunc sends a batch of line protocol lines to a write URL
+type flushFunc func(ctx context.Context, writeURL string, lines []string)
+
+// batcher accumulates line protocol per write URL and flushes it in batches
+type batcher struct {
+	mu      sync.Mutex
+	size    int
+	pending map[string][]string
+	flush   flushFunc
+}
+
+// newBatcher creates a batcher that flushes a write URL once size lines are queued
+func newBatcher(size int, flush flushFunc) *batcher {
+	return &batcher{
+		size:    size,
+		pending: make(map[string][]string),
+		flush:   flush,
+	}
+}
+
+// add queues a line for writeURL, flushing that URL if the batch is full
+func (b *batcher) add(ctx context.Context, writeURL string, line string) {
+	b.mu.Lock()
+	b.pending[writeURL] = append(b.pending[writeURL], line)
+	var full []string
+	if len(b.pending[writeURL]) >= b.size {
+		full = b.pending[writeURL]
+		delete(b.pending, writeURL)
+	}
+	b.mu.Unlock()
+
+	if full != nil {
+		b.flush(ctx, writeURL, full)
+	}
+}
+
+// len returns the number of queued lines across all write URLs
+func (b *batcher) len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := 0
+	for _, lines := range b.pending {
+		n += len(lines)
+	}
+	return n
+}
+
+// flushAll sends every queued line
+func (b *batcher) flushAll(ctx context.Context) {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = make(map[string][]string)
+	b.mu.Unlock()
+
+	for writeURL, lines := range pending {
+		b.flush(ctx, writeURL, lines)
+	}
+}
+
+// run flushes on every interval until stop is closed, then performs a final
+// synchronous flush so nothing queued before shutdown is lost
+func (b *batcher) run(stop <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			b.flushAll(context.Background())
+		case <-stop:
+			// The service context is already cancelled at this point, so the
+			// final flush gets its own bounded context
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.DefaultTimeout)*time.Second)
+			b.flushAll(ctx)
+			cancel()
+			return
+		}
+	}
+}
+
+// joinLines joins newline terminated line protocol lines into one request body
+func joinLines(lines []string) string {
+	return strings.Join(lines, "")
+}
@@ -0,0 +1,75 @@
+package processor
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+// recordingFlush records every flushed batch
+type recordingFlush struct {
+	mu      sync.Mutex
+	batches map[string][][]string
+}
+
+func newRecordingFlush() *recordingFlush {
+	return &recordingFlush{batches: make(map[string][][]string)}
+}
+
+func (r *recordingFlush) flush(_ context.Context, writeURL string, lines []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches[writeURL] = append(r.batches[writeURL], lines)
+}
+
+func TestBatcherFlushesWhenFull(t *testing.T) {
+	rec := newRecordingFlush()
+	b := newBatcher(2, rec.flush)
+
+	b.add(context.Background(), "a", "one\n")
+	if len(rec.batches["a"]) != 0 {
+		t.Fatal("Expected no flush before batch is full")
+	}
+
+	b.add(context.Background(), "a", "two\n")
+	if len(rec.batches["a"]) != 1 || len(rec.batches["a"][0]) != 2 {
+		t.Fatalf("Expected one batch of two lines, got %v", rec.batches["a"])
+	}
+
+	if b.len() != 0 {
+		t.Errorf("Expected empty batcher after flush, got %d lines", b.len())
+	}
+}
+
+func TestBatcherGroupsByWriteURL(t *testing.T) {
+	rec := newRecordingFlush()
+	b := newBatcher(10, rec.flush)
+
+	b.add(context.Background(), "a", "one\n")
+	b.add(context.Background(), "b", "two\n")
+	b.flushAll(context.Background())
+
+	if len(rec.batches["a"]) != 1 || len(rec.batches["b"]) != 1 {
+		t.Errorf("Expected one batch per write URL, got %v", rec.batches)
+	}
+}
+
+func TestBatcherRunFinalFlush(t *testing.T) {
+	rec := newRecordingFlush()
+	b := newBatcher(10, rec.flush)
+	b.add(context.Background(), "a", "one\n")
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.run(stop, 1<<40)
+	}()
+
+	close(stop)
+	<-done
+
+	if len(rec.batches["a"]) != 1 {
+		t.Errorf("Expected final flush on stop, got %v", rec.batches)
+	}
+}
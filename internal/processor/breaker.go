@@ -0,0 +1,76 @@
+package processor
+
+import (
+	"sync"
+	"time"
+)
+
+// breaker is a circuit breaker for writes. After threshold consecutive
+// failures it opens for cooldown, during which writes are skipped. Once the
+// cooldown expires it is half-open: a single probe write is let through,
+// and its success closes the breaker while its failure opens it again.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time // zero while closed
+	probing   bool
+	skipped   uint64
+}
+
+// newBreaker creates a closed breaker
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow reports whether a write may be attempted at now. While half-open
+// only the first caller is allowed, as the probe.
+func (b *breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case b.openUntil.IsZero():
+		return true
+	case now.Before(b.openUntil) || b.probing:
+		b.skipped++
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// success records a delivered write, closing the breaker
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.openUntil = time.Time{}
+	b.probing = false
+}
+
+// failure records a failed write at now and reports whether it opened the
+// breaker, either by reaching the threshold or by failing the probe
+func (b *breaker) failure(now time.Time) (opened bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if !b.probing && (!b.openUntil.IsZero() || b.failures < b.threshold) {
+		return false
+	}
+	b.openUntil = now.Add(b.cooldown)
+	b.probing = false
+	return true
+}
+
+// state reports whether the breaker is open or half-open, and how many
+// writes it has skipped
+func (b *breaker) state() (open bool, skipped uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.openUntil.IsZero(), b.skipped
+}
@@ -0,0 +1,172 @@
+package processor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+)
+
+func TestBreaker(t *testing.T) {
+	b := newBreaker(3, time.Minute)
+	now := time.Unix(1640995200, 0)
+
+	for i := 0; i < 2; i++ {
+		if b.failure(now) {
+			t.Fatalf("Expected the breaker to stay closed after %d failures", i+1)
+		}
+	}
+	if !b.allow(now) {
+		t.Fatal("Expected writes below the threshold to be allowed")
+	}
+	if !b.failure(now) {
+		t.Fatal("Expected the third failure to open the breaker")
+	}
+	if b.allow(now.Add(30 * time.Second)) {
+		t.Error("Expected writes to be skipped during the cooldown")
+	}
+
+	// Half-open: one probe, and its failure opens the breaker again
+	probe := now.Add(time.Minute)
+	if !b.allow(probe) {
+		t.Fatal("Expected a probe once the cooldown expires")
+	}
+	if b.allow(probe) {
+		t.Error("Expected only one probe while half-open")
+	}
+	if !b.failure(probe) {
+		t.Error("Expected a failed probe to open the breaker again")
+	}
+	if b.allow(probe.Add(30 * time.Second)) {
+		t.Error("Expected a failed probe to start a new cooldown")
+	}
+
+	// A successful probe closes it
+	probe = probe.Add(time.Minute)
+	if !b.allow(probe) {
+		t.Fatal("Expected a probe once the second cooldown expires")
+	}
+	b.success()
+	if open, skipped := b.state(); open || skipped != 3 {
+		t.Errorf("Expected a closed breaker that skipped 3 writes, got open %v skipped %d", open, skipped)
+	}
+	if b.failure(probe) {
+		t.Error("Expected a success to reset the failure count")
+	}
+}
+
+func TestWriteBreakerSkipsAndSpools(t *testing.T) {
+	var mu sync.Mutex
+	healthy := false
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	service := newTestService(t, &config.Config{Influx_URL: server.URL})
+	writer := httpWriter(service)
+	writer.breaker = newBreaker(2, time.Minute)
+	var err error
+	writer.spool, err = newSpool(t.TempDir(), true)
+	if err != nil {
+		t.Fatalf("newSpool() error = %v", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		writer.write(context.Background(), writer.writeURL("test-bucket"), "weather,station=ST-1 temp=1.00 1\n")
+	}
+
+	mu.Lock()
+	if requests != 2 {
+		t.Errorf("Expected writes to stop reaching InfluxDB once the breaker opened, got %d requests", requests)
+	}
+	healthy = true
+	mu.Unlock()
+
+	records, err := writer.spool.take()
+	if err != nil {
+		t.Fatalf("take() error = %v", err)
+	}
+	if len(records) != 4 {
+		t.Errorf("Expected failed and skipped writes to be spooled, got %d", len(records))
+	}
+
+	recorder := httptest.NewRecorder()
+	service.writers = []Writer{writer}
+	service.handleMetrics(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+	for _, want := range []string{"tempest_influx_breaker_open 1", "tempest_influx_breaker_skipped_total 2"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %s in metrics, got:\n%s", want, body)
+		}
+	}
+
+	// Expire the cooldown so the next write is the probe, which closes it
+	writer.breaker.mu.Lock()
+	writer.breaker.openUntil = time.Now().Add(-time.Second)
+	writer.breaker.mu.Unlock()
+	writer.write(context.Background(), writer.writeURL("test-bucket"), "weather,station=ST-1 temp=2.00 2\n")
+
+	if open, _ := writer.breaker.state(); open {
+		t.Error("Expected a successful probe to close the breaker")
+	}
+}
+
+func TestWriteBreakerRejectedProbe(t *testing.T) {
+	var mu sync.Mutex
+	status := http.StatusServiceUnavailable
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	service := newTestService(t, &config.Config{Influx_URL: server.URL})
+	writer := httpWriter(service)
+	writer.breaker = newBreaker(1, time.Minute)
+
+	writer.write(context.Background(), writer.writeURL("test-bucket"), "weather,station=ST-1 temp=1.00 1\n")
+	if open, _ := writer.breaker.state(); !open {
+		t.Fatal("Expected the failed write to open the breaker")
+	}
+
+	// InfluxDB is back but rejects the probe's point
+	mu.Lock()
+	status = http.StatusBadRequest
+	mu.Unlock()
+	writer.breaker.mu.Lock()
+	writer.breaker.openUntil = time.Now().Add(-time.Second)
+	writer.breaker.mu.Unlock()
+	writer.write(context.Background(), writer.writeURL("test-bucket"), "weather,station=ST-1 temp=\"bad\" 2\n")
+
+	if open, _ := writer.breaker.state(); open {
+		t.Error("Expected a rejected probe to close the breaker since InfluxDB answered")
+	}
+
+	mu.Lock()
+	status = http.StatusNoContent
+	mu.Unlock()
+	writer.write(context.Background(), writer.writeURL("test-bucket"), "weather,station=ST-1 temp=3.00 3\n")
+
+	mu.Lock()
+	defer mu.Unlock()
+	if requests != 3 {
+		t.Errorf("Expected writes after the rejected probe to reach InfluxDB, got %d requests", requests)
+	}
+}
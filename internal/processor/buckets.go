@@ -0,0 +1,180 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+	"github.com/jacaudi/tempest-influxdb/internal/logger"
+	"github.com/jacaudi/tempest-influxdb/internal/tempest"
+)
+
+// bucketAPI manages buckets through the InfluxDB 2.x HTTP API
+type bucketAPI struct {
+	config *config.Config
+	client HTTPClient
+}
+
+// EnsureBuckets creates any configured bucket missing from InfluxDB, with
+// Bucket_Retention as its retention period
+func EnsureBuckets(ctx context.Context, cfg *config.Config, appLogger *logger.AppLogger) error {
+	api := &bucketAPI{config: cfg, client: createOptimizedHTTPClient()}
+
+	for _, route := range configuredBuckets(cfg) {
+		created, err := api.ensure(ctx, route.org, route.bucket)
+		if err != nil {
+			return fmt.Errorf("ensuring bucket %s in %s: %w", route.bucket, route.org, err)
+		}
+		if created {
+			appLogger.Info("Created InfluxDB bucket",
+				"bucket", route.bucket,
+				"org", route.org,
+				"retention", cfg.Bucket_Retention.String())
+		}
+	}
+	return nil
+}
+
+// bucketRoute is a bucket and the organization it belongs to
+type bucketRoute struct {
+	org    string
+	bucket string
+}
+
+// configuredBuckets returns every distinct bucket points can be written to,
+// sorted by organization and bucket
+func configuredBuckets(cfg *config.Config) []bucketRoute {
+	reportTypes := []string{"obs_st", "rapid_wind", "hub_status"}
+	for reportType := range cfg.Influx_Buckets {
+		reportTypes = append(reportTypes, reportType)
+	}
+	for reportType := range cfg.Influx_Orgs {
+		reportTypes = append(reportTypes, reportType)
+	}
+
+	seen := make(map[bucketRoute]bool)
+	routes := []bucketRoute{}
+	for _, reportType := range reportTypes {
+		route := bucketRoute{org: tempest.Org(cfg, reportType), bucket: tempest.Bucket(cfg, reportType)}
+		if route.bucket == "" || seen[route] {
+			continue
+		}
+		seen[route] = true
+		routes = append(routes, route)
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].org != routes[j].org {
+			return routes[i].org < routes[j].org
+		}
+		return routes[i].bucket < routes[j].bucket
+	})
+	return routes
+}
+
+// ensure creates bucket in org if it does not exist, reporting whether it did
+func (a *bucketAPI) ensure(ctx context.Context, org string, bucket string) (bool, error) {
+	var found struct {
+		Buckets []struct {
+			Name string `json:"name"`
+		} `json:"buckets"`
+	}
+	query := url.Values{"name": {bucket}, "org": {org}}
+	if err := a.do(ctx, http.MethodGet, "/api/v2/buckets?"+query.Encode(), nil, &found); err != nil {
+		return false, err
+	}
+	for _, b := range found.Buckets {
+		if b.Name == bucket {
+			return false, nil
+		}
+	}
+
+	orgID, err := a.orgID(ctx, org)
+	if err != nil {
+		return false, err
+	}
+
+	// An empty retention rule list keeps data forever
+	retentionRules := []map[string]any{}
+	if a.config.Bucket_Retention > 0 {
+		retentionRules = append(retentionRules, map[string]any{
+			"type":         "expire",
+			"everySeconds": int64(a.config.Bucket_Retention / time.Second),
+		})
+	}
+	request := map[string]any{
+		"orgID":          orgID,
+		"name":           bucket,
+		"retentionRules": retentionRules,
+	}
+	if err := a.do(ctx, http.MethodPost, "/api/v2/buckets", request, nil); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// orgID looks up the ID of an organization
+func (a *bucketAPI) orgID(ctx context.Context, org string) (string, error) {
+	var orgs struct {
+		Orgs []struct {
+			ID string `json:"id"`
+		} `json:"orgs"`
+	}
+	query := url.Values{"org": {org}}
+	if err := a.do(ctx, http.MethodGet, "/api/v2/orgs?"+query.Encode(), nil, &orgs); err != nil {
+		return "", err
+	}
+	if len(orgs.Orgs) == 0 {
+		return "", fmt.Errorf("organization %s not found", org)
+	}
+	return orgs.Orgs[0].ID, nil
+}
+
+// do sends a JSON API request, decoding the response into out if given
+func (a *bucketAPI) do(ctx context.Context, method string, path string, in any, out any) error {
+	var body io.Reader
+	if in != nil {
+		encoded, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(a.config.Influx_URL, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Token "+a.config.Influx_Token)
+	request.Header.Set("Accept", "application/json")
+	if in != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := a.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("token lacks permission to manage buckets: %s %s returned %s", method, path, resp.Status)
+	case resp.StatusCode >= 300:
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, maxCheckBody))
+		return fmt.Errorf("%s %s returned %s: %s", method, path, resp.Status, strings.TrimSpace(string(detail)))
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
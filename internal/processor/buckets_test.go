@@ -0,0 +1,131 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+	"github.com/jacaudi/tempest-influxdb/internal/logger"
+)
+
+// fakeBucketsAPI mocks the InfluxDB buckets and orgs APIs
+type fakeBucketsAPI struct {
+	mu      sync.Mutex
+	buckets map[string]bool
+	created []map[string]any
+	status  int
+}
+
+func (f *fakeBucketsAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+		return
+	}
+	if r.Header.Get("Authorization") != "Token test-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v2/buckets":
+		var found []map[string]string
+		if name := r.URL.Query().Get("name"); f.buckets[name] {
+			found = append(found, map[string]string{"name": name})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"buckets": found})
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v2/orgs":
+		_ = json.NewEncoder(w).Encode(map[string]any{"orgs": []map[string]string{{"id": "org-1"}}})
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v2/buckets":
+		var request map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		f.created = append(f.created, request)
+		f.buckets[request["name"].(string)] = true
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newBucketsConfig(url string) *config.Config {
+	return &config.Config{
+		Influx_URL:       url,
+		Influx_Org:       "test-org",
+		Influx_Token:     "test-token",
+		Influx_Bucket:    "weather",
+		Bucket_Retention: 30 * 24 * time.Hour,
+	}
+}
+
+func TestEnsureBucketsExisting(t *testing.T) {
+	api := &fakeBucketsAPI{buckets: map[string]bool{"weather": true}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	if err := EnsureBuckets(context.Background(), newBucketsConfig(server.URL), logger.New(&config.Config{})); err != nil {
+		t.Fatalf("EnsureBuckets() error = %v", err)
+	}
+	if len(api.created) != 0 {
+		t.Errorf("Expected no buckets created, got %v", api.created)
+	}
+}
+
+func TestEnsureBucketsCreatesMissing(t *testing.T) {
+	api := &fakeBucketsAPI{buckets: map[string]bool{"weather": true}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	cfg := newBucketsConfig(server.URL)
+	cfg.Influx_Buckets = map[string]string{"rapid_wind": "wind"}
+
+	if err := EnsureBuckets(context.Background(), cfg, logger.New(&config.Config{})); err != nil {
+		t.Fatalf("EnsureBuckets() error = %v", err)
+	}
+	if len(api.created) != 1 {
+		t.Fatalf("Expected 1 bucket created, got %v", api.created)
+	}
+
+	created := api.created[0]
+	if created["name"] != "wind" || created["orgID"] != "org-1" {
+		t.Errorf("Unexpected bucket request %v", created)
+	}
+	rules, _ := created["retentionRules"].([]any)
+	if len(rules) != 1 || rules[0].(map[string]any)["everySeconds"] != float64(30*24*60*60) {
+		t.Errorf("Expected 30 day retention, got %v", created["retentionRules"])
+	}
+}
+
+func TestEnsureBucketsPermissionDenied(t *testing.T) {
+	server := httptest.NewServer(&fakeBucketsAPI{status: http.StatusForbidden})
+	defer server.Close()
+
+	err := EnsureBuckets(context.Background(), newBucketsConfig(server.URL), logger.New(&config.Config{}))
+	if err == nil || !strings.Contains(err.Error(), "lacks permission") {
+		t.Errorf("Expected a permission error, got %v", err)
+	}
+}
+
+func TestConfiguredBucketsPerOrg(t *testing.T) {
+	cfg := newBucketsConfig("http://localhost:8086")
+	cfg.Influx_Buckets = map[string]string{"hub_status": "status"}
+	cfg.Influx_Orgs = map[string]string{"hub_status": "ops"}
+
+	got := configuredBuckets(cfg)
+	want := []bucketRoute{{org: "ops", bucket: "status"}, {org: "test-org", bucket: "weather"}}
+	if len(got) != len(want) {
+		t.Fatalf("configuredBuckets() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("configuredBuckets()[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// capturePrefix names daily capture files, capture-YYYY-MM-DD.jsonl
+const capturePrefix = "capture"
+
+// captureRecord is a received packet as written to a capture file
+type captureRecord struct {
+	Time   time.Time `json:"time"`
+	Source string    `json:"source,omitempty"`
+	Packet string    `json:"packet"`
+}
+
+// capture records every received packet as JSON lines in one file per day,
+// for building fixtures and investigating station behaviour after the fact.
+// When compress is set each record is its own gzip member, as in the spool.
+type capture struct {
+	mu       sync.Mutex
+	file     *rotatingFile
+	compress bool
+}
+
+// newCapture creates a capture in dir that keeps at most retain days of
+// files (0 keeps every file)
+func newCapture(dir string, compress bool, retain int) (*capture, error) {
+	ext := jsonlExt
+	if compress {
+		ext += gzipExt
+	}
+	file, err := newRotatingFile(dir, capturePrefix, ext, retain)
+	if err != nil {
+		return nil, fmt.Errorf("creating capture directory: %w", err)
+	}
+	return &capture{file: file, compress: compress}, nil
+}
+
+// record appends a packet received from addr at the given time
+func (c *capture) record(addr *net.UDPAddr, packet []byte, at time.Time) error {
+	record := captureRecord{Time: at, Packet: string(packet)}
+	if addr != nil {
+		record.Source = addr.String()
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if c.compress {
+		if line, err = gzipMember(line); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.file.append(line, at)
+}
@@ -0,0 +1,79 @@
+package processor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+	"github.com/jacaudi/tempest-influxdb/internal/logger"
+)
+
+func TestProcessPacketCapture(t *testing.T) {
+	dir := t.TempDir()
+	c, err := newCapture(dir, false, 0)
+	if err != nil {
+		t.Fatalf("newCapture() error = %v", err)
+	}
+	service := &WeatherService{
+		config:       &config.Config{Influx_Bucket: "test-bucket"},
+		logger:       logger.New(&config.Config{}),
+		writers:      []Writer{&recordingWriter{}},
+		stations:     newStationTracker(),
+		capture:      c,
+		parseLatency: newParseLatency(),
+	}
+
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	service.processPacket(context.Background(), addr, []byte(testObsPacket), len(testObsPacket))
+
+	data, err := os.ReadFile(filepath.Join(dir, "capture-"+time.Now().Format("2006-01-02")+".jsonl"))
+	if err != nil {
+		t.Fatalf("Failed to read capture file: %v", err)
+	}
+	var record captureRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		t.Fatalf("Capture file is not a JSON record: %v", err)
+	}
+	if record.Packet != testObsPacket || record.Source != "192.168.1.100:50222" {
+		t.Errorf("Unexpected capture record %+v", record)
+	}
+}
+
+func TestCaptureCompress(t *testing.T) {
+	dir := t.TempDir()
+	c, err := newCapture(dir, true, 0)
+	if err != nil {
+		t.Fatalf("newCapture() error = %v", err)
+	}
+
+	at := time.Date(2024, 6, 1, 12, 0, 0, 0, time.Local)
+	for _, packet := range []string{"one", "two"} {
+		if err := c.record(nil, []byte(packet), at); err != nil {
+			t.Fatalf("record() error = %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "capture-2024-06-01.jsonl.gz"))
+	if err != nil {
+		t.Fatalf("Failed to read capture file: %v", err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Capture file is not gzipped: %v", err)
+	}
+	plain, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("Failed to decompress capture file: %v", err)
+	}
+	if lines := len(splitMessages(plain)); lines != 2 {
+		t.Errorf("Expected 2 records, got %d", lines)
+	}
+}
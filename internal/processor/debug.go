@@ -0,0 +1,78 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+)
+
+// startDebugServer serves debugging endpoints on the metrics address until
+// ctx is cancelled
+func (ws *WeatherService) startDebugServer(ctx context.Context) error {
+	listener, err := net.Listen("tcp", ws.config.Metrics_Address)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/state", ws.handleState)
+	mux.HandleFunc("/metrics", ws.handleMetrics)
+
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			ws.logger.Error("Debug server failed", "error", err.Error())
+		}
+	}()
+
+	ws.logger.Info("Debug server listening", "address", listener.Addr().String())
+	return nil
+}
+
+// handleState returns the per-station derived state as JSON
+func (ws *WeatherService) handleState(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"stations": ws.stations.snapshot(),
+	})
+}
+
+// handleMetrics returns metrics in the Prometheus text format
+func (ws *WeatherService) handleMetrics(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	ws.parseLatency.writeTo(w)
+
+	// Only a listening service receives packets; backfills don't
+	if last := ws.lastPacket.Load(); last != 0 {
+		writeLastPacket(w, time.Unix(0, last), time.Now())
+	}
+
+	if ws.config.Parse_Timeout > 0 {
+		writeAbandonedParses(w, ws.abandonedParses.Load(), ws.parseTimeoutDrops.Load())
+	}
+
+	stations := ws.stations.snapshot()
+	writeBattery(w, stations)
+	if ws.config.Station_Timeout > 0 {
+		writeSilentStations(w, stations)
+	}
+	if ws.config.Seq_Gaps {
+		writeSeqMissed(w, stations)
+	}
+	for _, writer := range ws.writers {
+		if influx, ok := writer.(*InfluxHTTPWriter); ok && influx.breaker != nil {
+			writeBreaker(w, influx.breaker)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+	"github.com/jacaudi/tempest-influxdb/internal/logger"
+)
+
+func TestHandleStateReflectsProcessedPackets(t *testing.T) {
+	service := newTestService(t, &config.Config{
+		Influx_URL: "http://localhost:8086",
+		Noop:       true,
+	})
+
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	service.processPacket(context.Background(), addr, []byte(testObsPacket), len(testObsPacket))
+	service.processPacket(context.Background(), addr, []byte(testObsPacket), len(testObsPacket))
+
+	recorder := httptest.NewRecorder()
+	service.handleState(recorder, httptest.NewRequest("GET", "/state", nil))
+
+	var body struct {
+		Stations map[string]stationState `json:"stations"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode state: %v", err)
+	}
+
+	state, ok := body.Stations["ST-123456"]
+	if !ok {
+		t.Fatalf("Expected state for ST-123456, got %v", body.Stations)
+	}
+	if state.Packets["obs_st"] != 2 {
+		t.Errorf("Expected 2 obs_st packets, got %d", state.Packets["obs_st"])
+	}
+	if state.LastTimestamp["obs_st"] != 1640995200 {
+		t.Errorf("Expected last obs_st timestamp 1640995200, got %d", state.LastTimestamp["obs_st"])
+	}
+}
+
+func TestHandleMetricsRecordsParseLatency(t *testing.T) {
+	service := newTestService(t, &config.Config{
+		Influx_URL: "http://localhost:8086",
+		Noop:       true,
+		Rapid_Wind: true,
+	})
+
+	wind := `{"serial_number": "ST-123456", "type": "rapid_wind", "ob": [1640995200, 5.5, 270]}`
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	service.processPacket(context.Background(), addr, []byte(testObsPacket), len(testObsPacket))
+	service.processPacket(context.Background(), addr, []byte(wind), len(wind))
+	service.processPacket(context.Background(), addr, []byte(wind), len(wind))
+
+	if got := service.parseLatency.count("obs_st"); got != 1 {
+		t.Errorf("Expected 1 obs_st observation, got %d", got)
+	}
+	if got := service.parseLatency.count("rapid_wind"); got != 2 {
+		t.Errorf("Expected 2 rapid_wind observations, got %d", got)
+	}
+
+	recorder := httptest.NewRecorder()
+	service.handleMetrics(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	if body := recorder.Body.String(); !strings.Contains(body, `tempest_parse_duration_seconds_count{report_type="rapid_wind"} 2`) {
+		t.Errorf("Expected rapid_wind count in metrics, got:\n%s", body)
+	}
+}
+
+func TestHandleMetricsSilentStations(t *testing.T) {
+	service := newTestService(t, &config.Config{
+		Influx_URL:      "http://localhost:8086",
+		Noop:            true,
+		Station_Timeout: time.Minute,
+	})
+
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	service.processPacket(context.Background(), addr, []byte(testObsPacket), len(testObsPacket))
+	service.checkStations(time.Now().Add(2*time.Minute), time.Minute)
+
+	recorder := httptest.NewRecorder()
+	service.handleMetrics(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	if body := recorder.Body.String(); !strings.Contains(body, `tempest_station_silent{station="ST-123456"} 1`) {
+		t.Errorf("Expected silent station in metrics, got:\n%s", body)
+	}
+}
+
+func TestHandleMetricsSeqMissed(t *testing.T) {
+	service := newTestService(t, &config.Config{
+		Influx_URL:   "http://localhost:8086",
+		Noop:         true,
+		Seq_Gaps:     true,
+		Seq_Rollover: 100,
+	})
+
+	// A hub reboot drops seq back to 0, then one report is lost
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	for _, seq := range []int{9000, 9001, 0, 2} {
+		packet := fmt.Sprintf(`{"serial_number": "HB-1", "type": "hub_status", "timestamp": 1640995200, "seq": %d}`, seq)
+		service.processPacket(context.Background(), addr, []byte(packet), len(packet))
+	}
+
+	recorder := httptest.NewRecorder()
+	service.handleMetrics(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	if body := recorder.Body.String(); !strings.Contains(body, `tempest_hub_seq_missed_total{hub="HB-1"} 1`) {
+		t.Errorf("Expected 1 missed hub status in metrics, got:\n%s", body)
+	}
+}
+
+func TestHandleMetricsBattery(t *testing.T) {
+	service := newTestService(t, &config.Config{
+		Influx_URL: "http://localhost:8086",
+		Noop:       true,
+	})
+
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	readings := []struct{ serial, battery string }{
+		{"ST-1", "2.70"},
+		{"ST-2", "2.65"},
+		{"ST-1", "2.41"},
+	}
+	for _, reading := range readings {
+		packet := strings.Replace(strings.Replace(testObsPacket, "ST-123456", reading.serial, 1), "3.7", reading.battery, 1)
+		service.processPacket(context.Background(), addr, []byte(packet), len(packet))
+	}
+
+	recorder := httptest.NewRecorder()
+	service.handleMetrics(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := recorder.Body.String()
+	for _, want := range []string{
+		`tempest_station_battery_volts{station="ST-1"} 2.41`,
+		`tempest_station_battery_volts{station="ST-2"} 2.65`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %s in metrics, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestHandleMetricsSecondsSinceLastPacket(t *testing.T) {
+	cfg := &config.Config{
+		Listen_Address: "127.0.0.1:0",
+		Influx_URL:     "http://localhost:8086",
+		Influx_Bucket:  "test-bucket",
+		Buffer:         1024,
+	}
+	service, err := NewWeatherService(cfg, logger.New(&config.Config{}))
+	if err != nil {
+		t.Fatalf("NewWeatherService() error = %v", err)
+	}
+	defer func() { _ = service.listener.Close() }()
+
+	sinceLastPacket := func() float64 {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		service.handleMetrics(recorder, httptest.NewRequest("GET", "/metrics", nil))
+		for _, line := range strings.Split(recorder.Body.String(), "\n") {
+			if value, ok := strings.CutPrefix(line, "tempest_seconds_since_last_packet "); ok {
+				seconds, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					t.Fatalf("Invalid gauge value %q", value)
+				}
+				return seconds
+			}
+		}
+		t.Fatalf("Expected tempest_seconds_since_last_packet in metrics, got:\n%s", recorder.Body.String())
+		return 0
+	}
+
+	// Idle since a minute ago
+	service.lastPacket.Store(time.Now().Add(-time.Minute).UnixNano())
+	idle := sinceLastPacket()
+	if idle < 60 {
+		t.Errorf("Expected at least 60 seconds while idle, got %v", idle)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if grown := sinceLastPacket(); grown <= idle {
+		t.Errorf("Expected the gauge to grow while idle, got %v then %v", idle, grown)
+	}
+
+	sendPacket(t, service, testObsPacket)
+	if _, _, _, ok := service.readPacket(); !ok {
+		t.Fatal("Expected a packet to be read")
+	}
+	if got := sinceLastPacket(); got >= 1 {
+		t.Errorf("Expected the gauge to reset on receive, got %v", got)
+	}
+}
+
+func TestStartContinuesWhenMetricsAddressInUse(t *testing.T) {
+	occupied, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to occupy a port: %v", err)
+	}
+	defer func() { _ = occupied.Close() }()
+
+	cfg := &config.Config{
+		Listen_Address:  "127.0.0.1:0",
+		Influx_URL:      "http://localhost:8086",
+		Influx_Bucket:   "test-bucket",
+		Buffer:          1024,
+		Metrics_Address: occupied.Addr().String(),
+	}
+	service, err := NewWeatherService(cfg, logger.New(&config.Config{}))
+	if err != nil {
+		t.Fatalf("NewWeatherService() error = %v", err)
+	}
+	recorder := &recordingWriter{}
+	service.writers = []Writer{recorder}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- service.Start(ctx)
+	}()
+
+	sendPacket(t, service, testObsPacket)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		recorder.mu.Lock()
+		written := len(recorder.points)
+		recorder.mu.Unlock()
+		if written == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the packet to be written despite the metrics port being in use")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-errChan; err != context.Canceled {
+		t.Errorf("Expected Start to run until cancelled, got %v", err)
+	}
+}
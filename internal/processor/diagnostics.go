@@ -0,0 +1,138 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+	"github.com/jacaudi/tempest-influxdb/internal/logger"
+	"github.com/jacaudi/tempest-influxdb/internal/tempest"
+)
+
+// ReportTally counts the report types received from stations
+type ReportTally struct {
+	Types         map[string]int
+	ParseFailures int
+}
+
+// String formats the tally as one report type per line, sorted by type
+func (t ReportTally) String() string {
+	types := make([]string, 0, len(t.Types))
+	for reportType := range t.Types {
+		types = append(types, reportType)
+	}
+	sort.Strings(types)
+
+	var sb strings.Builder
+	for _, reportType := range types {
+		fmt.Fprintf(&sb, "%-16s %d\n", reportType, t.Types[reportType])
+	}
+	fmt.Fprintf(&sb, "%-16s %d\n", "parse failures", t.ParseFailures)
+	return sb.String()
+}
+
+// TallyReportTypes listens for the given duration, counting each report type
+// received without writing anything to InfluxDB
+func (ws *WeatherService) TallyReportTypes(ctx context.Context, duration time.Duration) ReportTally {
+	defer func() { _ = ws.listener.Close() }()
+
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	tally := ReportTally{Types: make(map[string]int)}
+	for ctx.Err() == nil {
+		b, n, _, ok := ws.readPacket()
+		if !ok {
+			continue
+		}
+
+		report, err := tempest.DecodeReport(b[:n])
+		if err != nil || report.ReportType == "" {
+			tally.ParseFailures++
+			continue
+		}
+		tally.Types[report.ReportType]++
+	}
+
+	return tally
+}
+
+// CheckWriteStation is the station tag on the point written by CheckWrite,
+// so it can be told apart from real data and deleted
+const CheckWriteStation = "check-write"
+
+// WriteCheck is the outcome of a CheckWrite request
+type WriteCheck struct {
+	URL        string
+	Status     string
+	StatusCode int
+	Body       string
+}
+
+// String formats the check for printing
+func (c WriteCheck) String() string {
+	s := fmt.Sprintf("POST %s\n%s\n", c.URL, c.Status)
+	if c.Body != "" {
+		s += c.Body + "\n"
+	}
+	return s
+}
+
+// syntheticObsPacket returns a plausible obs_st packet from station at the
+// given time
+func syntheticObsPacket(station string, at time.Time) string {
+	return fmt.Sprintf(`{"serial_number": %q, "type": "obs_st", "obs": [[%d, 1.5, 2.3, 3.8, 180, 3, 1013.25, 20.0, 50.0, 50000, 5.2, 800, 0, 0, 0, 0, 2.7, 1]]}`,
+		station, at.Unix())
+}
+
+// maxCheckBody limits how much of an error response CheckWrite keeps
+const maxCheckBody = 4096
+
+// CheckWrite writes a synthetic obs point through the same parsing, URL and
+// request building as live data, ignoring Noop, so credentials, organization,
+// bucket and URL can be verified before relying on the collector. It returns
+// an error unless the write is accepted.
+func CheckWrite(ctx context.Context, cfg *config.Config, appLogger *logger.AppLogger) (WriteCheck, error) {
+	influxURL, err := buildInfluxURL(cfg)
+	if err != nil {
+		return WriteCheck{}, fmt.Errorf("invalid InfluxDB URL: %w", err)
+	}
+	w := &InfluxHTTPWriter{
+		config:    cfg,
+		logger:    appLogger,
+		client:    createOptimizedHTTPClient(),
+		influxURL: influxURL,
+	}
+
+	packet := syntheticObsPacket(CheckWriteStation, time.Now())
+	m, err := tempest.Parse(cfg, nil, []byte(packet), len(packet))
+	if err != nil {
+		return WriteCheck{}, fmt.Errorf("building synthetic point: %w", err)
+	}
+
+	check := WriteCheck{URL: w.pointURL(m)}
+	request, err := w.newRequest(ctx, check.URL, m.Marshal())
+	if err != nil {
+		return check, fmt.Errorf("creating request: %w", err)
+	}
+
+	resp, err := w.client.Do(request)
+	if err != nil {
+		return check, fmt.Errorf("posting to InfluxDB: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxCheckBody))
+	check.Status = resp.Status
+	check.StatusCode = resp.StatusCode
+	check.Body = strings.TrimSpace(string(body))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return check, fmt.Errorf("InfluxDB rejected the write: %s", resp.Status)
+	}
+	return check, nil
+}
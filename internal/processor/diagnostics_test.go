@@ -0,0 +1,104 @@
+package processor
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+	"github.com/jacaudi/tempest-influxdb/internal/logger"
+)
+
+func TestTallyReportTypes(t *testing.T) {
+	cfg := &config.Config{
+		Listen_Address: "127.0.0.1:0",
+		Influx_URL:     "http://localhost:8086",
+		Buffer:         1024,
+	}
+
+	service, err := NewWeatherService(cfg, logger.New(&config.Config{}))
+	if err != nil {
+		t.Fatalf("NewWeatherService() error = %v", err)
+	}
+
+	packets := []string{
+		testObsPacket,
+		`{"serial_number": "ST-123456", "type": "rapid_wind", "ob": [1640995200, 5.5, 270]}`,
+		`{"serial_number": "ST-123456", "type": "rapid_wind", "ob": [1640995203, 5.1, 265]}`,
+		`{"type": "hub_status"}`,
+		`not json`,
+	}
+	for _, packet := range packets {
+		sendPacket(t, service, packet)
+	}
+
+	tally := service.TallyReportTypes(context.Background(), 300*time.Millisecond)
+
+	want := map[string]int{"obs_st": 1, "rapid_wind": 2, "hub_status": 1}
+	for reportType, count := range want {
+		if tally.Types[reportType] != count {
+			t.Errorf("Expected %d %s reports, got %d", count, reportType, tally.Types[reportType])
+		}
+	}
+
+	if tally.ParseFailures != 1 {
+		t.Errorf("Expected 1 parse failure, got %d", tally.ParseFailures)
+	}
+
+	if !strings.Contains(tally.String(), "rapid_wind") {
+		t.Errorf("Expected tally output to list rapid_wind, got %q", tally.String())
+	}
+}
+
+func TestCheckWrite(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr bool
+	}{
+		{"accepted", http.StatusNoContent, "", false},
+		{"unauthorized", http.StatusUnauthorized, `{"code":"unauthorized","message":"unauthorized access"}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				received = string(body)
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			// Noop must not stop the check from posting
+			cfg := &config.Config{
+				Influx_URL:      server.URL,
+				Influx_API_Path: "/api/v2/write",
+				Influx_Org:      "test-org",
+				Influx_Token:    "test-token",
+				Influx_Bucket:   "test-bucket",
+				Noop:            true,
+			}
+
+			check, err := CheckWrite(context.Background(), cfg, logger.New(&config.Config{}))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckWrite() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if check.StatusCode != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, check.StatusCode)
+			}
+			if check.Body != tt.body {
+				t.Errorf("Expected body %q, got %q", tt.body, check.Body)
+			}
+			if !strings.Contains(received, "station="+CheckWriteStation) {
+				t.Errorf("Expected a synthetic obs point, got %q", received)
+			}
+		})
+	}
+}
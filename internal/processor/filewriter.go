@@ -0,0 +1,45 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jacaudi/tempest-influxdb/internal/influx"
+)
+
+// Line protocol files are named points-YYYY-MM-DD.lp
+const (
+	pointsPrefix    = "points"
+	lineProtocolExt = ".lp"
+)
+
+// FileWriter appends points as line protocol to one file per day, as a
+// durable sink for air-gapped or archival setups. Files can be loaded later
+// with influx write or any line protocol tool.
+type FileWriter struct {
+	mu   sync.Mutex
+	file *rotatingFile
+}
+
+// NewFileWriter creates a FileWriter in dir that keeps at most retain days
+// of files (0 keeps every file)
+func NewFileWriter(dir string, retain int) (*FileWriter, error) {
+	file, err := newRotatingFile(dir, pointsPrefix, lineProtocolExt, retain)
+	if err != nil {
+		return nil, fmt.Errorf("creating output file directory: %w", err)
+	}
+	return &FileWriter{file: file}, nil
+}
+
+// Write appends m as a line protocol line to the file for the current
+// local day. The first write of a new day starts a new file and removes the
+// oldest beyond the retained days.
+func (w *FileWriter) Write(_ context.Context, m *influx.Data) error {
+	line := m.Marshal()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.append([]byte(line), time.Now())
+}
@@ -0,0 +1,80 @@
+package processor
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+	"github.com/jacaudi/tempest-influxdb/internal/logger"
+)
+
+func TestFileWriter(t *testing.T) {
+	dir := t.TempDir()
+	writer, err := NewFileWriter(dir, 0)
+	if err != nil {
+		t.Fatalf("NewFileWriter() error = %v", err)
+	}
+	service := newTestService(t, &config.Config{Influx_Bucket: "test-bucket", Rapid_Wind: true})
+	service.writers = []Writer{writer}
+
+	wind := `{"serial_number": "ST-123456", "type": "rapid_wind", "ob": [1640995200, 5.5, 270]}`
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	for _, packet := range []string{testObsPacket, wind} {
+		service.processPacket(context.Background(), addr, []byte(packet), len(packet))
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "points-"+time.Now().Format("2006-01-02")+".lp"))
+	if err != nil {
+		t.Fatalf("Failed to read points file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected one line per point, got %q", data)
+	}
+	if !strings.HasPrefix(lines[0], "weather,station=ST-123456 ") || !strings.HasSuffix(lines[0], " 1640995200") {
+		t.Errorf("Unexpected obs line %s", lines[0])
+	}
+	if !strings.Contains(lines[0], "temp=25.50") {
+		t.Errorf("Expected temp in obs line %s", lines[0])
+	}
+	if !strings.Contains(lines[1], "rapid_wind_speed=5.50") {
+		t.Errorf("Expected rapid wind speed in %s", lines[1])
+	}
+}
+
+func TestNewPipelineOutputMode(t *testing.T) {
+	tests := []struct {
+		mode     string
+		wantHTTP bool
+		wantFile bool
+	}{
+		{config.OutputHTTP, true, false},
+		{config.OutputFile, false, true},
+		{config.OutputBoth, true, true},
+	}
+
+	for _, tt := range tests {
+		cfg := &config.Config{Influx_URL: "http://localhost:8086", Buffer: 1024, Output_Mode: tt.mode, Output_File_Dir: t.TempDir()}
+		ws, err := newPipeline(cfg, logger.New(&config.Config{}))
+		if err != nil {
+			t.Fatalf("newPipeline() error = %v", err)
+		}
+		var gotHTTP, gotFile bool
+		for _, w := range ws.writers {
+			switch w.(type) {
+			case *InfluxHTTPWriter:
+				gotHTTP = true
+			case *FileWriter:
+				gotFile = true
+			}
+		}
+		if gotHTTP != tt.wantHTTP || gotFile != tt.wantFile {
+			t.Errorf("Output mode %s: HTTP writer %v, file writer %v", tt.mode, gotHTTP, gotFile)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package processor
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+	"github.com/jacaudi/tempest-influxdb/internal/influx"
+	"github.com/jacaudi/tempest-influxdb/internal/logger"
+	"github.com/jacaudi/tempest-influxdb/internal/tempest"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// kafkaProducer publishes messages, as kafka.Writer does, and can be
+// replaced in tests
+type kafkaProducer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// KafkaWriter publishes each point to a Kafka topic as a JSON or Avro
+// tempest.Observation, keyed by station serial so a station's points stay
+// in order on one partition. Messages are sent in the background, so a slow
+// or unreachable cluster doesn't hold up the other writers.
+type KafkaWriter struct {
+	config   *config.Config
+	logger   *logger.AppLogger
+	producer kafkaProducer
+}
+
+// NewKafkaWriter creates a KafkaWriter publishing to Kafka_Topic on
+// Kafka_Brokers
+func NewKafkaWriter(cfg *config.Config, appLogger *logger.AppLogger) (*KafkaWriter, error) {
+	transport := &kafka.Transport{}
+	if cfg.Kafka_TLS {
+		transport.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if cfg.Kafka_SASL_Mechanism != "" {
+		mechanism, err := kafkaSASL(cfg)
+		if err != nil {
+			return nil, err
+		}
+		transport.SASL = mechanism
+	}
+
+	w := &KafkaWriter{config: cfg, logger: appLogger}
+	w.producer = &kafka.Writer{
+		Addr:       kafka.TCP(cfg.Kafka_Brokers...),
+		Topic:      cfg.Kafka_Topic,
+		Balancer:   &kafka.Hash{},
+		Async:      true,
+		Completion: w.completed,
+		Transport:  transport,
+	}
+	return w, nil
+}
+
+// kafkaSASL returns the SASL mechanism named by Kafka_SASL_Mechanism
+func kafkaSASL(cfg *config.Config) (sasl.Mechanism, error) {
+	switch cfg.Kafka_SASL_Mechanism {
+	case config.SASLPlain:
+		return plain.Mechanism{Username: cfg.Kafka_Username, Password: cfg.Kafka_Password}, nil
+	case config.SASLScramSHA256:
+		return scram.Mechanism(scram.SHA256, cfg.Kafka_Username, cfg.Kafka_Password)
+	case config.SASLScramSHA512:
+		return scram.Mechanism(scram.SHA512, cfg.Kafka_Username, cfg.Kafka_Password)
+	}
+	return nil, fmt.Errorf("unsupported Kafka SASL mechanism %q", cfg.Kafka_SASL_Mechanism)
+}
+
+// Write queues m for publishing, keyed by its station serial or, for hub
+// status, its hub serial. The message is sent in the background, so the
+// returned error only covers encoding and queueing; failed publishes are
+// logged when the producer reports them.
+func (w *KafkaWriter) Write(ctx context.Context, m *influx.Data) error {
+	value, err := w.encode(tempest.NewObservation(w.config, m))
+	if err != nil {
+		return err
+	}
+
+	// Hub status points have no station, so they are keyed by hub
+	key := m.Tags["station"]
+	if key == "" {
+		key = m.Tags["hub"]
+	}
+	return w.producer.WriteMessages(ctx, kafka.Message{Key: []byte(key), Value: value})
+}
+
+// encode encodes obs in the configured Kafka_Format
+func (w *KafkaWriter) encode(obs tempest.Observation) ([]byte, error) {
+	if w.config.Kafka_Format == config.KafkaFormatAvro {
+		return obs.MarshalAvro(), nil
+	}
+	return json.Marshal(obs)
+}
+
+// completed logs messages the producer failed to publish in the background
+func (w *KafkaWriter) completed(messages []kafka.Message, err error) {
+	if err != nil {
+		w.logger.Error("Failed to publish to Kafka",
+			"topic", w.config.Kafka_Topic,
+			"messages", len(messages),
+			"error", err.Error())
+	}
+}
+
+// run closes the producer once stop is closed, flushing pending messages
+func (w *KafkaWriter) run(stop <-chan struct{}) {
+	<-stop
+	if err := w.producer.Close(); err != nil {
+		w.logger.Error("Failed to close Kafka producer", "error", err.Error())
+	}
+}
@@ -0,0 +1,147 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+	"github.com/jacaudi/tempest-influxdb/internal/logger"
+	"github.com/jacaudi/tempest-influxdb/internal/tempest"
+	"github.com/segmentio/kafka-go"
+)
+
+// mockProducer records published messages, failing each publish with err
+type mockProducer struct {
+	mu       sync.Mutex
+	messages []kafka.Message
+	closed   bool
+	err      error
+}
+
+func (p *mockProducer) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	p.messages = append(p.messages, msgs...)
+	return nil
+}
+
+func (p *mockProducer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	return nil
+}
+
+// newTestKafkaWriter creates a KafkaWriter publishing to producer
+func newTestKafkaWriter(cfg *config.Config, producer kafkaProducer) *KafkaWriter {
+	return &KafkaWriter{config: cfg, logger: logger.New(&config.Config{}), producer: producer}
+}
+
+func TestKafkaWriter(t *testing.T) {
+	for _, format := range []string{config.KafkaFormatJSON, config.KafkaFormatAvro} {
+		t.Run(format, func(t *testing.T) {
+			cfg := &config.Config{Influx_Bucket: "test-bucket", Kafka_Topic: "weather", Kafka_Format: format}
+			producer := &mockProducer{}
+			points := &recordingWriter{}
+			service := newTestService(t, cfg)
+			service.writers = []Writer{newTestKafkaWriter(cfg, producer), points}
+
+			addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+			service.processPacket(context.Background(), addr, []byte(testObsPacket), len(testObsPacket))
+
+			if len(producer.messages) != 1 || len(points.points) != 1 {
+				t.Fatalf("Expected one message per point, got %d", len(producer.messages))
+			}
+			msg := producer.messages[0]
+			if string(msg.Key) != "ST-123456" {
+				t.Errorf("Expected the station serial as key, got %q", msg.Key)
+			}
+
+			obs := tempest.NewObservation(cfg, points.points[0])
+			if format == config.KafkaFormatAvro {
+				if !bytes.Equal(msg.Value, obs.MarshalAvro()) {
+					t.Errorf("Expected the Avro encoded observation, got %x", msg.Value)
+				}
+				return
+			}
+			for _, want := range []string{`"measurement":"weather"`, `"tags":{"station":"ST-123456"}`, `"temp":25.5`} {
+				if !strings.Contains(string(msg.Value), want) {
+					t.Errorf("Expected %s in %s", want, msg.Value)
+				}
+			}
+		})
+	}
+}
+
+func TestKafkaWriterFailureDoesNotBlockWriters(t *testing.T) {
+	cfg := &config.Config{Influx_Bucket: "test-bucket", Kafka_Topic: "weather"}
+	producer := &mockProducer{err: errors.New("no brokers available")}
+	points := &recordingWriter{}
+	service := newTestService(t, cfg)
+	service.writers = []Writer{newTestKafkaWriter(cfg, producer), points}
+
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	service.processPacket(context.Background(), addr, []byte(testObsPacket), len(testObsPacket))
+
+	if len(points.points) != 1 {
+		t.Errorf("Expected the point to reach the other writers, got %d", len(points.points))
+	}
+}
+
+func TestKafkaWriterKeyAndClose(t *testing.T) {
+	cfg := &config.Config{Influx_Bucket: "test-bucket", Kafka_Topic: "weather", Hub_Status: true}
+	producer := &mockProducer{}
+	writer := newTestKafkaWriter(cfg, producer)
+	service := newTestService(t, cfg)
+	service.writers = []Writer{writer}
+
+	hub := `{"serial_number": "HB-00000001", "type": "hub_status", "firmware_revision": "35", "uptime": 1670133, "rssi": -62, "timestamp": 1495724691, "reset_flags": "BOR,PIN,POR", "seq": 48, "radio_stats": [2, 1, 0, 3, 2839]}`
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	service.processPacket(context.Background(), addr, []byte(hub), len(hub))
+
+	if len(producer.messages) != 1 || string(producer.messages[0].Key) != "HB-00000001" {
+		t.Errorf("Expected hub status keyed by hub serial, got %v", producer.messages)
+	}
+
+	stop := make(chan struct{})
+	close(stop)
+	writer.run(stop)
+	if !producer.closed {
+		t.Error("Expected the producer to be closed on stop")
+	}
+}
+
+func TestNewPipelineKafka(t *testing.T) {
+	cfg := &config.Config{
+		Influx_URL:           "http://localhost:8086",
+		Buffer:               1024,
+		Kafka_Brokers:        []string{"kafka-1:9092", "kafka-2:9092"},
+		Kafka_Topic:          "weather",
+		Kafka_SASL_Mechanism: config.SASLScramSHA256,
+		Kafka_Username:       "collector",
+		Kafka_Password:       "secret",
+		Kafka_TLS:            true,
+	}
+	ws, err := newPipeline(cfg, logger.New(&config.Config{}))
+	if err != nil {
+		t.Fatalf("newPipeline() error = %v", err)
+	}
+
+	writer, ok := ws.writers[len(ws.writers)-1].(*KafkaWriter)
+	if !ok {
+		t.Fatalf("Expected a KafkaWriter, got %T", ws.writers[len(ws.writers)-1])
+	}
+	producer := writer.producer.(*kafka.Writer)
+	transport := producer.Transport.(*kafka.Transport)
+	if producer.Topic != "weather" || transport.SASL.Name() != "SCRAM-SHA-256" || transport.TLS == nil {
+		t.Errorf("Unexpected producer settings: topic %q, SASL %s, TLS %v", producer.Topic, transport.SASL.Name(), transport.TLS)
+	}
+}
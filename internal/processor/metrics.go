@@ -0,0 +1,198 @@
+package processor
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// parseLatencyBuckets are the histogram upper bounds in seconds. Parsing is
+// normally tens of microseconds, so the buckets focus there.
+var parseLatencyBuckets = []float64{0.00001, 0.000025, 0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.01}
+
+// histogram is a cumulative Prometheus style histogram
+type histogram struct {
+	counts []uint64 // one per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// latencyHistograms records a histogram per report type
+type latencyHistograms struct {
+	mu      sync.Mutex
+	name    string
+	help    string
+	buckets []float64
+	byType  map[string]*histogram
+}
+
+// newLatencyHistograms creates an empty set of histograms for metric name
+func newLatencyHistograms(name string, help string, buckets []float64) *latencyHistograms {
+	return &latencyHistograms{
+		name:    name,
+		help:    help,
+		buckets: buckets,
+		byType:  make(map[string]*histogram),
+	}
+}
+
+// observe records a duration for a report type
+func (l *latencyHistograms) observe(reportType string, d time.Duration) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	h, ok := l.byType[reportType]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(l.buckets))}
+		l.byType[reportType] = h
+	}
+
+	seconds := d.Seconds()
+	if i := sort.SearchFloat64s(l.buckets, seconds); i < len(l.buckets) {
+		h.counts[i]++
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// count returns how many durations were recorded for a report type
+func (l *latencyHistograms) count(reportType string) uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if h, ok := l.byType[reportType]; ok {
+		return h.count
+	}
+	return 0
+}
+
+// writeTo writes the histograms in the Prometheus text exposition format
+func (l *latencyHistograms) writeTo(w io.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", l.name, l.help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", l.name)
+
+	types := make([]string, 0, len(l.byType))
+	for reportType := range l.byType {
+		types = append(types, reportType)
+	}
+	sort.Strings(types)
+
+	for _, reportType := range types {
+		h := l.byType[reportType]
+		var cumulative uint64
+		for i, bound := range l.buckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "%s_bucket{report_type=%q,le=%q} %d\n",
+				l.name, reportType, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{report_type=%q,le=\"+Inf\"} %d\n", l.name, reportType, h.count)
+		fmt.Fprintf(w, "%s_sum{report_type=%q} %s\n", l.name, reportType, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "%s_count{report_type=%q} %d\n", l.name, reportType, h.count)
+	}
+}
+
+// writeSilentStations writes a gauge per station that is 1 while the station
+// watchdog considers it silent
+func writeSilentStations(w io.Writer, stations map[string]stationState) {
+	fmt.Fprintln(w, "# HELP tempest_station_silent Whether the station has not reported within the station timeout")
+	fmt.Fprintln(w, "# TYPE tempest_station_silent gauge")
+
+	serials := make([]string, 0, len(stations))
+	for serial := range stations {
+		serials = append(serials, serial)
+	}
+	sort.Strings(serials)
+
+	for _, serial := range serials {
+		silent := 0
+		if stations[serial].Silent {
+			silent = 1
+		}
+		fmt.Fprintf(w, "tempest_station_silent{station=%q} %d\n", serial, silent)
+	}
+}
+
+// writeSeqMissed writes a counter per hub of the hub_status reports its seq
+// shows were missed
+func writeSeqMissed(w io.Writer, stations map[string]stationState) {
+	fmt.Fprintln(w, "# HELP tempest_hub_seq_missed_total Hub status reports missed according to gaps in the hub's seq")
+	fmt.Fprintln(w, "# TYPE tempest_hub_seq_missed_total counter")
+
+	serials := make([]string, 0, len(stations))
+	for serial, state := range stations {
+		if state.seqSeen {
+			serials = append(serials, serial)
+		}
+	}
+	sort.Strings(serials)
+
+	for _, serial := range serials {
+		fmt.Fprintf(w, "tempest_hub_seq_missed_total{hub=%q} %d\n", serial, stations[serial].SeqMissed)
+	}
+}
+
+// writeBattery writes a gauge per station of the battery voltage in its
+// latest obs
+func writeBattery(w io.Writer, stations map[string]stationState) {
+	fmt.Fprintln(w, "# HELP tempest_station_battery_volts Battery voltage reported in the station's latest obs")
+	fmt.Fprintln(w, "# TYPE tempest_station_battery_volts gauge")
+
+	serials := make([]string, 0, len(stations))
+	for serial, state := range stations {
+		if state.batterySeen {
+			serials = append(serials, serial)
+		}
+	}
+	sort.Strings(serials)
+
+	for _, serial := range serials {
+		fmt.Fprintf(w, "tempest_station_battery_volts{station=%q} %s\n", serial, strconv.FormatFloat(stations[serial].Battery, 'g', -1, 64))
+	}
+}
+
+// writeBreaker writes whether the write breaker is open and how many writes
+// it has skipped
+func writeBreaker(w io.Writer, b *breaker) {
+	open, skipped := b.state()
+	gauge := 0
+	if open {
+		gauge = 1
+	}
+
+	fmt.Fprintln(w, "# HELP tempest_influx_breaker_open Whether InfluxDB writes are paused after repeated failures")
+	fmt.Fprintln(w, "# TYPE tempest_influx_breaker_open gauge")
+	fmt.Fprintf(w, "tempest_influx_breaker_open %d\n", gauge)
+	fmt.Fprintln(w, "# HELP tempest_influx_breaker_skipped_total Writes skipped while the breaker was open")
+	fmt.Fprintln(w, "# TYPE tempest_influx_breaker_skipped_total counter")
+	fmt.Fprintf(w, "tempest_influx_breaker_skipped_total %d\n", skipped)
+}
+
+// writeLastPacket writes the seconds since the listener last received any
+// packet. Unlike a silent station, a large value means the collector has
+// stopped hearing the network entirely.
+func writeLastPacket(w io.Writer, last time.Time, now time.Time) {
+	fmt.Fprintln(w, "# HELP tempest_seconds_since_last_packet Seconds since any UDP packet was received")
+	fmt.Fprintln(w, "# TYPE tempest_seconds_since_last_packet gauge")
+	fmt.Fprintf(w, "tempest_seconds_since_last_packet %s\n", strconv.FormatFloat(now.Sub(last).Seconds(), 'f', 3, 64))
+}
+
+// writeAbandonedParses writes the timed out parses still running and the
+// packets dropped because too many were
+func writeAbandonedParses(w io.Writer, running int64, dropped int64) {
+	fmt.Fprintln(w, "# HELP tempest_parse_abandoned Parses past parse_timeout that are still running")
+	fmt.Fprintln(w, "# TYPE tempest_parse_abandoned gauge")
+	fmt.Fprintf(w, "tempest_parse_abandoned %d\n", running)
+	fmt.Fprintln(w, "# HELP tempest_parse_abandoned_dropped_total Packets dropped while too many abandoned parses were running")
+	fmt.Fprintln(w, "# TYPE tempest_parse_abandoned_dropped_total counter")
+	fmt.Fprintf(w, "tempest_parse_abandoned_dropped_total %d\n", dropped)
+}
@@ -0,0 +1,30 @@
+package processor
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLatencyHistogramsWriteTo(t *testing.T) {
+	l := newLatencyHistograms("test_seconds", "Test histogram", []float64{0.001, 0.01})
+	l.observe("obs_st", 500*time.Microsecond)
+	l.observe("obs_st", 5*time.Millisecond)
+	l.observe("obs_st", time.Second)
+
+	var out bytes.Buffer
+	l.writeTo(&out)
+
+	for _, want := range []string{
+		"# TYPE test_seconds histogram",
+		`test_seconds_bucket{report_type="obs_st",le="0.001"} 1`,
+		`test_seconds_bucket{report_type="obs_st",le="0.01"} 2`,
+		`test_seconds_bucket{report_type="obs_st",le="+Inf"} 3`,
+		`test_seconds_count{report_type="obs_st"} 3`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package processor
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Patterns for the offending lines named in a rejected write. InfluxDB 2.x
+// lists "line N:" entries, 3.x returns JSON with a line_number per error and
+// 1.x quotes the line it could not parse.
+var (
+	rejectedLineNumber = regexp.MustCompile(`(?:\bline |"line_number":\s*)(\d+)`)
+	rejectedLineText   = regexp.MustCompile(`unable to parse '([^']*)'`)
+)
+
+// rejectedLines returns the indexes of the lines that a rejection names,
+// sorted and without duplicates, or nil if it names none of them
+func rejectedLines(rejection string, lines []string) []int {
+	named := make(map[int]bool)
+	for _, match := range rejectedLineNumber.FindAllStringSubmatch(rejection, -1) {
+		// Line numbers count from 1
+		if n, err := strconv.Atoi(match[1]); err == nil && n >= 1 && n <= len(lines) {
+			named[n-1] = true
+		}
+	}
+	for _, match := range rejectedLineText.FindAllStringSubmatch(rejection, -1) {
+		for i, line := range lines {
+			if strings.TrimSuffix(line, "\n") == match[1] {
+				named[i] = true
+			}
+		}
+	}
+
+	var indexes []int
+	for i := range lines {
+		if named[i] {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// isolateRejected finds the lines of a rejected batch that InfluxDB accepts
+// and writes them, spending one of budget per extra write request. Lines the
+// rejection names are set aside directly; otherwise the batch is halved
+// until the rejected lines are found. Rejected lines, and any still mixed
+// with them when the budget runs out, are logged and dropped: they would be
+// rejected again, so spooling them would only block the spool's replay.
+func (w *InfluxHTTPWriter) isolateRejected(ctx context.Context, writeURL string, lines []string, rejection string, budget *int) {
+	if len(lines) == 1 || *budget <= 0 {
+		w.dropRejected(lines, rejection)
+		return
+	}
+
+	var parts [][]string
+	if named := rejectedLines(rejection, lines); len(named) > 0 {
+		var accepted, rejected []string
+		for i, line := range lines {
+			if len(named) > 0 && named[0] == i {
+				rejected = append(rejected, line)
+				named = named[1:]
+			} else {
+				accepted = append(accepted, line)
+			}
+		}
+		w.dropRejected(rejected, rejection)
+		if len(accepted) > 0 {
+			parts = append(parts, accepted)
+		}
+	} else {
+		half := len(lines) / 2
+		parts = append(parts, lines[:half], lines[half:])
+	}
+
+	for _, part := range parts {
+		if *budget <= 0 {
+			w.dropRejected(part, rejection)
+			continue
+		}
+		*budget--
+		if partRejection := w.write(ctx, writeURL, joinLines(part)); partRejection != "" {
+			w.isolateRejected(ctx, writeURL, part, partRejection, budget)
+		}
+	}
+}
+
+// dropRejected logs lines dropped from a rejected batch, with InfluxDB's
+// explanation
+func (w *InfluxHTTPWriter) dropRejected(lines []string, rejection string) {
+	for _, line := range lines {
+		w.logger.Error("Dropping line from a batch rejected by InfluxDB",
+			"line", strings.TrimSuffix(line, "\n"),
+			"response", rejection)
+	}
+}
@@ -0,0 +1,123 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+)
+
+func TestRejectedLines(t *testing.T) {
+	lines := []string{
+		"weather,station=ST-1 temp=1 1\n",
+		"weather,station=ST-1 temp=oops 2\n",
+		"weather,station=ST-1 temp=3 3\n",
+	}
+
+	tests := []struct {
+		name      string
+		rejection string
+		want      []int
+	}{
+		{"v2", "failed to parse line protocol:\nerrors encountered on line(s):\nline 2: invalid field value", []int{1}},
+		{"v3", `{"error":"partial write of line protocol occurred","data":[{"original_line":"x","line_number":3,"error_message":"bad"},{"line_number":2}]}`, []int{1, 2}},
+		{"v1", `partial write: unable to parse 'weather,station=ST-1 temp=oops 2': invalid number dropped=1`, []int{1}},
+		{"out of range", "line 7: invalid", nil},
+		{"no lines named", "field type conflict", nil},
+	}
+	for _, tt := range tests {
+		if got := rejectedLines(tt.rejection, lines); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected lines %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+// lineServer imitates InfluxDB 2.x, rejecting a whole write if any line has
+// a non-numeric temp and otherwise recording its lines
+type lineServer struct {
+	mu       sync.Mutex
+	named    bool // name the bad lines in the rejection
+	requests int
+	written  []string
+}
+
+func (s *lineServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	lines := strings.SplitAfter(string(body), "\n")
+	lines = lines[:len(lines)-1]
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+
+	var errs []string
+	for i, line := range lines {
+		if strings.Contains(line, "temp=oops") {
+			errs = append(errs, fmt.Sprintf("line %d: invalid field value", i+1))
+		}
+	}
+	if len(errs) > 0 {
+		message := "failed to parse line protocol"
+		if s.named {
+			message += ": errors encountered on line(s):\n" + strings.Join(errs, "\n")
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprintf(w, `{"code":"invalid","message":%q}`, message)
+		return
+	}
+	s.written = append(s.written, lines...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func TestWriteBatchIsolatesRejectedLines(t *testing.T) {
+	batch := []string{
+		"weather,station=ST-1 temp=1 1\n",
+		"weather,station=ST-1 temp=2 2\n",
+		"weather,station=ST-1 temp=oops 3\n",
+		"weather,station=ST-1 temp=4 4\n",
+	}
+	good := []string{batch[0], batch[1], batch[3]}
+
+	tests := []struct {
+		name     string
+		named    bool
+		budget   int
+		written  []string
+		requests int
+	}{
+		{"disabled", true, 0, nil, 1},
+		{"named line", true, 5, good, 2},
+		// Halves, then the rejected half's halves
+		{"split", false, 5, good, 5},
+		// Only the first half fits the budget
+		{"budget exhausted", false, 1, batch[:2], 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &lineServer{named: tt.named}
+			server := httptest.NewServer(handler)
+			defer server.Close()
+
+			service := newTestService(t, &config.Config{Influx_URL: server.URL, Batch_Retry_Budget: tt.budget})
+			writer := httpWriter(service)
+			writer.writeBatch(context.Background(), writer.writeURL("test-bucket"), batch)
+
+			handler.mu.Lock()
+			defer handler.mu.Unlock()
+			if !reflect.DeepEqual(handler.written, tt.written) {
+				t.Errorf("Expected lines %q written, got %q", tt.written, handler.written)
+			}
+			if handler.requests != tt.requests {
+				t.Errorf("Expected %d requests, got %d", tt.requests, handler.requests)
+			}
+		})
+	}
+}
@@ -1,13 +1,20 @@
 package processor
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
-	"net/url"
+	"os"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/jacaudi/tempest-influxdb/internal/config"
@@ -17,11 +24,15 @@ import (
 	"github.com/samber/lo"
 )
 
-// Buffer pool for reusing byte buffers to reduce GC pressure
-var bufferPool = sync.Pool{
-	New: func() any {
-		return make([]byte, config.DefaultBuffer)
-	},
+// newBufferPool creates a pool of size byte read buffers to reduce GC
+// pressure. Buffers are stored as *[]byte so Put does not allocate.
+func newBufferPool(size int) *sync.Pool {
+	return &sync.Pool{
+		New: func() any {
+			b := make([]byte, size)
+			return &b
+		},
+	}
 }
 
 // createOptimizedHTTPClient creates an HTTP client with optimized settings
@@ -42,8 +53,43 @@ func createOptimizedHTTPClient() *http.Client {
 	}
 }
 
-// processPacket processes a weather data packet
-func processPacket(ctx context.Context, cfg *config.Config, logger *logger.AppLogger, influxURL *url.URL, addr *net.UDPAddr, b []byte, n int) {
+// processPacket processes a weather data packet. With Multi_Message set, a
+// packet holding several newline-separated reports is processed one report
+// at a time.
+func (ws *WeatherService) processPacket(ctx context.Context, addr *net.UDPAddr, b []byte, n int) {
+	received := time.Now()
+
+	if ws.capture != nil {
+		if err := ws.capture.record(addr, b[:n], received); err != nil {
+			ws.logger.Error("Failed to capture packet", "error", err.Error())
+		}
+	}
+
+	if !ws.config.Multi_Message {
+		ws.processMessage(ctx, addr, b[:n], received)
+		return
+	}
+	for _, msg := range splitMessages(b[:n]) {
+		ws.processMessage(ctx, addr, msg, received)
+	}
+}
+
+// splitMessages splits a payload into its newline-delimited messages,
+// skipping blank lines. A payload without newlines is a single message.
+func splitMessages(payload []byte) [][]byte {
+	var messages [][]byte
+	for _, line := range bytes.Split(payload, []byte{'\n'}) {
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			messages = append(messages, line)
+		}
+	}
+	return messages
+}
+
+// processMessage processes a single report received at received
+func (ws *WeatherService) processMessage(ctx context.Context, addr *net.UDPAddr, msg []byte, received time.Time) {
+	logger := ws.logger
+
 	// Add panic recovery
 	defer func() {
 		if r := recover(); r != nil {
@@ -53,10 +99,63 @@ func processPacket(ctx context.Context, cfg *config.Config, logger *logger.AppLo
 		}
 	}()
 
-	// Use Lo library for safer error handling
-	m, ok := lo.TryOr(func() (*influx.Data, error) {
-		return tempest.Parse(cfg, addr, b, n)
-	}, nil)
+	report, err := tempest.DecodeReport(msg)
+	if err != nil {
+		ws.quarantinePacket(addr, msg, received)
+		if logger.DebugEnabled() {
+			logger.Debug("Could not decode packet",
+				"remote_addr", addr.String(),
+				"error", err.Error())
+		}
+		return
+	}
+
+	ws.processReport(ctx, addr, report, received)
+}
+
+// processReport processes a decoded report received at received, from addr
+// if it arrived over UDP
+func (ws *WeatherService) processReport(ctx context.Context, addr *net.UDPAddr, report tempest.Report, received time.Time) {
+	cfg := ws.config
+	logger := ws.logger
+
+	ws.stations.observe(report, received)
+
+	if volts, ok := report.Battery(); ok {
+		ws.stations.setBattery(report.StationSerial, volts)
+	}
+
+	if cfg.Seq_Gaps && report.ReportType == "hub_status" {
+		ws.checkHubSeq(report)
+	}
+
+	if report.ReportType == "obs_st" {
+		ws.checkObsLayout(report)
+	}
+
+	// Every rapid wind feeds the METAR windows, whether written or merged
+	if cfg.METAR_Wind && report.ReportType == "rapid_wind" && len(report.Ob) >= 3 {
+		ws.stations.addWindSample(report.StationSerial, report.Time(), report.Ob[1], metarGustWindow)
+	}
+
+	// Merged rapid wind is only cached here and written with the next obs
+	if cfg.Merge_Rapid_Wind && report.ReportType == "rapid_wind" {
+		fields, err := tempest.RapidWindFields(cfg, report)
+		if err != nil {
+			if logger.DebugEnabled() {
+				logger.Debug("Could not parse rapid wind",
+					"remote_addr", addr.String(),
+					"error", err.Error())
+			}
+			return
+		}
+		ws.stations.setRapidWind(report.StationSerial, fields)
+		return
+	}
+
+	parseStart := time.Now()
+	m, ok := ws.parse(addr, report)
+	ws.parseLatency.observe(report.ReportType, time.Since(parseStart))
 
 	if !ok || m == nil {
 		return
@@ -66,79 +165,231 @@ func processPacket(ctx context.Context, cfg *config.Config, logger *logger.AppLo
 		return
 	}
 
-	if cfg.Debug {
-		logger.Debug("Processing InfluxData",
-			"measurement", m.Name,
-			"timestamp", m.Timestamp,
-			"bucket", m.Bucket)
+	// Station timestamps are whole seconds, so rapid wind from several
+	// stations collides; receipt time orders every point uniquely
+	if cfg.Rapid_Wind_Receipt_Time && report.ReportType == "rapid_wind" {
+		m.Timestamp = received.UnixNano()
+		m.Precision = config.PrecisionNanoseconds
 	}
 
-	line := m.Marshal()
-	if cfg.Verbose {
-		logger.Info("Posting data to InfluxDB",
-			"data", line,
-			"url", influxURL.String())
+	// Alternatively a small counter tag keeps same-second points distinct
+	if cfg.Rapid_Wind_Seq && report.ReportType == "rapid_wind" {
+		m.Tags["rapid_wind_seq"] = strconv.Itoa(ws.stations.nextRapidWindSeq(report.StationSerial, report.Time()))
 	}
 
-	if m.Bucket != "" {
-		// Set query arguments, preserving existing parameters like org
-		query := influxURL.Query()
-		query.Set("bucket", m.Bucket)
-		influxURL.RawQuery = query.Encode()
+	if cfg.Merge_Rapid_Wind && report.ReportType == "obs_st" {
+		for name, value := range ws.stations.takeRapidWind(report.StationSerial) {
+			m.Fields[name] = value
+		}
 	}
 
-	// Create HTTP request with context
-	request, err := http.NewRequestWithContext(ctx, "POST", influxURL.String(), strings.NewReader(line))
-	if err != nil {
-		logger.Error("Failed to create HTTP request",
-			"error", err.Error(),
-			"url", influxURL.String())
+	// Receipt time next to the station's own clock shows skew and delay
+	if cfg.Emit_Recv_Time {
+		recvTime := float64(received.UnixNano()) / float64(time.Second)
+		m.Fields[tempest.FieldName(cfg, "recv_time")] = tempest.FormatField("recv_time", recvTime)
+	}
+
+	// Every obs feeds the strike window, including ones throttled below
+	if cfg.Strike_Rate && report.ReportType == "obs_st" {
+		rate := ws.stations.strikeRate(report.StationSerial, report.Time(), report.StrikeCount(), strikeRateWindow)
+		m.Fields[tempest.FieldName(cfg, "strike_rate_10m")] = tempest.FormatField("strike_rate_10m", float64(rate))
+	}
+
+	if cfg.METAR_Wind && report.ReportType == "obs_st" {
+		if avg, gust, ok := ws.stations.windStats(report.StationSerial, report.Time(), metarAverageWindow, metarGustWindow); ok {
+			tempest.SetMETARWindFields(cfg, m, avg, gust)
+		}
+	}
+
+	if cfg.Daily_Totals && report.ReportType == "obs_st" {
+		day := tempest.Day(time.Unix(report.Time(), 0))
+		totals, finished, ok := ws.stations.addDaily(report.StationSerial, day, tempest.ObsTotals(report))
+		if finished != nil {
+			ws.writeDailyTotals(ctx, report.StationSerial, *finished)
+		}
+		if ok {
+			tempest.SetDailyTotalsFields(cfg, m, totals)
+		} else if logger.DebugEnabled() {
+			logger.Debug("Late obs from an earlier day left out of the daily totals",
+				"station", report.StationSerial,
+				"day", day)
+		}
+	}
+
+	// A failed sensor's reading would become the day's low or high
+	if (cfg.Temp_Min_Max || cfg.GDD) && report.ReportType == "obs_st" &&
+		!(cfg.Honor_Sensor_Status && report.SensorStatus&tempest.SensorTemperatureFailed != 0) {
+		if temp, ok := report.AirTemperature(); ok {
+			day := tempest.Day(time.Unix(report.Time(), 0))
+			tempRange, finished, ok := ws.stations.addTemp(report.StationSerial, day, temp)
+			if cfg.GDD && finished != nil {
+				ws.writeGDD(ctx, report.StationSerial, *finished)
+			}
+			if ok && cfg.Temp_Min_Max {
+				tempest.SetTempRangeFields(cfg, m, tempRange)
+			}
+			if ok && cfg.GDD {
+				tempest.SetGDDField(cfg, m, tempRange)
+			}
+		}
+	}
+
+	if cfg.Precip_Debounce > 0 && report.ReportType == "evt_precip" &&
+		!ws.stations.allowPrecipEvent(report.StationSerial, report.Time(), cfg.Precip_Debounce) {
+		if logger.DebugEnabled() {
+			logger.Debug("Dropping rain start event within precip debounce",
+				"station", report.StationSerial,
+				"timestamp", report.Time())
+		}
 		return
 	}
-	request.Header.Set("Authorization", "Token "+cfg.Influx_Token)
-	request.Header.Set("Content-Type", "text/plain; charset=utf-8")
-	request.Header.Set("Accept", "application/json")
 
-	if cfg.Noop {
-		logger.Info("NOOP mode - not posting to InfluxDB",
-			"url", influxURL.String())
+	// Rapid wind is exempt since it is expected every few seconds
+	if cfg.Min_Write_Interval > 0 && report.ReportType == "obs_st" &&
+		!ws.stations.allowObsWrite(report.StationSerial, report.Time(), cfg.Min_Write_Interval) {
+		if logger.DebugEnabled() {
+			logger.Debug("Dropping obs within minimum write interval",
+				"station", report.StationSerial,
+				"timestamp", report.Time())
+		}
 		return
 	}
 
-	// Optimized HTTP client with proper transport configuration
-	client := createOptimizedHTTPClient()
+	ws.limitTags(m)
+
+	if logger.DebugEnabled() {
+		logger.Debug("Processing InfluxData",
+			"measurement", m.Name,
+			"timestamp", m.Timestamp,
+			"bucket", m.Bucket)
+	}
+
+	for _, writer := range ws.writers {
+		if err := writer.Write(ctx, m); err != nil {
+			logger.Error("Failed to write point",
+				"measurement", m.Name,
+				"error", err.Error())
+		}
+	}
+}
 
-	// Use Lo library for safer HTTP request handling
-	resp, ok := lo.TryOr(func() (*http.Response, error) {
-		return client.Do(request)
-	}, nil)
+// parseReport parses decoded reports, and can be replaced in tests
+var parseReport = tempest.ParseReport
+
+// parse parses a report, recovering from panics. With Parse_Timeout set it
+// runs in its own goroutine and is abandoned once the timeout passes, though
+// the goroutine runs on until the parse returns.
+func (ws *WeatherService) parse(addr *net.UDPAddr, report tempest.Report) (*influx.Data, bool) {
+	parse := func() (*influx.Data, bool) {
+		// Use Lo library for safer error handling
+		return lo.TryOr(func() (*influx.Data, error) {
+			return parseReport(ws.config, addr, report)
+		}, nil)
+	}
 
-	if !ok || resp == nil {
-		logger.Error("Failed to post data to InfluxDB",
-			"influx_url", cfg.Influx_URL)
-		return
+	timeout := ws.config.Parse_Timeout
+	if timeout <= 0 {
+		return parse()
 	}
 
-	defer func() { _ = resp.Body.Close() }()
+	// Abandoned parses can't be cancelled, so past the cap packets are
+	// dropped rather than piling up more goroutines
+	if ws.abandonedParses.Load() >= maxAbandonedParses {
+		ws.parseTimeoutDrops.Add(1)
+		if ws.logger.DebugEnabled() {
+			ws.logger.Debug("Dropping packet while too many abandoned parses are still running",
+				"station", report.StationSerial,
+				"report_type", report.ReportType)
+		}
+		return nil, false
+	}
 
-	if resp.StatusCode >= 400 {
-		logger.Error("InfluxDB returned error status",
-			"status", resp.Status,
-			"status_code", resp.StatusCode)
-	} else if cfg.Verbose {
-		logger.Info("Successfully posted data to InfluxDB",
-			"status", resp.Status,
-			"status_code", resp.StatusCode)
+	type result struct {
+		m  *influx.Data
+		ok bool
+	}
+	done := make(chan result, 1)
+	go func() {
+		m, ok := parse()
+		done <- result{m, ok}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.m, r.ok
+	case <-timer.C:
+		ws.abandonedParses.Add(1)
+		go func() {
+			<-done
+			ws.abandonedParses.Add(-1)
+		}()
+		ws.logger.Warn("Abandoned packet that took too long to parse",
+			"station", report.StationSerial,
+			"report_type", report.ReportType,
+			"timeout", timeout.String())
+		return nil, false
 	}
 }
 
+// maxAbandonedParses bounds the timed out parses left running, since each
+// holds a goroutine until its parse returns
+const maxAbandonedParses = 64
+
 // WeatherService manages the weather data collection service
 type WeatherService struct {
 	config   *config.Config
 	logger   *logger.AppLogger
 	listener net.PacketConn
+	writers  []Writer
+	stations *stationTracker
+	queues   []*packetQueue
+	buffers  *sync.Pool
+
+	// quarantine keeps malformed packets when Quarantine_Dir is set
+	quarantine *quarantine
+
+	// capture records every packet when Capture_Dir is set
+	capture *capture
+
+	// parseLatency is exposed on the metrics endpoint
+	parseLatency *latencyHistograms
+
+	// wg tracks in-flight packet processing goroutines and workers
+	wg sync.WaitGroup
+
+	// active counts packets being processed so the Max_Concurrent_Packets
+	// limit can be enforced and abandoned packets reported on shutdown
+	active      atomic.Int64
+	dropped     atomic.Int64
+	lastDropLog atomic.Int64
+
+	// received counts packets read, for Max_Packets
+	received atomic.Int64
+
+	// lastPacket is when the listener last received a packet, or when it
+	// was bound if none has arrived yet, in Unix nanoseconds
+	lastPacket atomic.Int64
+
+	// abandonedParses counts parses past Parse_Timeout that are still
+	// running, and parseTimeoutDrops the packets dropped while at the cap
+	abandonedParses   atomic.Int64
+	parseTimeoutDrops atomic.Int64
 }
 
+// dropLogInterval throttles the warning logged when packets are dropped
+const dropLogInterval = 10 * time.Second
+
+// strikeRateWindow is the sliding window strike_rate_10m is computed over
+const strikeRateWindow = 10 * time.Minute
+
+// METAR wind reports a 2 minute average speed and the peak over 10 minutes
+const (
+	metarAverageWindow = 2 * time.Minute
+	metarGustWindow    = 10 * time.Minute
+)
+
 // NewWeatherService creates a new WeatherService
 func NewWeatherService(cfg *config.Config, appLogger *logger.AppLogger) (*WeatherService, error) {
 	// Create UDP listener
@@ -147,77 +398,586 @@ func NewWeatherService(cfg *config.Config, appLogger *logger.AppLogger) (*Weathe
 		return nil, err
 	}
 
-	sourceConn, err := net.ListenUDP("udp", sourceAddr)
+	ws, err := newPipeline(cfg, appLogger)
 	if err != nil {
 		return nil, err
 	}
 
-	return &WeatherService{
+	if ws.listener, err = listen(cfg, appLogger, sourceAddr); err != nil {
+		return nil, err
+	}
+	ws.lastPacket.Store(time.Now().UnixNano())
+
+	if cfg.Workers > 0 {
+		ws.queues = newPacketQueues(cfg)
+	}
+
+	return ws, nil
+}
+
+// listen binds the UDP listener to addr. If addr is already in use and a
+// Fallback_Listen_Address is configured, that is bound instead.
+func listen(cfg *config.Config, appLogger *logger.AppLogger, addr *net.UDPAddr) (*net.UDPConn, error) {
+	conn, err := net.ListenUDP("udp", addr)
+	if err == nil || cfg.Fallback_Listen_Address == "" || !errors.Is(err, syscall.EADDRINUSE) {
+		return conn, err
+	}
+
+	fallbackAddr, resolveErr := net.ResolveUDPAddr("udp", cfg.Fallback_Listen_Address)
+	if resolveErr != nil {
+		return nil, fmt.Errorf("%w; resolving fallback: %v", err, resolveErr)
+	}
+	appLogger.Warn("Listen address in use, trying fallback",
+		"listen_address", cfg.Listen_Address,
+		"fallback_listen_address", cfg.Fallback_Listen_Address)
+
+	conn, fallbackErr := net.ListenUDP("udp", fallbackAddr)
+	if fallbackErr != nil {
+		return nil, fmt.Errorf("%w; fallback: %v", err, fallbackErr)
+	}
+	appLogger.Info("Listening on fallback address", "address", conn.LocalAddr().String())
+	return conn, nil
+}
+
+// newPipeline creates a WeatherService that processes and writes reports but
+// has no listener, for feeding reports from elsewhere
+func newPipeline(cfg *config.Config, appLogger *logger.AppLogger) (*WeatherService, error) {
+	// Tag_Fields and Field_Name_Map are checked here since the field list
+	// lives in tempest
+	problems := append(tempest.InvalidTagFields(cfg), tempest.CollidingFieldNames(cfg)...)
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("configuration validation failed: %s", strings.Join(problems, "; "))
+	}
+
+	// With Noop, JSON on stdout replaces InfluxDB rather than joining it
+	var writers []Writer
+	if cfg.WritesHTTP() && !(cfg.Noop && cfg.JSON_Stdout) {
+		influxWriter, err := NewInfluxHTTPWriter(cfg, appLogger)
+		if err != nil {
+			return nil, err
+		}
+		writers = append(writers, influxWriter)
+	}
+	if cfg.WritesFile() {
+		fileWriter, err := NewFileWriter(cfg.Output_File_Dir, cfg.Output_File_Retention)
+		if err != nil {
+			return nil, err
+		}
+		writers = append(writers, fileWriter)
+	}
+
+	var err error
+	var quarantine *quarantine
+	if cfg.Quarantine_Dir != "" {
+		if quarantine, err = newQuarantine(cfg.Quarantine_Dir, cfg.Quarantine_Max_Files); err != nil {
+			return nil, err
+		}
+	}
+
+	var capture *capture
+	if cfg.Capture_Dir != "" {
+		if capture, err = newCapture(cfg.Capture_Dir, cfg.Capture_Compress, cfg.Capture_Retention); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.JSON_Stdout {
+		writers = append(writers, NewJSONWriter(cfg, os.Stdout))
+	}
+	if len(cfg.Kafka_Brokers) > 0 {
+		kafkaWriter, err := NewKafkaWriter(cfg, appLogger)
+		if err != nil {
+			return nil, err
+		}
+		writers = append(writers, kafkaWriter)
+	}
+
+	ws := &WeatherService{
 		config:   cfg,
 		logger:   appLogger,
-		listener: sourceConn,
-	}, nil
+		writers:  writers,
+		stations: newStationTracker(),
+		buffers:  newBufferPool(cfg.Buffer),
+
+		quarantine:   quarantine,
+		capture:      capture,
+		parseLatency: newParseLatency(),
+	}
+
+	for _, name := range tempest.UnknownFieldNames(cfg) {
+		appLogger.Warn("Field_Name_Map renames a field that is never emitted", "field", name)
+	}
+	for _, name := range tempest.HighCardinalityTagFields(cfg) {
+		appLogger.Warn("Tag_Fields writes a high cardinality field as a tag, creating a series per value", "field", name)
+	}
+	if kept, dropped := tempest.SplitTags(cfg, tempest.ConfiguredTags(cfg)); len(dropped) > 0 {
+		appLogger.Warn("More tags configured than Max_Tags, the lowest priority ones will be dropped",
+			"max_tags", cfg.Max_Tags,
+			"kept", strings.Join(kept, ","),
+			"dropped", strings.Join(dropped, ","))
+	}
+
+	return ws, nil
+}
+
+// newParseLatency creates the parse latency histograms
+func newParseLatency() *latencyHistograms {
+	return newLatencyHistograms("tempest_parse_duration_seconds",
+		"Time taken to parse a report into a point, by report type", parseLatencyBuckets)
 }
 
 // Start starts the weather service
 func (ws *WeatherService) Start(ctx context.Context) error {
 	ws.logger.Info("Weather service started")
 
+	// Background work stops with the service, including after Max_Packets
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Packets are processed with a context that outlives ctx, so writes
+	// started before shutdown can finish while draining. It is cancelled
+	// with errDrainElapsed once the drain is over.
+	writeCtx, cancelWrites := context.WithCancelCause(context.WithoutCancel(ctx))
+	defer cancelWrites(nil)
+
 	defer func() { _ = ws.listener.Close() }()
 
-	// Parse Influx URL and append API path
-	influxURL, err := url.Parse(ws.config.Influx_URL + ws.config.Influx_API_Path)
-	if err != nil {
-		return err
+	// The debug server is auxiliary, so collection carries on without it
+	if ws.config.Metrics_Address != "" {
+		if err := ws.startDebugServer(ctx); err != nil {
+			ws.logger.Warn("Debug server disabled, could not listen on the metrics address",
+				"address", ws.config.Metrics_Address,
+				"error", err.Error())
+		}
 	}
 
-	// Set query arguments
-	query := influxURL.Query()
-	query.Set("org", ws.config.Influx_Org)
-	query.Set("precision", "s")
-	influxURL.RawQuery = query.Encode()
+	// Writers with background work, such as batching, run until shutdown
+	stopWriters := ws.runWriters()
+
+	if ws.queues != nil {
+		ws.startWorkers(writeCtx)
+	}
+
+	if ws.config.Station_Timeout > 0 {
+		go ws.watchStations(ctx, ws.config.Station_Timeout)
+	}
+
+	if ws.config.Daily_Totals || ws.config.GDD {
+		go ws.flushDailyTotals(ctx)
+	}
+
+	shutdown := func() {
+		// Let in-flight packets finish queueing before the final flush
+		for _, queue := range ws.queues {
+			queue.close()
+		}
+		ws.drain()
+		cancelWrites(errDrainElapsed)
+		stopWriters()
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
 			ws.logger.Info("Weather service shutting down")
+			shutdown()
 			return ctx.Err()
 		default:
-			// Set read timeout to allow periodic context checking
-			_ = ws.listener.SetReadDeadline(time.Now().Add(1 * time.Second))
-
-			b := make([]byte, ws.config.Buffer)
-			n, addr, err := ws.listener.ReadFrom(b)
-
-			if err != nil {
-				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-					// Timeout is expected, continue to check context
-					continue
-				}
-				udpAddr, _ := addr.(*net.UDPAddr)
-				ws.logger.Error("Could not receive UDP packet",
-					"remote_addr", udpAddr.String(),
-					"error", err.Error())
+			b, n, udpAddr, ok := ws.readPacket()
+			if !ok {
 				continue
 			}
 
-			if ws.config.Debug {
-				udpAddr, _ := addr.(*net.UDPAddr)
-				ws.logger.Debug("Received UDP packet",
-					"remote_addr", udpAddr.String(),
-					"bytes", n,
-					"data", string(b[:n]))
+			ws.dispatch(writeCtx, udpAddr, b, n)
+
+			if limit := ws.config.Max_Packets; limit > 0 && ws.received.Add(1) >= int64(limit) {
+				ws.logger.Info("Max packets received, weather service shutting down", "packets", limit)
+				shutdown()
+				return nil
 			}
+		}
+	}
+}
+
+// runWriters starts the background work of writers that have any. The
+// returned function stops it and waits for final work such as flushing
+// batches to finish.
+func (ws *WeatherService) runWriters() (stop func()) {
+	stopWriters := make(chan struct{})
+	var writersDone sync.WaitGroup
+	for _, writer := range ws.writers {
+		if r, ok := writer.(runner); ok {
+			writersDone.Add(1)
+			go func() {
+				defer writersDone.Done()
+				r.run(stopWriters)
+			}()
+		}
+	}
+
+	return func() {
+		close(stopWriters)
+		writersDone.Wait()
+	}
+}
+
+// watchStations periodically logs stations that stop reporting for longer
+// than timeout, and when they return, until ctx is cancelled
+func (ws *WeatherService) watchStations(ctx context.Context, timeout time.Duration) {
+	ticker := time.NewTicker(lo.Max([]time.Duration{timeout / 2, time.Second}))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			ws.checkStations(now, timeout)
+		}
+	}
+}
+
+// checkStations logs each station that went silent or came back since the
+// last check
+func (ws *WeatherService) checkStations(now time.Time, timeout time.Duration) {
+	silenced, returned := ws.stations.checkSilent(now, timeout)
+	for _, serial := range silenced {
+		ws.logger.Warn("Station has gone silent",
+			"station", serial,
+			"timeout", timeout.String())
+	}
+	for _, serial := range returned {
+		ws.logger.Info("Station is reporting again", "station", serial)
+	}
+}
+
+// checkObsLayout logs the obs layout a station sends the first time it is
+// seen, and again if a firmware update changes it
+func (ws *WeatherService) checkObsLayout(report tempest.Report) {
+	layout, err := tempest.DetectObsLayout(report)
+	if err != nil || !ws.stations.setObsVersion(report.StationSerial, layout.Version) {
+		return
+	}
+	ws.logger.Info("Detected station obs layout",
+		"station", report.StationSerial,
+		"version", layout.Version,
+		"fields", len(report.Obs[0]),
+		"firmware_revision", string(report.FirmwareRevision))
+}
 
-			if ws.config.Raw_UDP {
-				udpAddr, _ := addr.(*net.UDPAddr)
-				// Print raw bytes in hex format for tcpdump-like output
-				fmt.Printf("RAW UDP: %d bytes from %s: %x\n", n, udpAddr.String(), b[:n])
+// checkHubSeq counts the hub_status reports missed before report
+func (ws *WeatherService) checkHubSeq(report tempest.Report) {
+	missed, rolledOver := ws.stations.hubSeq(report.StationSerial, report.Seq, ws.config.Seq_Rollover)
+	switch {
+	case rolledOver:
+		ws.logger.Info("Hub seq restarted, assuming a reboot or rollover",
+			"hub", report.StationSerial,
+			"seq", report.Seq)
+	case missed > 0 && ws.logger.DebugEnabled():
+		ws.logger.Debug("Missed hub status reports",
+			"hub", report.StationSerial,
+			"seq", report.Seq,
+			"missed", missed)
+	}
+}
+
+// dailyRolloverCheck is how often local midnight is checked for when no
+// shorter Accumulator_Flush_Interval is configured
+const dailyRolloverCheck = time.Minute
+
+// flushDailyTotals writes each station's daily totals every
+// Accumulator_Flush_Interval, and the final totals and growing degree days
+// at local midnight, so they are recorded even when a station is silent,
+// until ctx is cancelled
+func (ws *WeatherService) flushDailyTotals(ctx context.Context) {
+	interval := ws.config.Accumulator_Flush_Interval
+	ticker := time.NewTicker(lo.Ternary(interval > 0 && interval < dailyRolloverCheck, interval, dailyRolloverCheck))
+	defer ticker.Stop()
+
+	lastFlush := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			flush := interval > 0 && now.Sub(lastFlush) >= interval
+			if flush {
+				lastFlush = now
 			}
+			ws.flushAccumulators(ctx, now, flush)
+		}
+	}
+}
 
-			// Process packet in goroutine with context
-			udpAddr, _ := addr.(*net.UDPAddr)
-			go processPacket(ctx, ws.config, ws.logger, influxURL, udpAddr, b, n)
+// flushAccumulators writes the final totals and growing degree days of
+// stations whose day ended before now, then resets them. With flush set the
+// running totals of every station are written as of now too.
+func (ws *WeatherService) flushAccumulators(ctx context.Context, now time.Time, flush bool) {
+	for serial, totals := range ws.stations.rollDaily(tempest.Day(now)) {
+		ws.writeDailyTotals(ctx, serial, totals)
+	}
+	if ws.config.GDD {
+		for serial, tempRange := range ws.stations.rollTempRanges(tempest.Day(now)) {
+			ws.writeGDD(ctx, serial, tempRange)
 		}
 	}
+
+	if !flush {
+		return
+	}
+	for serial, totals := range ws.stations.daily() {
+		ws.writeTotalsPoint(ctx, tempest.DailyTotalsPoint(ws.config, serial, now, totals))
+	}
+}
+
+// writeDailyTotals writes a finished day's totals at the last second of that day
+func (ws *WeatherService) writeDailyTotals(ctx context.Context, serial string, totals tempest.DailyTotals) {
+	end, err := tempest.DayEnd(totals.Day)
+	if err != nil {
+		ws.logger.Error("Invalid daily totals day", "day", totals.Day, "error", err.Error())
+		return
+	}
+	ws.writeTotalsPoint(ctx, tempest.DailyTotalsPoint(ws.config, serial, end, totals))
+}
+
+// writeGDD writes a finished day's growing degree days at the last second of
+// that day
+func (ws *WeatherService) writeGDD(ctx context.Context, serial string, tempRange tempest.TempRange) {
+	end, err := tempest.DayEnd(tempRange.Day)
+	if err != nil {
+		ws.logger.Error("Invalid temperature range day", "day", tempRange.Day, "error", err.Error())
+		return
+	}
+	ws.writeTotalsPoint(ctx, tempest.GDDPoint(ws.config, serial, end, tempRange))
+}
+
+// limitTags enforces Max_Tags on a point about to be written
+func (ws *WeatherService) limitTags(m *influx.Data) {
+	dropped := tempest.LimitTags(ws.config, m)
+	if len(dropped) > 0 && ws.logger.DebugEnabled() {
+		ws.logger.Debug("Dropped tags beyond Max_Tags",
+			"measurement", m.Name,
+			"tags", strings.Join(dropped, ","))
+	}
+}
+
+// writeTotalsPoint sends a daily totals point to every writer
+func (ws *WeatherService) writeTotalsPoint(ctx context.Context, m *influx.Data) {
+	ws.limitTags(m)
+	for _, writer := range ws.writers {
+		if err := writer.Write(ctx, m); err != nil {
+			ws.logger.Error("Failed to write daily totals",
+				"station", m.Tags["station"],
+				"error", err.Error())
+		}
+	}
+}
+
+// quarantinePacket saves a malformed packet when a quarantine is configured
+func (ws *WeatherService) quarantinePacket(addr *net.UDPAddr, packet []byte, received time.Time) {
+	if ws.quarantine == nil {
+		return
+	}
+	if err := ws.quarantine.save(addr, packet, received); err != nil {
+		ws.logger.Error("Failed to quarantine packet", "error", err.Error())
+	}
+}
+
+// startWorkers starts the worker pool, which runs until the queues are
+// closed. Workers share a single queue, or each has its own.
+func (ws *WeatherService) startWorkers(ctx context.Context) {
+	for i := 0; i < ws.config.Workers; i++ {
+		queue := ws.queues[i%len(ws.queues)]
+		ws.wg.Add(1)
+		go func() {
+			defer ws.wg.Done()
+			for p := range queue.packets {
+				ws.active.Add(1)
+				ws.processPacket(ctx, p.addr, p.b, p.n)
+				ws.active.Add(-1)
+			}
+		}()
+	}
+}
+
+// queueFor returns the queue a packet is pushed to. With one queue per
+// worker, a station's packets always go to the same one.
+func (ws *WeatherService) queueFor(addr *net.UDPAddr, b []byte) *packetQueue {
+	if len(ws.queues) == 1 {
+		return ws.queues[0]
+	}
+	return ws.queues[queueIndex(routingKey(addr, b), len(ws.queues))]
+}
+
+// dispatch hands a packet to the worker queue, or when there is no worker
+// pool processes it in its own goroutine, dropping it instead if
+// Max_Concurrent_Packets goroutines are already running. It reports whether
+// the packet was accepted.
+//
+// Processing outlives the read loop iteration, so b must be exclusively owned
+// by the packet and never reused for a later read; readPacket guarantees this
+// by returning a copy of exactly the bytes received.
+func (ws *WeatherService) dispatch(ctx context.Context, udpAddr *net.UDPAddr, b []byte, n int) bool {
+	if ws.queues != nil {
+		queue := ws.queueFor(udpAddr, b[:n])
+		dropped := queue.push(packet{addr: udpAddr, b: b, n: n})
+		for i := 0; i < dropped; i++ {
+			ws.recordDrop()
+		}
+		// With drop-newest the incoming packet is the one discarded
+		return dropped == 0 || queue.dropOldest
+	}
+
+	limit := int64(ws.config.Max_Concurrent_Packets)
+	if active := ws.active.Add(1); limit > 0 && active > limit {
+		ws.active.Add(-1)
+		ws.recordDrop()
+		return false
+	}
+
+	// Process packet in goroutine with context
+	ws.wg.Add(1)
+	go func() {
+		defer ws.wg.Done()
+		defer ws.active.Add(-1)
+		ws.processPacket(ctx, udpAddr, b, n)
+	}()
+	return true
+}
+
+// errDrainElapsed is the cause of cancelling writes still in flight once
+// shutdown has finished draining, as opposed to any other cancellation
+var errDrainElapsed = errors.New("shutdown drain window elapsed")
+
+// drain waits for in-flight packets to finish, giving up after
+// Shutdown_Timeout so a hung write cannot block shutdown indefinitely. It
+// returns how many packets were abandoned.
+func (ws *WeatherService) drain() int64 {
+	done := make(chan struct{})
+	go func() {
+		ws.wg.Wait()
+		close(done)
+	}()
+
+	timeout := ws.config.Shutdown_Timeout
+	if timeout <= 0 {
+		<-done
+		return 0
+	}
+
+	select {
+	case <-done:
+		return 0
+	case <-time.After(timeout):
+		abandoned := ws.active.Load()
+		for _, queue := range ws.queues {
+			abandoned += int64(len(queue.packets))
+		}
+		ws.logger.Warn("Shutdown timeout reached, abandoning in-flight packets",
+			"shutdown_timeout", timeout.String(),
+			"abandoned", abandoned)
+		return abandoned
+	}
+}
+
+// recordDrop counts a dropped packet, logging at most once per dropLogInterval
+func (ws *WeatherService) recordDrop() {
+	dropped := ws.dropped.Add(1)
+
+	now := time.Now().UnixNano()
+	last := ws.lastDropLog.Load()
+	if now-last < int64(dropLogInterval) || !ws.lastDropLog.CompareAndSwap(last, now) {
+		return
+	}
+
+	ws.logger.Warn("Dropping packets, processing cannot keep up",
+		"max_concurrent_packets", ws.config.Max_Concurrent_Packets,
+		"workers", ws.config.Workers,
+		"dropped_total", dropped)
+}
+
+// readPacket waits briefly for a UDP packet. It returns ok=false on timeout
+// or receive error so the caller can periodically check its context.
+//
+// The read itself goes into a pooled Buffer sized buffer, which is returned to
+// the pool before readPacket returns. The caller owns b, which holds only the
+// packet, so it can be handed to a processing goroutine that outlives the
+// next read.
+func (ws *WeatherService) readPacket() (b []byte, n int, udpAddr *net.UDPAddr, ok bool) {
+	// Set read timeout to allow periodic context checking
+	_ = ws.listener.SetReadDeadline(time.Now().Add(1 * time.Second))
+
+	buf := ws.buffers.Get().(*[]byte)
+	defer ws.buffers.Put(buf)
+
+	n, addr, err := ws.listener.ReadFrom(*buf)
+	udpAddr, _ = addr.(*net.UDPAddr)
+
+	if err != nil {
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			// Timeout is expected, continue to check context
+			return nil, 0, nil, false
+		}
+		ws.logger.Error("Could not receive UDP packet",
+			"remote_addr", udpAddr.String(),
+			"error", err.Error())
+		return nil, 0, nil, false
+	}
+	ws.lastPacket.Store(time.Now().UnixNano())
+
+	// The pooled buffer is reused by the next read, so keep only the packet
+	b = make([]byte, n)
+	copy(b, (*buf)[:n])
+
+	if ws.logger.DebugEnabled() {
+		ws.logger.Debug("Received UDP packet",
+			"remote_addr", udpAddr.String(),
+			"bytes", n,
+			"data", string(b[:n]))
+	}
+
+	if ws.config.Raw_UDP {
+		// Print raw bytes in hex format for tcpdump-like output
+		fmt.Printf("RAW UDP: %d bytes from %s: %x\n", n, udpAddr.String(), b[:n])
+	}
+
+	if ws.config.Inbound_Gzip {
+		inflated, err := inflatePacket(b, ws.config.Buffer)
+		if err != nil {
+			ws.logger.Error("Could not decompress UDP packet",
+				"remote_addr", udpAddr.String(),
+				"error", err.Error())
+			return nil, 0, nil, false
+		}
+		b, n = inflated, len(inflated)
+	}
+
+	return b, n, udpAddr, true
+}
+
+// gzipMagic starts every gzip stream
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// inflatePacket decompresses a gzipped packet, returning packets without the
+// gzip magic bytes unchanged so relayed and direct broadcasts can be mixed.
+// The result is limited to max bytes, the same as an uncompressed packet.
+func inflatePacket(b []byte, max int) ([]byte, error) {
+	if !bytes.HasPrefix(b, gzipMagic) {
+		return b, nil
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = zr.Close() }()
+
+	inflated, err := io.ReadAll(io.LimitReader(zr, int64(max)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(inflated) > max {
+		return nil, fmt.Errorf("decompressed packet exceeds %d bytes", max)
+	}
+	return inflated, nil
 }
@@ -1,14 +1,27 @@
 package processor
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/jacaudi/tempest-influxdb/internal/config"
+	"github.com/jacaudi/tempest-influxdb/internal/influx"
 	"github.com/jacaudi/tempest-influxdb/internal/logger"
+	"github.com/jacaudi/tempest-influxdb/internal/tempest"
 )
 
 func TestCreateOptimizedHTTPClient(t *testing.T) {
@@ -97,6 +110,32 @@ func TestNewWeatherServiceInvalidAddress(t *testing.T) {
 	}
 }
 
+func TestNewPipelineInvalidTagFields(t *testing.T) {
+	cfg := &config.Config{
+		Influx_URL: "http://localhost:8086",
+		Buffer:     1024,
+		Tag_Fields: []string{"wind_cardinal", "conditions"},
+	}
+
+	_, err := newPipeline(cfg, logger.New(&config.Config{}))
+	if err == nil || !strings.Contains(err.Error(), "conditions") {
+		t.Errorf("Expected free text tag fields to be rejected, got %v", err)
+	}
+}
+
+func TestNewPipelineCollidingFieldNames(t *testing.T) {
+	cfg := &config.Config{
+		Influx_URL:     "http://localhost:8086",
+		Buffer:         1024,
+		Field_Name_Map: map[string]string{"p": "temp"},
+	}
+
+	_, err := newPipeline(cfg, logger.New(&config.Config{}))
+	if err == nil || !strings.Contains(err.Error(), "p to temp") {
+		t.Errorf("Expected a rename onto an emitted field to be rejected, got %v", err)
+	}
+}
+
 func TestProcessPacketValidData(t *testing.T) {
 	// Create test HTTP server
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -208,25 +247,37 @@ func TestWeatherServiceContextCancellation(t *testing.T) {
 }
 
 func TestBufferPool(t *testing.T) {
-	// Test that buffer pool works correctly
-	buf1 := bufferPool.Get().([]byte)
-	if len(buf1) != config.DefaultBuffer {
-		t.Errorf("Expected buffer length %d, got %d", config.DefaultBuffer, len(buf1))
+	pool := newBufferPool(config.DefaultBuffer)
+
+	buf1 := pool.Get().(*[]byte)
+	if len(*buf1) != config.DefaultBuffer {
+		t.Errorf("Expected buffer length %d, got %d", config.DefaultBuffer, len(*buf1))
+	}
+	pool.Put(buf1)
+
+	buf2 := pool.Get().(*[]byte)
+	if len(*buf2) != config.DefaultBuffer {
+		t.Errorf("Expected buffer length %d, got %d", config.DefaultBuffer, len(*buf2))
 	}
+}
 
-	// Put it back (use pointer to slice header to avoid SA6002)
-	bufferPool.Put(&buf1)
+func TestBufferPoolMatchesConfiguredBuffer(t *testing.T) {
+	cfg := &config.Config{
+		Listen_Address: ":0",
+		Influx_URL:     "http://localhost:8086",
+		Influx_Bucket:  "test-bucket",
+		Buffer:         4096,
+	}
 
-	// Get another buffer
-	buf2 := bufferPool.Get()
-	var buf2Slice []byte
-	if ptr, ok := buf2.(*[]byte); ok {
-		buf2Slice = *ptr
-	} else {
-		buf2Slice = buf2.([]byte)
+	service, err := NewWeatherService(cfg, logger.New(&config.Config{}))
+	if err != nil {
+		t.Fatalf("NewWeatherService() error = %v", err)
 	}
-	if len(buf2Slice) != config.DefaultBuffer {
-		t.Errorf("Expected buffer length %d, got %d", config.DefaultBuffer, len(buf2Slice))
+	defer func() { _ = service.listener.Close() }()
+
+	buf := service.buffers.Get().(*[]byte)
+	if len(*buf) != cfg.Buffer {
+		t.Errorf("Expected pooled buffer length %d, got %d", cfg.Buffer, len(*buf))
 	}
 }
 
@@ -239,9 +290,1466 @@ func BenchmarkCreateOptimizedHTTPClient(b *testing.B) {
 }
 
 func BenchmarkBufferPoolGetPut(b *testing.B) {
+	pool := newBufferPool(config.DefaultBuffer)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf := pool.Get().(*[]byte)
+		pool.Put(buf)
+	}
+}
+
+// fixedPacketConn is a net.PacketConn that returns the same payload on every read
+type fixedPacketConn struct {
+	net.PacketConn
+	payload []byte
+	addr    *net.UDPAddr
+}
+
+func (c *fixedPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	return copy(b, c.payload), c.addr, nil
+}
+
+func (c *fixedPacketConn) SetReadDeadline(time.Time) error {
+	return nil
+}
+
+// BenchmarkReadPacket measures allocations per read with the pooled buffer,
+// which only allocates the packet sized copy handed to processing
+func BenchmarkReadPacket(b *testing.B) {
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	service := &WeatherService{
+		config:   &config.Config{Buffer: config.DefaultBuffer},
+		logger:   logger.New(&config.Config{}),
+		listener: &fixedPacketConn{payload: []byte(testObsPacket), addr: addr},
+		buffers:  newBufferPool(config.DefaultBuffer),
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, _, ok := service.readPacket(); !ok {
+			b.Fatal("readPacket() failed")
+		}
+	}
+}
+
+// BenchmarkReadPacketUnpooled is the previous behaviour of allocating a full
+// Buffer sized slice for every read, for comparison with BenchmarkReadPacket
+func BenchmarkReadPacketUnpooled(b *testing.B) {
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	var conn net.PacketConn = &fixedPacketConn{payload: []byte(testObsPacket), addr: addr}
+
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		buf := bufferPool.Get().([]byte)
-		bufferPool.Put(&buf)
+		buf := make([]byte, config.DefaultBuffer)
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			b.Fatal(err)
+		}
+		// The buffer is handed to a processing goroutine, so it escapes
+		readSink = buf[:n]
+	}
+}
+
+var readSink []byte
+
+func TestReadPacketInboundGzip(t *testing.T) {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err := zw.Write([]byte(testObsPacket)); err != nil {
+		t.Fatalf("Failed to gzip packet: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to gzip packet: %v", err)
+	}
+
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	tests := []struct {
+		name    string
+		payload []byte
+	}{
+		{"gzipped", compressed.Bytes()},
+		{"uncompressed fallback", []byte(testObsPacket)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &WeatherService{
+				config:   &config.Config{Buffer: config.DefaultBuffer, Inbound_Gzip: true, Dew_Point: true},
+				logger:   logger.New(&config.Config{}),
+				listener: &fixedPacketConn{payload: tt.payload, addr: addr},
+				buffers:  newBufferPool(config.DefaultBuffer),
+			}
+
+			b, n, _, ok := service.readPacket()
+			if !ok {
+				t.Fatal("readPacket() failed")
+			}
+
+			m, err := tempest.Parse(service.config, addr, b, n)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if m.Fields["temp"] != "25.50" {
+				t.Errorf("Expected temp=25.50, got %s", m.Fields["temp"])
+			}
+		})
+	}
+}
+
+func TestInflatePacketTooLarge(t *testing.T) {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, _ = zw.Write(make([]byte, 4096))
+	_ = zw.Close()
+
+	if _, err := inflatePacket(compressed.Bytes(), 1024); err == nil {
+		t.Error("Expected error for packet decompressing beyond the buffer size")
+	}
+}
+
+const testObsPacket = `{"serial_number": "ST-123456", "type": "obs_st", "obs": [[1640995200, 1.5, 2.3, 3.8, 180, 3, 1013.25, 25.5, 65.0, 50000, 5.2, 800, 0.5, 0, 5, 2, 3.7, 1]]}`
+
+// sendPacket sends a UDP packet to the service listener
+func sendPacket(t *testing.T, service *WeatherService, payload string) {
+	t.Helper()
+
+	conn, err := net.Dial("udp", service.listener.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial listener: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	if _, err := conn.Write([]byte(payload)); err != nil {
+		t.Fatalf("Failed to send packet: %v", err)
+	}
+}
+
+func TestStartKeepsBackToBackPacketsDistinct(t *testing.T) {
+	const packets = 50
+
+	var mu sync.Mutex
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		Listen_Address: "127.0.0.1:0",
+		Influx_URL:     server.URL,
+		Influx_Token:   "test-token",
+		Influx_Bucket:  "test-bucket",
+		Buffer:         1024,
+	}
+
+	service, err := NewWeatherService(cfg, logger.New(&config.Config{}))
+	if err != nil {
+		t.Fatalf("NewWeatherService() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- service.Start(ctx)
+	}()
+
+	// Serials of varying length so a reused buffer would leave stale bytes
+	want := make(map[string]bool, packets)
+	for i := 0; i < packets; i++ {
+		serial := fmt.Sprintf("ST-%s%03d", strings.Repeat("X", i%7), i)
+		want[serial] = true
+		sendPacket(t, service, strings.Replace(testObsPacket, "ST-123456", serial, 1))
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		received := len(bodies)
+		mu.Unlock()
+		if received >= packets {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d writes, got %d", packets, received)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	<-errChan
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, body := range bodies {
+		serial := ""
+		for _, tag := range strings.Split(strings.Fields(body)[0], ",") {
+			if value, ok := strings.CutPrefix(tag, "station="); ok {
+				serial = value
+			}
+		}
+		if !want[serial] {
+			t.Errorf("Unexpected or duplicate station %q in %q", serial, body)
+		}
+		delete(want, serial)
+	}
+}
+
+func TestStartStopsAfterMaxPackets(t *testing.T) {
+	cfg := &config.Config{
+		Listen_Address: "127.0.0.1:0",
+		Influx_URL:     "http://localhost:8086",
+		Influx_Bucket:  "test-bucket",
+		Buffer:         1024,
+		Max_Packets:    3,
+	}
+
+	service, err := NewWeatherService(cfg, logger.New(&config.Config{}))
+	if err != nil {
+		t.Fatalf("NewWeatherService() error = %v", err)
+	}
+	recorder := &recordingWriter{}
+	service.writers = []Writer{recorder}
+
+	// Packets beyond the limit are left unread
+	for i := 0; i < 5; i++ {
+		sendPacket(t, service, strings.Replace(testObsPacket, "ST-123456", fmt.Sprintf("ST-%d", i), 1))
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- service.Start(context.Background())
+	}()
+
+	select {
+	case err := <-errChan:
+		if err != nil {
+			t.Errorf("Expected a clean shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the service to stop after 3 packets")
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if len(recorder.points) != 3 {
+		t.Errorf("Expected exactly 3 points written, got %d", len(recorder.points))
+	}
+}
+
+func TestStartFlushesBatchOnShutdown(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		Listen_Address: "127.0.0.1:0",
+		Influx_URL:     server.URL,
+		Influx_Token:   "test-token",
+		Influx_Bucket:  "test-bucket",
+		Buffer:         1024,
+		Batch_Size:     100,
+		Batch_Interval: time.Hour,
+	}
+
+	service, err := NewWeatherService(cfg, logger.New(&config.Config{}))
+	if err != nil {
+		t.Fatalf("NewWeatherService() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- service.Start(ctx)
+	}()
+
+	sendPacket(t, service, testObsPacket)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for httpWriter(service).batcher.len() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Packet was never queued")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-errChan:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Service did not stop within timeout")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 1 || !strings.Contains(bodies[0], "station=ST-123456") {
+		t.Errorf("Expected queued line to be written before Start returned, got %v", bodies)
+	}
+}
+
+func TestStartCompletesInFlightWriteOnShutdown(t *testing.T) {
+	started := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		Listen_Address:   "127.0.0.1:0",
+		Influx_URL:       server.URL,
+		Influx_Token:     "test-token",
+		Influx_Bucket:    "test-bucket",
+		Buffer:           1024,
+		Shutdown_Timeout: 5 * time.Second,
+	}
+	service, err := NewWeatherService(cfg, logger.New(&config.Config{}))
+	if err != nil {
+		t.Fatalf("NewWeatherService() error = %v", err)
+	}
+	var delivered, failed atomic.Int32
+	httpWriter(service).client.Transport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			failed.Add(1)
+		} else {
+			delivered.Add(1)
+		}
+		return resp, err
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- service.Start(ctx)
+	}()
+
+	sendPacket(t, service, testObsPacket)
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Write was never started")
+	}
+
+	// Shut down while the write is in flight
+	cancel()
+	select {
+	case <-errChan:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Service did not stop within timeout")
+	}
+
+	if delivered.Load() != 1 || failed.Load() != 0 {
+		t.Errorf("Expected the in-flight write to complete during the drain, delivered %d, failed %d", delivered.Load(), failed.Load())
+	}
+}
+
+// newTestService creates a WeatherService without a listener for exercising
+// the write path directly
+func newTestService(t *testing.T, cfg *config.Config) *WeatherService {
+	t.Helper()
+
+	influxURL, err := buildInfluxURL(cfg)
+	if err != nil {
+		t.Fatalf("buildInfluxURL() error = %v", err)
+	}
+
+	appLogger := logger.New(&config.Config{})
+	return &WeatherService{
+		config: cfg,
+		logger: appLogger,
+		writers: []Writer{&InfluxHTTPWriter{
+			config:    cfg,
+			logger:    appLogger,
+			client:    createOptimizedHTTPClient(),
+			influxURL: influxURL,
+		}},
+		stations: newStationTracker(),
+		buffers:  newBufferPool(config.DefaultBuffer),
+
+		parseLatency: newParseLatency(),
+	}
+}
+
+// httpWriter returns the service's InfluxHTTPWriter
+func httpWriter(service *WeatherService) *InfluxHTTPWriter {
+	for _, writer := range service.writers {
+		if w, ok := writer.(*InfluxHTTPWriter); ok {
+			return w
+		}
+	}
+	return nil
+}
+
+func TestWriteRetryIsByteIdentical(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		attempt := len(bodies)
+		mu.Unlock()
+
+		// Fail the first attempt as if the response was lost
+		if attempt == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	service := newTestService(t, &config.Config{
+		Influx_URL:    server.URL,
+		Influx_Token:  "test-token",
+		Write_Retries: 2,
+		Retry_Backoff: time.Millisecond,
+	})
+
+	m, err := tempest.Parse(service.config, nil, []byte(testObsPacket), len(testObsPacket))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	writer := httpWriter(service)
+	writer.write(context.Background(), writer.writeURL("test-bucket"), m.Marshal())
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 2 {
+		t.Fatalf("Expected 2 attempts, got %d", len(bodies))
+	}
+	if bodies[0] != bodies[1] {
+		t.Errorf("Retried write differs from original:\n%q\n%q", bodies[0], bodies[1])
+	}
+}
+
+func TestWriteDoesNotRetryClientErrors(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	service := newTestService(t, &config.Config{
+		Influx_URL:    server.URL,
+		Write_Retries: 3,
+		Retry_Backoff: time.Millisecond,
+	})
+
+	writer := httpWriter(service)
+	writer.write(context.Background(), writer.writeURL("test-bucket"), "weather,station=ST-1 temp=1 1\n")
+
+	if got := atomic.LoadInt32(&attempts); got != 1 {
+		t.Errorf("Expected 1 attempt for a 400 response, got %d", got)
+	}
+}
+
+func TestWriteIdempotencyKey(t *testing.T) {
+	var mu sync.Mutex
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	service := newTestService(t, &config.Config{
+		Influx_URL:      server.URL,
+		Idempotency_Key: true,
+	})
+
+	writer := httpWriter(service)
+	writeURL := writer.writeURL("test-bucket")
+	writer.write(context.Background(), writeURL, "weather,station=ST-1 temp=1 1\n")
+	writer.write(context.Background(), writeURL, "weather,station=ST-1 temp=1 1\n")
+	writer.write(context.Background(), writeURL, "weather,station=ST-1 temp=1 2\n")
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(keys) != 3 {
+		t.Fatalf("Expected 3 writes, got %d", len(keys))
+	}
+	if keys[0] == "" {
+		t.Fatal("Expected Idempotency-Key header to be set")
+	}
+	if keys[0] != keys[1] {
+		t.Errorf("Expected identical points to share a key, got %s and %s", keys[0], keys[1])
+	}
+	if keys[0] == keys[2] {
+		t.Errorf("Expected different points to have different keys, both got %s", keys[0])
+	}
+}
+
+func TestWriteContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		want        string
+	}{
+		{"default", "", config.DefaultContentType},
+		{"configured", "application/vnd.influxdb.v2.line-protocol", "application/vnd.influxdb.v2.line-protocol"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got atomic.Value
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got.Store(r.Header.Get("Content-Type"))
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer server.Close()
+
+			service := newTestService(t, &config.Config{
+				Influx_URL:   server.URL,
+				Content_Type: tt.contentType,
+			})
+			writer := httpWriter(service)
+			writer.write(context.Background(), writer.writeURL("test-bucket"), "weather,station=ST-1 temp=1 1\n")
+
+			if got.Load() != tt.want {
+				t.Errorf("Expected Content-Type %q, got %v", tt.want, got.Load())
+			}
+		})
+	}
+}
+
+func TestWriteVictoriaMetrics(t *testing.T) {
+	var got atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.Store(r.Clone(context.Background()))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	service := newTestService(t, &config.Config{
+		Influx_URL:      server.URL,
+		Influx_API_Path: config.DefaultInfluxAPIPath,
+		Influx_Org:      "ignored-org",
+		Influx_Token:    "vm-token",
+		Output_Backend:  config.BackendVictoriaMetrics,
+	})
+	writer := httpWriter(service)
+	writer.write(context.Background(), writer.writeURL("weather"), "weather,station=ST-1 temp=1 1\n")
+
+	r, _ := got.Load().(*http.Request)
+	if r == nil {
+		t.Fatal("Expected a write request")
+	}
+	if r.URL.Path != config.DefaultVictoriaMetricsAPIPath {
+		t.Errorf("Expected path %s, got %s", config.DefaultVictoriaMetricsAPIPath, r.URL.Path)
+	}
+	if auth := r.Header.Get("Authorization"); auth != "Bearer vm-token" {
+		t.Errorf("Expected bearer authorization, got %q", auth)
+	}
+	query := r.URL.Query()
+	if query.Has("org") || query.Has("bucket") {
+		t.Errorf("Expected no org or bucket query arguments, got %s", r.URL.RawQuery)
+	}
+	if query.Get("db") != "weather" || query.Get("precision") != "s" {
+		t.Errorf("Expected db=weather and precision=s, got %s", r.URL.RawQuery)
+	}
+}
+
+func TestWriteInfluxV3(t *testing.T) {
+	var got atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.Store(r.Clone(context.Background()))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	service := newTestService(t, &config.Config{
+		Influx_URL:      server.URL,
+		Influx_API_Path: config.DefaultInfluxAPIPath,
+		Influx_Org:      "ignored-org",
+		Influx_Token:    "v3-token",
+		Influx_Version:  config.InfluxV3,
+		Precision:       config.PrecisionMilliseconds,
+	})
+	writer := httpWriter(service)
+	m := influx.New()
+	m.Name = "weather"
+	m.Bucket = "weather"
+	m.Org = "other-org"
+	m.Precision = config.PrecisionSeconds
+	m.Tags["station"] = "ST-1"
+	m.Fields["temp"] = "1"
+	m.Timestamp = 1
+	writer.write(context.Background(), writer.pointURL(m), m.Marshal())
+
+	r, _ := got.Load().(*http.Request)
+	if r == nil {
+		t.Fatal("Expected a write request")
+	}
+	if r.URL.Path != config.DefaultInfluxV3APIPath {
+		t.Errorf("Expected path %s, got %s", config.DefaultInfluxV3APIPath, r.URL.Path)
+	}
+	if auth := r.Header.Get("Authorization"); auth != "Bearer v3-token" {
+		t.Errorf("Expected bearer authorization, got %q", auth)
+	}
+	query := r.URL.Query()
+	if query.Has("org") || query.Has("bucket") {
+		t.Errorf("Expected no org or bucket query arguments, got %s", r.URL.RawQuery)
+	}
+	if query.Get("db") != "weather" || query.Get("precision") != "second" {
+		t.Errorf("Expected db=weather and precision=second, got %s", r.URL.RawQuery)
+	}
+
+	u, err := buildInfluxURL(service.config)
+	if err != nil {
+		t.Fatalf("buildInfluxURL() error = %v", err)
+	}
+	if precision := u.Query().Get("precision"); precision != "millisecond" {
+		t.Errorf("Expected the configured precision spelled out, got %s", precision)
+	}
+}
+
+func TestBuildInfluxURLPrecision(t *testing.T) {
+	tests := []struct {
+		precision string
+		want      string
+	}{
+		{"", "s"},
+		{config.PrecisionMilliseconds, "ms"},
+	}
+
+	for _, tt := range tests {
+		u, err := buildInfluxURL(&config.Config{Influx_URL: "http://localhost:8086", Precision: tt.precision})
+		if err != nil {
+			t.Fatalf("buildInfluxURL() error = %v", err)
+		}
+		if got := u.Query().Get("precision"); got != tt.want {
+			t.Errorf("Expected precision=%s, got %s", tt.want, got)
+		}
+	}
+}
+
+func TestBuildInfluxURLSlashes(t *testing.T) {
+	for _, base := range []string{"http://localhost:8086", "http://localhost:8086/"} {
+		u, err := buildInfluxURL(&config.Config{Influx_URL: base, Influx_API_Path: config.DefaultInfluxAPIPath})
+		if err != nil {
+			t.Fatalf("buildInfluxURL() error = %v", err)
+		}
+		if u.Path != "/api/v2/write" {
+			t.Errorf("Expected path /api/v2/write for %s, got %s", base, u.Path)
+		}
+	}
+}
+
+func TestWriteOmitsBlankOrg(t *testing.T) {
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	service := newTestService(t, &config.Config{
+		Influx_URL:     server.URL,
+		Influx_Version: config.InfluxV1,
+	})
+
+	writer := httpWriter(service)
+	writer.write(context.Background(), writer.writeURL("test-bucket"), "weather,station=ST-1 temp=1 1\n")
+
+	if _, ok := query["org"]; ok {
+		t.Errorf("Expected no org parameter, got %q", query.Get("org"))
+	}
+	if query.Get("bucket") != "test-bucket" {
+		t.Errorf("Expected bucket=test-bucket, got %q", query.Get("bucket"))
+	}
+}
+
+func TestWriteRoutesOrgPerReportType(t *testing.T) {
+	var mu sync.Mutex
+	routes := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		routes[r.URL.Query().Get("bucket")] = r.URL.Query().Get("org")
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	service := newTestService(t, &config.Config{
+		Influx_URL:     server.URL,
+		Influx_Org:     "users",
+		Influx_Bucket:  "weather",
+		Influx_Buckets: map[string]string{"hub_status": "status"},
+		Influx_Orgs:    map[string]string{"hub_status": "ops"},
+		Hub_Status:     true,
+	})
+
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	hubStatus := `{"serial_number": "HB-1", "type": "hub_status", "uptime": 1670133, "rssi": -62, "timestamp": 1640995200, "seq": 48}`
+	for _, packet := range []string{testObsPacket, hubStatus} {
+		service.processPacket(context.Background(), addr, []byte(packet), len(packet))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := map[string]string{"weather": "users", "status": "ops"}
+	for bucket, org := range want {
+		if routes[bucket] != org {
+			t.Errorf("Expected bucket %s written to org %s, got %q", bucket, org, routes[bucket])
+		}
+	}
+}
+
+func TestDispatchCapsConcurrentPackets(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	service := newTestService(t, &config.Config{
+		Influx_URL:             server.URL,
+		Influx_Bucket:          "test-bucket",
+		Max_Concurrent_Packets: 2,
+	})
+
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	accepted := 0
+	for i := 0; i < 10; i++ {
+		if service.dispatch(context.Background(), addr, []byte(testObsPacket), len(testObsPacket)) {
+			accepted++
+		}
+		if active := service.active.Load(); active > 2 {
+			t.Errorf("Active packets %d exceeded the limit", active)
+		}
+	}
+
+	close(release)
+	service.wg.Wait()
+
+	if accepted != 2 {
+		t.Errorf("Expected 2 accepted packets, got %d", accepted)
+	}
+	if dropped := service.dropped.Load(); dropped != 8 {
+		t.Errorf("Expected 8 dropped packets, got %d", dropped)
+	}
+	if active := service.active.Load(); active != 0 {
+		t.Errorf("Expected no active packets after draining, got %d", active)
+	}
+}
+
+// roundTripFunc adapts a function to http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestProcessPacketMergeRapidWind(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	service := newTestService(t, &config.Config{
+		Influx_URL:       server.URL,
+		Influx_Bucket:    "test-bucket",
+		Merge_Rapid_Wind: true,
+	})
+
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	for _, payload := range []string{
+		`{"serial_number": "ST-123456", "type": "rapid_wind", "ob": [1640995190, 4.0, 90]}`,
+		`{"serial_number": "ST-123456", "type": "rapid_wind", "ob": [1640995195, 5.5, 270]}`,
+		testObsPacket,
+	} {
+		service.processPacket(context.Background(), addr, []byte(payload), len(payload))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 1 {
+		t.Fatalf("Expected only the obs point to be written, got %d writes: %v", len(bodies), bodies)
+	}
+	for _, want := range []string{"rapid_wind_speed=5.50", "rapid_wind_direction=270", "temp=25.50"} {
+		if !strings.Contains(bodies[0], want) {
+			t.Errorf("Expected merged point to contain %s, got %s", want, bodies[0])
+		}
+	}
+}
+
+func TestProcessPacketPrecipDebounce(t *testing.T) {
+	recorder := &recordingWriter{}
+	service := newTestService(t, &config.Config{
+		Influx_Bucket:   "test-bucket",
+		Precip_Events:   true,
+		Precip_Debounce: 10 * time.Minute,
+	})
+	service.writers = []Writer{recorder}
+
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	event := func(serial string, timestamp int64) {
+		packet := fmt.Sprintf(`{"serial_number": %q, "type": "evt_precip", "evt": [%d]}`, serial, timestamp)
+		service.processPacket(context.Background(), addr, []byte(packet), len(packet))
+	}
+
+	// Drizzle starting and stopping every few minutes is one event
+	event("ST-1", 1640995200)
+	event("ST-1", 1640995200+240)
+	event("ST-1", 1640995200+480)
+	if len(recorder.points) != 1 || recorder.points[0].Timestamp != 1640995200 {
+		t.Fatalf("Expected only the first of 3 events within the debounce, got %d points", len(recorder.points))
+	}
+
+	// Other stations and rain after a dry spell are written
+	event("ST-2", 1640995200+500)
+	event("ST-1", 1640995200+480+600)
+	if len(recorder.points) != 3 {
+		t.Errorf("Expected 3 points, got %d", len(recorder.points))
+	}
+	if got := service.stations.snapshot()["ST-1"].PrecipDebounced; got != 2 {
+		t.Errorf("Expected 2 debounced events, got %d", got)
+	}
+}
+
+func TestProcessPacketMaxTags(t *testing.T) {
+	recorder := &recordingWriter{}
+	service := newTestService(t, &config.Config{
+		Influx_Bucket:  "test-bucket",
+		Collector_ID:   "garage",
+		Schema_Tag:     "v2",
+		Emit_Source_IP: true,
+		Max_Tags:       1,
+		Tag_Priority:   []string{"schema"},
+	})
+	service.writers = []Writer{recorder}
+
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	service.processPacket(context.Background(), addr, []byte(testObsPacket), len(testObsPacket))
+
+	if len(recorder.points) != 1 {
+		t.Fatalf("Expected 1 point, got %d", len(recorder.points))
+	}
+	want := map[string]string{"station": "ST-123456", "schema": "v2"}
+	if tags := recorder.points[0].Tags; !reflect.DeepEqual(tags, want) {
+		t.Errorf("Expected the station and the highest priority tag %v, got %v", want, tags)
+	}
+}
+
+func TestProcessPacketMETARWind(t *testing.T) {
+	recorder := &recordingWriter{}
+	service := newTestService(t, &config.Config{
+		Influx_Bucket: "test-bucket",
+		Rapid_Wind:    true,
+		METAR_Wind:    true,
+	})
+	service.writers = []Writer{recorder}
+
+	// A 9 m/s gust 5 minutes before the obs, then 2 minutes of rapid wind
+	// every 3 seconds alternating 3 and 5 m/s
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	obsTime := int64(1640995200)
+	wind := func(timestamp int64, speed float64) {
+		packet := fmt.Sprintf(`{"serial_number": "ST-123456", "type": "rapid_wind", "ob": [%d, %.1f, 180]}`, timestamp, speed)
+		service.processPacket(context.Background(), addr, []byte(packet), len(packet))
+	}
+	wind(obsTime-300, 9)
+	for i := int64(0); i < 40; i++ {
+		wind(obsTime-117+i*3, 3+2*float64(i%2))
+	}
+	service.processPacket(context.Background(), addr, []byte(testObsPacket), len(testObsPacket))
+
+	points := recorder.points
+	obs := points[len(points)-1]
+	if obs.Fields["wind_avg_2m"] != "4.00" {
+		t.Errorf("Expected a 4.00 m/s 2 minute average, got %q", obs.Fields["wind_avg_2m"])
+	}
+	if obs.Fields["wind_gust_10m"] != "9.00" {
+		t.Errorf("Expected a 9.00 m/s 10 minute gust, got %q", obs.Fields["wind_gust_10m"])
+	}
+	for _, point := range points[:len(points)-1] {
+		if _, ok := point.Fields["wind_avg_2m"]; ok {
+			t.Errorf("Expected METAR wind only on obs, got %v", point.Fields)
+		}
+	}
+}
+
+func TestProcessPacketParseTimeout(t *testing.T) {
+	// Hold obs parses until the test ends, like a hung derived computation
+	release := make(chan struct{})
+	parseReport = func(cfg *config.Config, addr *net.UDPAddr, report tempest.Report) (*influx.Data, error) {
+		if report.ReportType == "obs_st" {
+			<-release
+		}
+		return tempest.ParseReport(cfg, addr, report)
+	}
+
+	recorder := &recordingWriter{}
+	service := newTestService(t, &config.Config{
+		Influx_Bucket: "test-bucket",
+		Rapid_Wind:    true,
+		Parse_Timeout: 20 * time.Millisecond,
+	})
+	service.writers = []Writer{recorder}
+
+	// Restore the parser only once the abandoned parse has returned
+	defer func() {
+		close(release)
+		for service.abandonedParses.Load() > 0 {
+			time.Sleep(time.Millisecond)
+		}
+		parseReport = tempest.ParseReport
+	}()
+
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	start := time.Now()
+	service.processPacket(context.Background(), addr, []byte(testObsPacket), len(testObsPacket))
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the slow parse to be abandoned after the timeout, took %v", elapsed)
+	}
+
+	wind := `{"serial_number": "ST-123456", "type": "rapid_wind", "ob": [1640995200, 5.5, 270]}`
+	service.processPacket(context.Background(), addr, []byte(wind), len(wind))
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if len(recorder.points) != 1 || recorder.points[0].Fields["rapid_wind_speed"] == "" {
+		t.Errorf("Expected only the rapid wind point to be written, got %v", recorder.points)
+	}
+}
+
+func TestProcessPacketAbandonedParseCap(t *testing.T) {
+	release := make(chan struct{})
+	var calls atomic.Int32
+	parseReport = func(cfg *config.Config, addr *net.UDPAddr, report tempest.Report) (*influx.Data, error) {
+		calls.Add(1)
+		<-release
+		return tempest.ParseReport(cfg, addr, report)
+	}
+	defer func() { parseReport = tempest.ParseReport }()
+
+	service := newTestService(t, &config.Config{Influx_Bucket: "test-bucket", Parse_Timeout: 5 * time.Millisecond})
+	service.writers = []Writer{&recordingWriter{}}
+	service.abandonedParses.Store(maxAbandonedParses - 1)
+
+	// The first slow parse reaches the cap, so the next packet is dropped
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	for i := 0; i < 2; i++ {
+		service.processPacket(context.Background(), addr, []byte(testObsPacket), len(testObsPacket))
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("Expected the packet past the cap to be dropped unparsed, got %d parses", got)
+	}
+
+	recorder := httptest.NewRecorder()
+	service.handleMetrics(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{fmt.Sprintf("tempest_parse_abandoned %d", maxAbandonedParses), "tempest_parse_abandoned_dropped_total 1"} {
+		if !strings.Contains(recorder.Body.String(), want) {
+			t.Errorf("Expected %s in metrics, got:\n%s", want, recorder.Body.String())
+		}
+	}
+
+	// Once the abandoned parse returns it no longer counts
+	close(release)
+	deadline := time.Now().Add(2 * time.Second)
+	for service.abandonedParses.Load() != maxAbandonedParses-1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the finished parse to be uncounted, got %d", service.abandonedParses.Load())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestProcessPacketRapidWindReceiptTime(t *testing.T) {
+	var mu sync.Mutex
+	var requests []*http.Request
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, r)
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	service := newTestService(t, &config.Config{
+		Influx_URL:              server.URL,
+		Influx_Bucket:           "test-bucket",
+		Rapid_Wind:              true,
+		Rapid_Wind_Receipt_Time: true,
+	})
+
+	wind := `{"serial_number": "ST-123456", "type": "rapid_wind", "ob": [1640995200, 5.5, 270]}`
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	service.processPacket(context.Background(), addr, []byte(wind), len(wind))
+	service.processPacket(context.Background(), addr, []byte(wind), len(wind))
+	service.processPacket(context.Background(), addr, []byte(testObsPacket), len(testObsPacket))
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 3 {
+		t.Fatalf("Expected 3 writes, got %d", len(bodies))
+	}
+
+	var timestamps []string
+	for i := 0; i < 2; i++ {
+		if precision := requests[i].URL.Query().Get("precision"); precision != config.PrecisionNanoseconds {
+			t.Errorf("Expected rapid wind precision=ns, got %s", precision)
+		}
+		fields := strings.Fields(bodies[i])
+		timestamps = append(timestamps, fields[len(fields)-1])
+		if len(timestamps[i]) < 19 {
+			t.Errorf("Expected a nanosecond timestamp, got %s", timestamps[i])
+		}
+	}
+	if timestamps[0] == timestamps[1] {
+		t.Errorf("Expected distinct receipt timestamps, both %s", timestamps[0])
+	}
+
+	// Obs keep the station timestamp and configured precision
+	if precision := requests[2].URL.Query().Get("precision"); precision != config.PrecisionSeconds {
+		t.Errorf("Expected obs precision=s, got %s", precision)
+	}
+	if !strings.HasSuffix(bodies[2], " 1640995200\n") {
+		t.Errorf("Expected obs station timestamp, got %s", bodies[2])
+	}
+}
+
+func TestProcessPacketRapidWindSeq(t *testing.T) {
+	recorder := &recordingWriter{}
+	service := newTestService(t, &config.Config{
+		Influx_Bucket:  "test-bucket",
+		Rapid_Wind:     true,
+		Rapid_Wind_Seq: true,
+	})
+	service.writers = []Writer{recorder}
+
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	for _, payload := range []string{
+		`{"serial_number": "ST-123456", "type": "rapid_wind", "ob": [1640995200, 5.5, 270]}`,
+		`{"serial_number": "ST-123456", "type": "rapid_wind", "ob": [1640995200, 6.0, 275]}`,
+		testObsPacket,
+	} {
+		service.processPacket(context.Background(), addr, []byte(payload), len(payload))
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if len(recorder.points) != 3 {
+		t.Fatalf("Expected 3 points, got %d", len(recorder.points))
+	}
+	first, second := recorder.points[0], recorder.points[1]
+	if first.Timestamp != second.Timestamp {
+		t.Errorf("Expected the station timestamp to be kept, got %d and %d", first.Timestamp, second.Timestamp)
+	}
+	if first.Tags["rapid_wind_seq"] != "0" || second.Tags["rapid_wind_seq"] != "1" {
+		t.Errorf("Expected rapid_wind_seq 0 and 1, got %q and %q", first.Tags["rapid_wind_seq"], second.Tags["rapid_wind_seq"])
+	}
+	if _, ok := recorder.points[2].Tags["rapid_wind_seq"]; ok {
+		t.Errorf("Expected no rapid_wind_seq on obs, got %v", recorder.points[2].Tags)
+	}
+}
+
+func TestDrainAbandonsStuckWrites(t *testing.T) {
+	service := newTestService(t, &config.Config{
+		Influx_URL:       "http://localhost:8086",
+		Influx_Bucket:    "test-bucket",
+		Shutdown_Timeout: 50 * time.Millisecond,
+	})
+
+	// A transport that ignores request cancellation, like a hung connection
+	stuck := make(chan struct{})
+	defer close(stuck)
+	httpWriter(service).client.Transport = roundTripFunc(func(*http.Request) (*http.Response, error) {
+		<-stuck
+		return nil, context.Canceled
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	service.dispatch(ctx, addr, []byte(testObsPacket), len(testObsPacket))
+	cancel()
+
+	start := time.Now()
+	abandoned := service.drain()
+
+	if abandoned != 1 {
+		t.Errorf("Expected 1 abandoned packet, got %d", abandoned)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected drain to give up after the shutdown timeout, took %v", elapsed)
+	}
+}
+
+func TestProcessPacketMinWriteInterval(t *testing.T) {
+	var writes int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&writes, 1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	service := newTestService(t, &config.Config{
+		Influx_URL:         server.URL,
+		Min_Write_Interval: 50 * time.Second,
+	})
+
+	tooSoon := strings.Replace(testObsPacket, "1640995200", "1640995203", 1)
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	service.processPacket(context.Background(), addr, []byte(testObsPacket), len(testObsPacket))
+	service.processPacket(context.Background(), addr, []byte(tooSoon), len(tooSoon))
+
+	if got := atomic.LoadInt32(&writes); got != 1 {
+		t.Errorf("Expected the too-soon obs to be dropped, got %d writes", got)
+	}
+}
+
+func TestProcessPacketEmitRecvTime(t *testing.T) {
+	recorder := &recordingWriter{}
+	service := &WeatherService{
+		config:       &config.Config{Influx_Bucket: "test-bucket", Emit_Recv_Time: true},
+		logger:       logger.New(&config.Config{}),
+		writers:      []Writer{recorder},
+		stations:     newStationTracker(),
+		parseLatency: newParseLatency(),
+	}
+
+	before := time.Now()
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	service.processPacket(context.Background(), addr, []byte(testObsPacket), len(testObsPacket))
+	after := time.Now()
+
+	if len(recorder.points) != 1 {
+		t.Fatalf("Expected 1 point, got %d", len(recorder.points))
+	}
+	m := recorder.points[0]
+
+	recvTime, err := strconv.ParseFloat(m.Fields["recv_time"], 64)
+	if err != nil {
+		t.Fatalf("Expected a numeric recv_time, got %q", m.Fields["recv_time"])
+	}
+	// The field is written to hundredths of a second
+	if recvTime < float64(before.Unix()) || recvTime > float64(after.Unix()+1) {
+		t.Errorf("Expected recv_time between %d and %d, got %f", before.Unix(), after.Unix(), recvTime)
+	}
+	if m.Timestamp != 1640995200 {
+		t.Errorf("Expected the station timestamp to remain the point time, got %d", m.Timestamp)
+	}
+}
+
+func TestProcessPacketTempMinMax(t *testing.T) {
+	recorder := &recordingWriter{}
+	service := &WeatherService{
+		config:       &config.Config{Influx_Bucket: "test-bucket", Temp_Min_Max: true},
+		logger:       logger.New(&config.Config{}),
+		writers:      []Writer{recorder},
+		stations:     newStationTracker(),
+		parseLatency: newParseLatency(),
+	}
+
+	// Rising then falling through the day, then the first obs of the next
+	// day, a late obs from the first day and another from the next
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	morning := time.Date(2024, 6, 1, 6, 0, 0, 0, time.Local)
+	obs := []struct {
+		at   time.Time
+		temp float64
+	}{
+		{morning, 11.5},
+		{morning.Add(3 * time.Hour), 16},
+		{morning.Add(6 * time.Hour), 24.5},
+		{morning.Add(9 * time.Hour), 19},
+		{morning.Add(12 * time.Hour), 9},
+		{morning.AddDate(0, 0, 1), 13},
+		{morning.Add(13 * time.Hour), 30},
+		{morning.AddDate(0, 0, 1).Add(time.Hour), 14},
+	}
+	for _, o := range obs {
+		packet := fmt.Sprintf(`{"serial_number": "ST-123456", "type": "obs_st", "obs": [[%d, 1.5, 2.3, 3.8, 180, 3, 1013.25, %g, 65.0, 50000, 5.2, 800, 0, 0, 5, 0, 3.7, 1]]}`, o.at.Unix(), o.temp)
+		service.processPacket(context.Background(), addr, []byte(packet), len(packet))
+	}
+
+	want := []struct{ min, max string }{
+		{"11.50", "11.50"},
+		{"11.50", "16.00"},
+		{"11.50", "24.50"},
+		{"11.50", "24.50"},
+		{"9.00", "24.50"},
+		{"13.00", "13.00"},
+		{"", ""},
+		{"13.00", "14.00"},
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if len(recorder.points) != len(obs) {
+		t.Fatalf("Expected %d points, got %d", len(obs), len(recorder.points))
+	}
+	for i, w := range want {
+		fields := recorder.points[i].Fields
+		if fields["temp_min"] != w.min || fields["temp_max"] != w.max {
+			t.Errorf("Obs %d: expected temp_min=%s temp_max=%s, got %s %s", i, w.min, w.max, fields["temp_min"], fields["temp_max"])
+		}
+	}
+}
+
+func TestProcessPacketGDD(t *testing.T) {
+	recorder := &recordingWriter{}
+	service := &WeatherService{
+		config:       &config.Config{Influx_Bucket: "test-bucket", GDD: true, GDD_Base_Temp: 10},
+		logger:       logger.New(&config.Config{}),
+		writers:      []Writer{recorder},
+		stations:     newStationTracker(),
+		parseLatency: newParseLatency(),
+	}
+
+	// A 12 to 28 day, then the first obs of the next day
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	morning := time.Date(2024, 6, 1, 6, 0, 0, 0, time.Local)
+	obs := []struct {
+		at   time.Time
+		temp float64
+	}{
+		{morning, 12},
+		{morning.Add(8 * time.Hour), 28},
+		{morning.AddDate(0, 0, 1), 8},
+	}
+	for _, o := range obs {
+		packet := fmt.Sprintf(`{"serial_number": "ST-123456", "type": "obs_st", "obs": [[%d, 1.5, 2.3, 3.8, 180, 3, 1013.25, %g, 65.0, 50000, 5.2, 800, 0, 0, 5, 0, 3.7, 1]]}`, o.at.Unix(), o.temp)
+		service.processPacket(context.Background(), addr, []byte(packet), len(packet))
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if len(recorder.points) != 4 {
+		t.Fatalf("Expected 3 obs and the finished day's GDD, got %d points", len(recorder.points))
+	}
+	for i, want := range []string{"2.00", "10.00"} {
+		if got := recorder.points[i].Fields["gdd"]; got != want {
+			t.Errorf("Obs %d: expected running gdd=%s, got %s", i, want, got)
+		}
+	}
+	if _, ok := recorder.points[0].Fields["temp_min"]; ok {
+		t.Error("Expected no temp_min without temp_min_max")
+	}
+
+	final := recorder.points[2]
+	end, _ := tempest.DayEnd("2024-06-01")
+	if final.Fields["gdd"] != "10.00" || len(final.Fields) != 1 || final.Timestamp != end.Unix() {
+		t.Errorf("Expected June 1st's final gdd=10.00 at the end of the day, got %+v", final)
+	}
+	if got := recorder.points[3].Fields["gdd"]; got != "0.00" {
+		t.Errorf("Expected gdd to restart on June 2nd, got %s", got)
+	}
+}
+
+func TestProcessPacketGDDLateObs(t *testing.T) {
+	recorder := &recordingWriter{}
+	service := &WeatherService{
+		config:       &config.Config{Influx_Bucket: "test-bucket", GDD: true, GDD_Base_Temp: 10},
+		logger:       logger.New(&config.Config{}),
+		writers:      []Writer{recorder},
+		stations:     newStationTracker(),
+		parseLatency: newParseLatency(),
+	}
+
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	send := func(at time.Time, temp float64) {
+		packet := fmt.Sprintf(`{"serial_number": "ST-123456", "type": "obs_st", "obs": [[%d, 1.5, 2.3, 3.8, 180, 3, 1013.25, %g, 65.0, 50000, 5.2, 800, 0, 0, 5, 0, 3.7, 1]]}`, at.Unix(), temp)
+		service.processPacket(context.Background(), addr, []byte(packet), len(packet))
+	}
+
+	// June 1st is finished at midnight, then an obs from it arrives late
+	send(time.Date(2024, 6, 1, 6, 0, 0, 0, time.Local), 12)
+	send(time.Date(2024, 6, 1, 14, 0, 0, 0, time.Local), 28)
+	service.flushAccumulators(context.Background(), time.Date(2024, 6, 2, 0, 1, 0, 0, time.Local), false)
+	send(time.Date(2024, 6, 1, 23, 59, 0, 0, time.Local), 30)
+	send(time.Date(2024, 6, 2, 6, 0, 0, 0, time.Local), 14)
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	end, _ := tempest.DayEnd("2024-06-01")
+	var finals []string
+	for _, point := range recorder.points {
+		if point.Timestamp == end.Unix() {
+			finals = append(finals, point.Fields["gdd"])
+		}
+	}
+	if len(finals) != 1 || finals[0] != "10.00" {
+		t.Errorf("Expected June 1st's final gdd=10.00 to be written once, got %v", finals)
+	}
+	if got := recorder.points[len(recorder.points)-1].Fields["gdd"]; got != "4.00" {
+		t.Errorf("Expected June 2nd's gdd to start from its own obs, got %s", got)
+	}
+}
+
+func TestDailyTotalsMidnightFlush(t *testing.T) {
+	recorder := &recordingWriter{}
+	service := &WeatherService{
+		config:       &config.Config{Influx_Bucket: "test-bucket", Daily_Totals: true},
+		logger:       logger.New(&config.Config{}),
+		writers:      []Writer{recorder},
+		stations:     newStationTracker(),
+		parseLatency: newParseLatency(),
+	}
+
+	// Two obs late on June 1st, local time, each with 0.5mm of rain
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	evening := time.Date(2024, 6, 1, 23, 50, 0, 0, time.Local)
+	for _, ts := range []time.Time{evening, evening.Add(time.Minute)} {
+		packet := fmt.Sprintf(`{"serial_number": "ST-123456", "type": "obs_st", "obs": [[%d, 1.5, 2.3, 3.8, 180, 3, 1013.25, 25.5, 65.0, 50000, 5.2, 800, 0.5, 1, 5, 0, 3.7, 1]]}`, ts.Unix())
+		service.processPacket(context.Background(), addr, []byte(packet), len(packet))
+	}
+	if got := recorder.points[1].Fields["rain_today"]; got != "1.00" {
+		t.Fatalf("Expected rain_today=1.00 on the second obs, got %s", got)
+	}
+
+	// The station goes silent; the midnight check writes the final total
+	service.flushAccumulators(context.Background(), time.Date(2024, 6, 2, 0, 1, 0, 0, time.Local), false)
+
+	if len(recorder.points) != 3 {
+		t.Fatalf("Expected a final totals point, got %d points", len(recorder.points))
+	}
+	final := recorder.points[2]
+	if final.Fields["rain_today"] != "1.00" {
+		t.Errorf("Expected final rain_today=1.00, got %s", final.Fields["rain_today"])
+	}
+	if want := time.Date(2024, 6, 1, 23, 59, 59, 0, time.Local).Unix(); final.Timestamp != want {
+		t.Errorf("Expected final totals at %d, got %d", want, final.Timestamp)
+	}
+
+	// Totals were zeroed for the new day
+	if daily := service.stations.daily()["ST-123456"]; daily.Rain != 0 || daily.Day != "2024-06-02" {
+		t.Errorf("Expected totals reset for 2024-06-02, got %+v", daily)
+	}
+
+	// A periodic flush writes the running totals as of now
+	now := time.Date(2024, 6, 2, 0, 5, 0, 0, time.Local)
+	service.flushAccumulators(context.Background(), now, true)
+	if len(recorder.points) != 4 || recorder.points[3].Fields["rain_today"] != "0.00" || recorder.points[3].Timestamp != now.Unix() {
+		t.Errorf("Expected a running totals point at %d, got %+v", now.Unix(), recorder.points[len(recorder.points)-1])
+	}
+}
+
+func TestDailyTotalsLateObs(t *testing.T) {
+	recorder := &recordingWriter{}
+	service := &WeatherService{
+		config:       &config.Config{Influx_Bucket: "test-bucket", Daily_Totals: true},
+		logger:       logger.New(&config.Config{}),
+		writers:      []Writer{recorder},
+		stations:     newStationTracker(),
+		parseLatency: newParseLatency(),
+	}
+
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	send := func(ts time.Time) {
+		packet := fmt.Sprintf(`{"serial_number": "ST-123456", "type": "obs_st", "obs": [[%d, 1.5, 2.3, 3.8, 180, 3, 1013.25, 25.5, 65.0, 50000, 5.2, 800, 0.5, 1, 5, 0, 3.7, 1]]}`, ts.Unix())
+		service.processPacket(context.Background(), addr, []byte(packet), len(packet))
+	}
+
+	// June 2nd has started when an obs from late on June 1st arrives
+	send(time.Date(2024, 6, 2, 0, 1, 0, 0, time.Local))
+	send(time.Date(2024, 6, 1, 23, 59, 0, 0, time.Local))
+	send(time.Date(2024, 6, 2, 0, 2, 0, 0, time.Local))
+
+	if len(recorder.points) != 3 {
+		t.Fatalf("Expected no finished totals point from the late obs, got %d points", len(recorder.points))
+	}
+	if got, ok := recorder.points[1].Fields["rain_today"]; ok {
+		t.Errorf("Expected the late obs to be written without rain_today, got %s", got)
+	}
+	if got := recorder.points[2].Fields["rain_today"]; got != "1.00" {
+		t.Errorf("Expected June 2nd's total to carry on at 1.00, got %s", got)
+	}
+}
+
+func TestProcessPacketMultiMessage(t *testing.T) {
+	rapidWind := `{"serial_number": "ST-123456", "type": "rapid_wind", "ob": [1640995203, 2.3, 180]}`
+
+	tests := []struct {
+		name    string
+		payload string
+		want    []string // a field identifying each expected point
+	}{
+		{"single report", testObsPacket, []string{"temp"}},
+		{"two reports", testObsPacket + "\n" + rapidWind + "\n", []string{"temp", "rapid_wind_speed"}},
+		{"blank lines", "\n" + testObsPacket + "\r\n\n", []string{"temp"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &recordingWriter{}
+			service := &WeatherService{
+				config:       &config.Config{Influx_Bucket: "test-bucket", Rapid_Wind: true, Multi_Message: true},
+				logger:       logger.New(&config.Config{}),
+				writers:      []Writer{recorder},
+				stations:     newStationTracker(),
+				parseLatency: newParseLatency(),
+			}
+
+			addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+			service.processPacket(context.Background(), addr, []byte(tt.payload), len(tt.payload))
+
+			if len(recorder.points) != len(tt.want) {
+				t.Fatalf("Expected %d points, got %d", len(tt.want), len(recorder.points))
+			}
+			for i, field := range tt.want {
+				if _, ok := recorder.points[i].Fields[field]; !ok {
+					t.Errorf("Expected point %d to have field %s, got %v", i, field, recorder.points[i].Fields)
+				}
+			}
+		})
+	}
+}
+
+func TestNewWeatherServiceFallbackListenAddress(t *testing.T) {
+	occupied, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Failed to occupy a port: %v", err)
+	}
+	defer func() { _ = occupied.Close() }()
+
+	cfg := &config.Config{
+		Listen_Address: occupied.LocalAddr().String(),
+		Influx_URL:     "http://localhost:8086",
+		Buffer:         config.DefaultBuffer,
+	}
+
+	if _, err := NewWeatherService(cfg, logger.New(&config.Config{})); err == nil {
+		t.Fatal("Expected an error binding an occupied address without a fallback")
+	}
+
+	cfg.Fallback_Listen_Address = "127.0.0.1:0"
+	service, err := NewWeatherService(cfg, logger.New(&config.Config{}))
+	if err != nil {
+		t.Fatalf("NewWeatherService() error = %v", err)
+	}
+	defer func() { _ = service.listener.Close() }()
+
+	if service.listener.LocalAddr().String() == occupied.LocalAddr().String() {
+		t.Errorf("Expected the fallback address, got %s", service.listener.LocalAddr())
 	}
 }
@@ -0,0 +1,74 @@
+package processor
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// quarantineExt marks quarantined packet files, so pruning never touches
+// anything else in the directory
+const quarantineExt = ".bin"
+
+// quarantine keeps the raw bytes of malformed packets on disk for later
+// inspection. Each packet is its own file, named for its receipt time and
+// source, and the oldest files are removed beyond maxFiles.
+type quarantine struct {
+	mu       sync.Mutex
+	dir      string
+	maxFiles int
+}
+
+// newQuarantine creates a quarantine in dir, creating the directory if needed
+func newQuarantine(dir string, maxFiles int) (*quarantine, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("creating quarantine directory: %w", err)
+	}
+	return &quarantine{dir: dir, maxFiles: maxFiles}, nil
+}
+
+// save writes a packet received from addr at the given time, then prunes
+// the oldest files beyond maxFiles
+func (q *quarantine) save(addr *net.UDPAddr, packet []byte, at time.Time) error {
+	name := quarantineFileName(addr, at)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err := os.WriteFile(filepath.Join(q.dir, name), packet, 0o600); err != nil {
+		return err
+	}
+	return q.prune()
+}
+
+// prune removes the oldest quarantined packets beyond maxFiles. File names
+// start with the receipt time, so they sort oldest first.
+func (q *quarantine) prune() error {
+	files, err := filepath.Glob(filepath.Join(q.dir, "*"+quarantineExt))
+	if err != nil || len(files) <= q.maxFiles {
+		return err
+	}
+
+	sort.Strings(files)
+	for _, file := range files[:len(files)-q.maxFiles] {
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// quarantineFileName names a packet file for its receipt time and source,
+// avoiding characters that are not valid in file names everywhere
+func quarantineFileName(addr *net.UDPAddr, at time.Time) string {
+	source := "unknown"
+	if addr != nil {
+		source = strings.NewReplacer(":", "-", "[", "", "]", "", "%", "-").Replace(addr.String())
+	}
+	return at.UTC().Format("20060102T150405.000000000Z") + "_" + source + quarantineExt
+}
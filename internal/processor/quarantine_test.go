@@ -0,0 +1,77 @@
+package processor
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+	"github.com/jacaudi/tempest-influxdb/internal/logger"
+)
+
+func TestProcessPacketQuarantinesMalformed(t *testing.T) {
+	dir := t.TempDir()
+	q, err := newQuarantine(dir, config.DefaultQuarantineMaxFiles)
+	if err != nil {
+		t.Fatalf("newQuarantine() error = %v", err)
+	}
+	service := &WeatherService{
+		config:       &config.Config{Influx_Bucket: "test-bucket"},
+		logger:       logger.New(&config.Config{}),
+		writers:      []Writer{&recordingWriter{}},
+		stations:     newStationTracker(),
+		quarantine:   q,
+		parseLatency: newParseLatency(),
+	}
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+
+	service.processPacket(context.Background(), addr, []byte(testObsPacket), len(testObsPacket))
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Fatalf("Expected no quarantine files for a valid packet, got %d", len(files))
+	}
+
+	malformed := []byte(`{"serial_number": "ST-123456", "type": "obs_st", "obs": [[`)
+	service.processPacket(context.Background(), addr, malformed, len(malformed))
+
+	files, _ := os.ReadDir(dir)
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 quarantine file for a malformed packet, got %d", len(files))
+	}
+	if name := files[0].Name(); !strings.Contains(name, "192.168.1.100-50222") {
+		t.Errorf("Expected the source in the file name, got %s", name)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	if err != nil {
+		t.Fatalf("Failed to read quarantine file: %v", err)
+	}
+	if string(data) != string(malformed) {
+		t.Errorf("Expected the raw packet, got %q", data)
+	}
+}
+
+func TestQuarantinePrunesOldest(t *testing.T) {
+	dir := t.TempDir()
+	q, err := newQuarantine(dir, 2)
+	if err != nil {
+		t.Fatalf("newQuarantine() error = %v", err)
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		if err := q.save(nil, []byte("packet"), start.Add(time.Duration(i)*time.Second)); err != nil {
+			t.Fatalf("save() error = %v", err)
+		}
+	}
+
+	files, _ := os.ReadDir(dir)
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 quarantine files, got %d", len(files))
+	}
+	if name := files[0].Name(); name != quarantineFileName(nil, start.Add(2*time.Second)) {
+		t.Errorf("Expected the oldest files to be pruned, got %s first", name)
+	}
+}
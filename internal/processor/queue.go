@@ -0,0 +1,102 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/json"
+	"hash/fnv"
+	"net"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+)
+
+// packet is a received UDP packet waiting for a worker
+type packet struct {
+	addr *net.UDPAddr
+	b    []byte
+	n    int
+}
+
+// packetQueue is the bounded queue feeding the worker pool. When it is full
+// either the oldest queued packet or the incoming one is discarded, depending
+// on the Drop_Policy.
+type packetQueue struct {
+	packets    chan packet
+	dropOldest bool
+}
+
+// newPacketQueue creates a queue holding up to size packets
+func newPacketQueue(size int, dropPolicy string) *packetQueue {
+	return &packetQueue{
+		packets:    make(chan packet, size),
+		dropOldest: dropPolicy != config.DropNewest,
+	}
+}
+
+// newPacketQueues creates the worker pool's queues: one shared by every
+// worker, or with Station_Ordering one per worker so each station's packets
+// are always processed by the same worker in the order they were received
+func newPacketQueues(cfg *config.Config) []*packetQueue {
+	count := 1
+	if cfg.Station_Ordering {
+		count = cfg.Workers
+	}
+
+	queues := make([]*packetQueue, count)
+	for i := range queues {
+		queues[i] = newPacketQueue(cfg.Queue_Size, cfg.Drop_Policy)
+	}
+	return queues
+}
+
+// queueIndex picks one of n queues for a packet routed by key
+func queueIndex(key string, n int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
+
+// routingKey returns the station serial a packet is routed by. Packets that
+// don't name one, such as malformed ones, are routed by their source address
+// instead, which keeps everything relayed by one hub on one worker.
+func routingKey(addr *net.UDPAddr, b []byte) string {
+	// Decoding only the first value skips the rest of a Multi_Message packet
+	var report struct {
+		Serial string `json:"serial_number"`
+	}
+	if err := json.NewDecoder(bytes.NewReader(b)).Decode(&report); err == nil && report.Serial != "" {
+		return report.Serial
+	}
+	if addr == nil {
+		return ""
+	}
+	return addr.String()
+}
+
+// push queues p and returns how many packets were discarded to make room for
+// it, or 1 if p itself was discarded
+func (q *packetQueue) push(p packet) (dropped int) {
+	for {
+		select {
+		case q.packets <- p:
+			return dropped
+		default:
+		}
+
+		if !q.dropOldest {
+			return dropped + 1
+		}
+
+		// Another worker may have emptied the slot already, so only count
+		// what was actually evicted and try again
+		select {
+		case <-q.packets:
+			dropped++
+		default:
+		}
+	}
+}
+
+// close stops the queue once the reader is done; workers drain what is left
+func (q *packetQueue) close() {
+	close(q.packets)
+}
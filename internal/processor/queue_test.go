@@ -0,0 +1,108 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+	"github.com/jacaudi/tempest-influxdb/internal/tempest"
+	"github.com/samber/lo"
+)
+
+func TestPacketQueueDropPolicy(t *testing.T) {
+	tests := []struct {
+		policy string
+		want   []int
+	}{
+		{config.DropOldest, []int{2, 3}},
+		{config.DropNewest, []int{1, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			q := newPacketQueue(2, tt.policy)
+
+			dropped := 0
+			for i := 1; i <= 3; i++ {
+				dropped += q.push(packet{n: i})
+			}
+			q.close()
+
+			if dropped != 1 {
+				t.Errorf("Expected 1 dropped packet, got %d", dropped)
+			}
+
+			var got []int
+			for p := range q.packets {
+				got = append(got, p.n)
+			}
+			if len(got) != len(tt.want) || got[0] != tt.want[0] || got[1] != tt.want[1] {
+				t.Errorf("Expected queued packets %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDispatchStationOrdering(t *testing.T) {
+	cfg := &config.Config{Workers: 4, Queue_Size: 100, Station_Ordering: true}
+	service := &WeatherService{config: cfg, queues: newPacketQueues(cfg)}
+	if len(service.queues) != 4 {
+		t.Fatalf("Expected a queue per worker, got %d", len(service.queues))
+	}
+
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	stations := []string{"ST-00000001", "ST-00000002", "ST-00000003", "ST-00000004", "ST-00000005"}
+	for seq := 0; seq < 10; seq++ {
+		for _, serial := range stations {
+			b := []byte(fmt.Sprintf(`{"serial_number": %q, "type": "rapid_wind", "ob": [%d, 1.5, 180]}`, serial, 1640995200+seq))
+			service.dispatch(context.Background(), addr, b, len(b))
+		}
+	}
+	for _, q := range service.queues {
+		q.close()
+	}
+
+	// Each station's packets sit on exactly one worker's queue, in order
+	worker := make(map[string]int)
+	next := make(map[string]int)
+	for i, q := range service.queues {
+		for p := range q.packets {
+			var report tempest.Report
+			if err := json.Unmarshal(p.b[:p.n], &report); err != nil {
+				t.Fatalf("Failed to decode queued packet: %v", err)
+			}
+			serial := report.StationSerial
+			if w, seen := worker[serial]; seen && w != i {
+				t.Errorf("Station %s was queued for workers %d and %d", serial, w, i)
+			}
+			worker[serial] = i
+			if want := int64(1640995200 + next[serial]); report.Time() != want {
+				t.Errorf("Station %s: expected packet %d next, got %d", serial, want, report.Time())
+			}
+			next[serial]++
+		}
+	}
+	if used := len(lo.Uniq(lo.Values(worker))); used < 2 {
+		t.Errorf("Expected stations spread over several workers, got %d", used)
+	}
+	for _, serial := range stations {
+		if next[serial] != 10 {
+			t.Errorf("Expected 10 packets queued for %s, got %d", serial, next[serial])
+		}
+	}
+}
+
+func TestRoutingKey(t *testing.T) {
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+
+	multi := []byte(`{"serial_number": "ST-1", "type": "obs_st"}` + "\n" + `{"serial_number": "ST-2", "type": "obs_st"}`)
+	if got := routingKey(addr, multi); got != "ST-1" {
+		t.Errorf("Expected the first message's serial, got %q", got)
+	}
+	if got := routingKey(addr, []byte("not json")); got != "192.168.1.100:50222" {
+		t.Errorf("Expected malformed packets to be routed by source, got %q", got)
+	}
+}
@@ -0,0 +1,93 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// hostResolver looks up the addresses of a host, as net.Resolver does
+type hostResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// dialFunc dials an address, as net.Dialer.DialContext does
+type dialFunc func(ctx context.Context, network string, address string) (net.Conn, error)
+
+// cachingDialer resolves hostnames once per ttl rather than on every new
+// connection, so a slow resolver doesn't hold up reconnects. A host whose
+// cached addresses all fail to dial is looked up again on the next dial.
+type cachingDialer struct {
+	resolver hostResolver
+	dial     dialFunc
+	ttl      time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]cachedHost
+}
+
+// cachedHost is a host's addresses and when they must be looked up again
+type cachedHost struct {
+	addrs   []string
+	expires time.Time
+}
+
+// newCachingDialer creates a cachingDialer that looks hosts up with resolver
+// and connects with dial
+func newCachingDialer(resolver hostResolver, dial dialFunc, ttl time.Duration) *cachingDialer {
+	return &cachingDialer{resolver: resolver, dial: dial, ttl: ttl, hosts: make(map[string]cachedHost)}
+}
+
+// DialContext dials address, trying each cached address of its host in turn
+func (d *cachingDialer) DialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(host) != nil {
+		return d.dial(ctx, network, address)
+	}
+
+	addrs, err := d.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	errs := make([]error, 0, len(addrs))
+	for _, addr := range addrs {
+		conn, err := d.dial(ctx, network, net.JoinHostPort(addr, port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+	}
+
+	// The host may have moved, so don't keep dialing stale addresses
+	d.mu.Lock()
+	delete(d.hosts, host)
+	d.mu.Unlock()
+	return nil, errors.Join(errs...)
+}
+
+// lookup returns the cached addresses of host, resolving it if they are
+// missing or expired
+func (d *cachingDialer) lookup(ctx context.Context, host string) ([]string, error) {
+	d.mu.Lock()
+	cached, ok := d.hosts[host]
+	d.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.addrs, nil
+	}
+
+	addrs, err := d.resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, &net.DNSError{Err: "no addresses", Name: host, IsNotFound: true}
+	}
+
+	d.mu.Lock()
+	d.hosts[host] = cachedHost{addrs: addrs, expires: time.Now().Add(d.ttl)}
+	d.mu.Unlock()
+	return addrs, nil
+}
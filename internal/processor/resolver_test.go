@@ -0,0 +1,102 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+)
+
+// countingResolver resolves every host to addrs, counting lookups
+type countingResolver struct {
+	lookups atomic.Int32
+	addrs   []string
+}
+
+func (r *countingResolver) LookupHost(_ context.Context, _ string) ([]string, error) {
+	r.lookups.Add(1)
+	return r.addrs, nil
+}
+
+func TestCachingDialerResolvesOnce(t *testing.T) {
+	var mu sync.Mutex
+	var writes int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		writes++
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+
+	service := newTestService(t, &config.Config{Influx_URL: "http://influx.test:" + serverURL.Port()})
+	resolver := &countingResolver{addrs: []string{"127.0.0.1"}}
+	transport := &http.Transport{
+		// Force a new connection, and so a dial, for every write
+		DisableKeepAlives: true,
+		DialContext:       newCachingDialer(resolver, (&net.Dialer{}).DialContext, time.Minute).DialContext,
+	}
+	writer := httpWriter(service)
+	writer.client.Transport = transport
+
+	for i := 0; i < 5; i++ {
+		writer.write(context.Background(), writer.writeURL("test-bucket"), "weather,station=ST-1 temp=1 1\n")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if writes != 5 {
+		t.Fatalf("Expected 5 writes through the cached address, got %d", writes)
+	}
+	if got := resolver.lookups.Load(); got != 1 {
+		t.Errorf("Expected the hostname to be resolved once, got %d lookups", got)
+	}
+}
+
+func TestCachingDialerExpiryAndFailure(t *testing.T) {
+	resolver := &countingResolver{addrs: []string{"192.0.2.1", "192.0.2.2"}}
+	var dialed []string
+	failing := errors.New("connection refused")
+	dial := func(_ context.Context, _ string, address string) (net.Conn, error) {
+		dialed = append(dialed, address)
+		return nil, failing
+	}
+
+	dialer := newCachingDialer(resolver, dial, time.Hour)
+	_, err := dialer.DialContext(context.Background(), "tcp", "influx.test:8086")
+	if !errors.Is(err, failing) {
+		t.Errorf("Expected the dial error, got %v", err)
+	}
+	if len(dialed) != 2 || dialed[0] != "192.0.2.1:8086" || dialed[1] != "192.0.2.2:8086" {
+		t.Errorf("Expected each address to be tried, got %v", dialed)
+	}
+
+	// Failing addresses are dropped from the cache
+	_, _ = dialer.DialContext(context.Background(), "tcp", "influx.test:8086")
+	if got := resolver.lookups.Load(); got != 2 {
+		t.Errorf("Expected a failed host to be looked up again, got %d lookups", got)
+	}
+
+	// IP addresses are dialed directly
+	_, _ = dialer.DialContext(context.Background(), "tcp", "192.0.2.3:8086")
+	if got := resolver.lookups.Load(); got != 2 {
+		t.Errorf("Expected no lookup for an IP address, got %d lookups", got)
+	}
+
+	expiring := newCachingDialer(resolver, dial, time.Nanosecond)
+	_, _ = expiring.lookup(context.Background(), "influx.test")
+	time.Sleep(time.Millisecond)
+	_, _ = expiring.lookup(context.Background(), "influx.test")
+	if got := resolver.lookups.Load(); got != 4 {
+		t.Errorf("Expected an expired host to be looked up again, got %d lookups", got)
+	}
+}
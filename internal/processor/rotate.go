@@ -0,0 +1,111 @@
+package processor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// rotatingDateLayout dates rotated file names, which therefore sort oldest first
+const rotatingDateLayout = "2006-01-02"
+
+// rotatingFile appends to one file per local day, named prefix-YYYY-MM-DD ext
+// in dir, and when a new day's file is started removes the oldest beyond
+// retain (0 keeps every file). It is not safe for concurrent use.
+type rotatingFile struct {
+	dir    string
+	prefix string
+	ext    string
+	retain int
+
+	// day is the date of the file last appended to
+	day string
+}
+
+// newRotatingFile creates a rotatingFile in dir, creating the directory if
+// needed
+func newRotatingFile(dir string, prefix string, ext string, retain int) (*rotatingFile, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &rotatingFile{dir: dir, prefix: prefix, ext: ext, retain: retain}, nil
+}
+
+// append writes data to the file for the day of now, pruning old files when
+// the day changes
+func (r *rotatingFile) append(data []byte, now time.Time) error {
+	day := now.Format(rotatingDateLayout)
+
+	f, err := os.OpenFile(filepath.Join(r.dir, r.prefix+"-"+day+r.ext), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if day == r.day {
+		return nil
+	}
+	r.day = day
+	return r.prune()
+}
+
+// files returns the paths of the rotated files, oldest first
+func (r *rotatingFile) files() ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(r.dir, r.prefix+"-*"+r.ext))
+	if err != nil {
+		return nil, err
+	}
+
+	// Skip anything else that happens to match, such as spool-x.jsonl
+	files := matches[:0]
+	for _, path := range matches {
+		day := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), r.prefix+"-"), r.ext)
+		if _, err := time.Parse(rotatingDateLayout, day); err == nil {
+			files = append(files, path)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// prune removes the oldest files beyond retain
+func (r *rotatingFile) prune() error {
+	if r.retain <= 0 {
+		return nil
+	}
+
+	files, err := r.files()
+	if err != nil || len(files) <= r.retain {
+		return err
+	}
+	for _, path := range files[:len(files)-r.retain] {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gzipMember compresses data as a standalone gzip member. Members appended to
+// one file read back as a single continuous gzip stream.
+func gzipMember(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,72 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotatingFileRotatesAndPrunes(t *testing.T) {
+	dir := t.TempDir()
+	r, err := newRotatingFile(dir, "capture", ".jsonl", 2)
+	if err != nil {
+		t.Fatalf("newRotatingFile() error = %v", err)
+	}
+
+	// An unrelated file sharing the prefix is never pruned
+	if err := os.WriteFile(filepath.Join(dir, "capture-notes.jsonl"), nil, 0o600); err != nil {
+		t.Fatalf("Failed to write unrelated file: %v", err)
+	}
+
+	day := time.Date(2024, 6, 1, 23, 59, 0, 0, time.Local)
+	for _, at := range []time.Time{day, day.Add(30 * time.Second), day.Add(2 * time.Minute), day.Add(24 * time.Hour), day.Add(48 * time.Hour)} {
+		if err := r.append([]byte(at.Format(time.RFC3339)+"\n"), at); err != nil {
+			t.Fatalf("append() error = %v", err)
+		}
+	}
+
+	files, err := r.files()
+	if err != nil {
+		t.Fatalf("files() error = %v", err)
+	}
+	want := []string{"capture-2024-06-02.jsonl", "capture-2024-06-03.jsonl"}
+	if len(files) != len(want) {
+		t.Fatalf("Expected files %v, got %v", want, files)
+	}
+	for i, name := range want {
+		if filepath.Base(files[i]) != name {
+			t.Errorf("Expected file %d to be %s, got %s", i, name, filepath.Base(files[i]))
+		}
+	}
+
+	// Records after midnight went to the new day's file
+	data, err := os.ReadFile(filepath.Join(dir, "capture-2024-06-02.jsonl"))
+	if err != nil {
+		t.Fatalf("Failed to read rotated file: %v", err)
+	}
+	if lines := len(splitMessages(data)); lines != 2 {
+		t.Errorf("Expected 2 records in the 2024-06-02 file, got %d", lines)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "capture-notes.jsonl")); err != nil {
+		t.Errorf("Expected the unrelated file to be kept, got %v", err)
+	}
+}
+
+func TestRotatingFileKeepsAllWithoutRetention(t *testing.T) {
+	r, err := newRotatingFile(t.TempDir(), "spool", ".jsonl", 0)
+	if err != nil {
+		t.Fatalf("newRotatingFile() error = %v", err)
+	}
+
+	day := time.Date(2024, 6, 1, 12, 0, 0, 0, time.Local)
+	for i := 0; i < 5; i++ {
+		if err := r.append([]byte("x\n"), day.AddDate(0, 0, i)); err != nil {
+			t.Fatalf("append() error = %v", err)
+		}
+	}
+
+	if files, _ := r.files(); len(files) != 5 {
+		t.Errorf("Expected 5 files, got %d", len(files))
+	}
+}
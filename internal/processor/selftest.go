@@ -0,0 +1,111 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jacaudi/tempest-influxdb/internal/influx"
+)
+
+// SelfTestStation is the station serial of the packet sent by SelfTest
+const SelfTestStation = "self-test"
+
+// selfTestTimeout bounds how long SelfTest waits for its packet
+const selfTestTimeout = 5 * time.Second
+
+// SelfTest sends a synthetic obs_st packet to the service's own listener and
+// runs it through the live read, parse and write path. The write is checked
+// against InfluxDB unless Noop is set, in which case it only has to be
+// attempted. It returns an error unless every step succeeds, and closes the
+// listener when done.
+func (ws *WeatherService) SelfTest(ctx context.Context) error {
+	defer func() { _ = ws.listener.Close() }()
+
+	ctx, cancel := context.WithTimeout(ctx, selfTestTimeout)
+	defer cancel()
+
+	conn, err := net.Dial("udp", selfTestAddr(ws.listener.LocalAddr()))
+	if err != nil {
+		return fmt.Errorf("connecting to listener: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	packet := syntheticObsPacket(SelfTestStation, time.Now())
+	if _, err := conn.Write([]byte(packet)); err != nil {
+		return fmt.Errorf("sending packet: %w", err)
+	}
+
+	// Capture the point instead of writing it, so live stations broadcasting
+	// on the same network are not written and the result can be checked
+	writers := ws.writers
+	capture := &selfTestCapture{points: make(chan *influx.Data, 1)}
+	ws.writers = []Writer{capture}
+	defer func() { ws.writers = writers }()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.New("timed out waiting for the self-test packet to be parsed")
+		case m := <-capture.points:
+			ws.logger.Info("Self-test packet parsed", "measurement", m.Name, "fields", len(m.Fields))
+			return ws.selfTestWrite(ctx, writers, m)
+		default:
+		}
+
+		b, n, udpAddr, ok := ws.readPacket()
+		if !ok {
+			continue
+		}
+		ws.processPacket(ctx, udpAddr, b, n)
+	}
+}
+
+// selfTestWrite writes the self-test point with each writer. HTTP writes must
+// be accepted by InfluxDB unless Noop is set.
+func (ws *WeatherService) selfTestWrite(ctx context.Context, writers []Writer, m *influx.Data) error {
+	for _, writer := range writers {
+		w, ok := writer.(*InfluxHTTPWriter)
+		if !ok || ws.config.Noop {
+			if err := writer.Write(ctx, m); err != nil {
+				return fmt.Errorf("writing self-test point: %w", err)
+			}
+			continue
+		}
+
+		if delivered, _, _ := w.post(ctx, w.pointURL(m), m.Marshal()); !delivered {
+			return errors.New("InfluxDB did not accept the self-test point")
+		}
+	}
+	return nil
+}
+
+// selfTestAddr returns the address to send the self-test packet to. A
+// listener on all interfaces is reached through loopback.
+func selfTestAddr(addr net.Addr) string {
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return addr.String()
+	}
+	if udpAddr.IP == nil || udpAddr.IP.IsUnspecified() {
+		return net.JoinHostPort("127.0.0.1", fmt.Sprint(udpAddr.Port))
+	}
+	return udpAddr.String()
+}
+
+// selfTestCapture is a Writer that keeps the self-test station's point
+type selfTestCapture struct {
+	once   sync.Once
+	points chan *influx.Data
+}
+
+// Write keeps the first point from the self-test station and ignores the rest
+func (c *selfTestCapture) Write(_ context.Context, m *influx.Data) error {
+	if m.Tags["station"] == SelfTestStation {
+		c.once.Do(func() { c.points <- m })
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package processor
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+	"github.com/jacaudi/tempest-influxdb/internal/logger"
+)
+
+func TestSelfTest(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		noop    bool
+		wantErr bool
+		wantHit bool
+	}{
+		{"accepted", http.StatusNoContent, false, false, true},
+		{"rejected", http.StatusUnauthorized, false, true, true},
+		{"noop", http.StatusInternalServerError, true, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var bodies []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				mu.Lock()
+				bodies = append(bodies, string(body))
+				mu.Unlock()
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			cfg := &config.Config{
+				Listen_Address: "127.0.0.1:0",
+				Influx_URL:     server.URL,
+				Influx_Bucket:  "test-bucket",
+				Buffer:         config.DefaultBuffer,
+				Noop:           tt.noop,
+			}
+			service, err := NewWeatherService(cfg, logger.New(&config.Config{}))
+			if err != nil {
+				t.Fatalf("NewWeatherService() error = %v", err)
+			}
+
+			err = service.SelfTest(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SelfTest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if hit := len(bodies) > 0; hit != tt.wantHit {
+				t.Fatalf("Expected InfluxDB to be called: %v, got %d requests", tt.wantHit, len(bodies))
+			}
+			if tt.wantHit && !strings.Contains(bodies[0], "station="+SelfTestStation) {
+				t.Errorf("Expected the self-test point, got %q", bodies[0])
+			}
+		})
+	}
+}
+
+func TestSelfTestAddr(t *testing.T) {
+	tests := []struct {
+		addr net.Addr
+		want string
+	}{
+		{&net.UDPAddr{Port: 50222}, "127.0.0.1:50222"},
+		{&net.UDPAddr{IP: net.IPv6unspecified, Port: 50222}, "127.0.0.1:50222"},
+		{&net.UDPAddr{IP: net.IPv4(10, 0, 0, 5), Port: 50222}, "10.0.0.5:50222"},
+	}
+
+	for _, tt := range tests {
+		if got := selfTestAddr(tt.addr); got != tt.want {
+			t.Errorf("selfTestAddr(%v) = %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Spool file names. Compressed records go to their own file so toggling
+// Spool_Compress between runs never mixes formats within a file.
+const (
+	spoolFile           = "spool.jsonl"
+	spoolCompressedFile = "spool.jsonl.gz"
+)
+
+// Rotated spool files are named spool-YYYY-MM-DD.jsonl, plus .gz if compressed
+const (
+	spoolPrefix = "spool"
+	jsonlExt    = ".jsonl"
+	gzipExt     = ".gz"
+)
+
+// corruptExt is added to a spool file that could not be fully decoded
+const corruptExt = ".corrupt"
+
+// spoolRecord is a write that could not be delivered to InfluxDB
+type spoolRecord struct {
+	URL  string `json:"url"`
+	Body string `json:"body"`
+}
+
+// spool persists undeliverable writes to disk so they can be replayed once
+// InfluxDB is reachable again. Records are JSON lines; when compress is set
+// each record is appended as its own gzip member, which gzip readers treat
+// as one continuous stream.
+type spool struct {
+	mu       sync.Mutex
+	dir      string
+	compress bool
+
+	// rotated holds the daily plain and compressed files, in that order,
+	// when Spool_Rotate is set
+	rotated []*rotatingFile
+}
+
+// newSpool creates a spool in dir, creating the directory if needed
+func newSpool(dir string, compress bool) (*spool, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("creating spool directory: %w", err)
+	}
+	return &spool{dir: dir, compress: compress}, nil
+}
+
+// newRotatingSpool creates a spool in dir that starts a new file each day and
+// keeps at most retain days of files (0 keeps every file)
+func newRotatingSpool(dir string, compress bool, retain int) (*spool, error) {
+	s, err := newSpool(dir, compress)
+	if err != nil {
+		return nil, err
+	}
+	for _, ext := range []string{jsonlExt, jsonlExt + gzipExt} {
+		file, err := newRotatingFile(dir, spoolPrefix, ext, retain)
+		if err != nil {
+			return nil, fmt.Errorf("creating spool directory: %w", err)
+		}
+		s.rotated = append(s.rotated, file)
+	}
+	return s, nil
+}
+
+// append adds a record to the spool
+func (s *spool) append(record spoolRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	name := spoolFile
+	if s.compress {
+		name = spoolCompressedFile
+		if line, err = gzipMember(line); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rotated != nil {
+		file := s.rotated[0]
+		if s.compress {
+			file = s.rotated[1]
+		}
+		return file.append(line, time.Now())
+	}
+
+	f, err := os.OpenFile(filepath.Join(s.dir, name), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// take moves every spooled record out of the spool and returns them.
+// New records appended afterwards start a fresh file. A file that can't be
+// fully decoded, such as one with a write torn by a crash, gives up the
+// records before the damage and is renamed to *.corrupt so it doesn't
+// block the files after it; the returned error names each such file.
+func (s *spool) take() ([]spoolRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Unrotated files come first, then rotated files oldest first
+	paths := []string{filepath.Join(s.dir, spoolFile), filepath.Join(s.dir, spoolCompressedFile)}
+	for _, file := range s.rotated {
+		rotated, err := file.files()
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, rotated...)
+	}
+
+	var records []spoolRecord
+	var corrupt []error
+	for _, path := range paths {
+		name := filepath.Base(path)
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return records, errors.Join(append(corrupt, err)...)
+		}
+
+		fileRecords, err := decodeSpool(data)
+		records = append(records, fileRecords...)
+		if err != nil {
+			corrupt = append(corrupt, fmt.Errorf("reading %s, moved to %s after %d records: %w", name, name+corruptExt, len(fileRecords), err))
+			if err := os.Rename(path, path+corruptExt); err != nil {
+				return records, errors.Join(append(corrupt, err)...)
+			}
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return records, errors.Join(append(corrupt, err)...)
+		}
+	}
+	return records, errors.Join(corrupt...)
+}
+
+// decodeSpool decodes spool file contents, transparently decompressing
+// gzipped data
+func decodeSpool(data []byte) ([]spoolRecord, error) {
+	var r io.Reader = bytes.NewReader(data)
+	if len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = zr.Close() }()
+		r = zr
+	}
+
+	var records []spoolRecord
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var record spoolRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return records, err
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
@@ -0,0 +1,188 @@
+package processor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+)
+
+func TestSpoolRoundTrip(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		t.Run(map[bool]string{false: "plain", true: "compressed"}[compress], func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := newSpool(dir, compress)
+			if err != nil {
+				t.Fatalf("newSpool() error = %v", err)
+			}
+
+			records := []spoolRecord{
+				{URL: "http://influx/api/v2/write?bucket=a", Body: "weather,station=ST-1 temp=1.00 1\n"},
+				{URL: "http://influx/api/v2/write?bucket=b", Body: "weather,station=ST-2 temp=2.00 2\nweather,station=ST-2 temp=3.00 3\n"},
+			}
+			for _, record := range records {
+				if err := s.append(record); err != nil {
+					t.Fatalf("append() error = %v", err)
+				}
+			}
+
+			name := spoolFile
+			if compress {
+				name = spoolCompressedFile
+			}
+			data, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatalf("Failed to read spool file: %v", err)
+			}
+			isGzip := len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b
+			if isGzip != compress {
+				t.Errorf("Expected gzip=%v spool file, got gzip=%v", compress, isGzip)
+			}
+
+			got, err := s.take()
+			if err != nil {
+				t.Fatalf("take() error = %v", err)
+			}
+			if len(got) != len(records) {
+				t.Fatalf("Expected %d records, got %d", len(records), len(got))
+			}
+			for i := range records {
+				if got[i] != records[i] {
+					t.Errorf("Record %d = %+v, want %+v", i, got[i], records[i])
+				}
+			}
+
+			if again, _ := s.take(); len(again) != 0 {
+				t.Errorf("Expected empty spool after take, got %d records", len(again))
+			}
+		})
+	}
+}
+
+func TestSpoolReadsBothFormats(t *testing.T) {
+	dir := t.TempDir()
+	plain, _ := newSpool(dir, false)
+	compressed, _ := newSpool(dir, true)
+
+	_ = plain.append(spoolRecord{URL: "a", Body: "one\n"})
+	_ = compressed.append(spoolRecord{URL: "b", Body: "two\n"})
+
+	got, err := compressed.take()
+	if err != nil {
+		t.Fatalf("take() error = %v", err)
+	}
+	if len(got) != 2 {
+		t.Errorf("Expected records from both spool files, got %v", got)
+	}
+}
+
+func TestWriteSpoolsAndReplays(t *testing.T) {
+	var mu sync.Mutex
+	healthy := false
+	var delivered []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		delivered = append(delivered, r.URL.Query().Get("bucket"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	service := newTestService(t, &config.Config{Influx_URL: server.URL})
+	var err error
+	writer := httpWriter(service)
+	writer.spool, err = newSpool(t.TempDir(), true)
+	if err != nil {
+		t.Fatalf("newSpool() error = %v", err)
+	}
+
+	writer.write(context.Background(), writer.writeURL("spooled"), "weather,station=ST-1 temp=1.00 1\n")
+
+	mu.Lock()
+	healthy = true
+	mu.Unlock()
+
+	writer.write(context.Background(), writer.writeURL("live"), "weather,station=ST-1 temp=2.00 2\n")
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(delivered) != 2 || delivered[0] != "live" || delivered[1] != "spooled" {
+		t.Errorf("Expected live write then spooled replay, got %v", delivered)
+	}
+}
+
+func TestRotatingSpoolRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newRotatingSpool(dir, true, 3)
+	if err != nil {
+		t.Fatalf("newRotatingSpool() error = %v", err)
+	}
+
+	// A file from an earlier run without rotation is replayed too
+	legacy, _ := newSpool(dir, false)
+	_ = legacy.append(spoolRecord{URL: "a", Body: "one\n"})
+	if err := s.append(spoolRecord{URL: "b", Body: "two\n"}); err != nil {
+		t.Fatalf("append() error = %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "spool-"+time.Now().Format("2006-01-02")+".jsonl.gz")); err != nil {
+		t.Errorf("Expected a dated spool file, got %v", err)
+	}
+
+	got, err := s.take()
+	if err != nil {
+		t.Fatalf("take() error = %v", err)
+	}
+	if len(got) != 2 || got[0].URL != "a" || got[1].URL != "b" {
+		t.Errorf("Expected the unrotated record then the rotated one, got %v", got)
+	}
+	if again, _ := s.take(); len(again) != 0 {
+		t.Errorf("Expected empty spool after take, got %d records", len(again))
+	}
+}
+
+func TestSpoolSkipsTornFile(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newRotatingSpool(dir, true, 0)
+	if err != nil {
+		t.Fatalf("newRotatingSpool() error = %v", err)
+	}
+
+	// A crash during the second append leaves only part of its gzip member
+	legacy, _ := newSpool(dir, true)
+	_ = legacy.append(spoolRecord{URL: "a", Body: "one\n"})
+	path := filepath.Join(dir, spoolCompressedFile)
+	whole, _ := os.ReadFile(path)
+	_ = legacy.append(spoolRecord{URL: "b", Body: "two\n"})
+	data, _ := os.ReadFile(path)
+	if err := os.WriteFile(path, data[:len(whole)+12], 0o600); err != nil {
+		t.Fatalf("Failed to truncate spool file: %v", err)
+	}
+	if err := s.append(spoolRecord{URL: "c", Body: "three\n"}); err != nil {
+		t.Fatalf("append() error = %v", err)
+	}
+
+	got, err := s.take()
+	if err == nil {
+		t.Error("Expected an error naming the torn file")
+	}
+	if len(got) != 2 || got[0].URL != "a" || got[1].URL != "c" {
+		t.Errorf("Expected the record before the tear then the rotated one, got %v", got)
+	}
+	if _, err := os.Stat(path + corruptExt); err != nil {
+		t.Errorf("Expected the torn file to be set aside, got %v", err)
+	}
+	if again, err := s.take(); len(again) != 0 || err != nil {
+		t.Errorf("Expected empty spool after take, got %v, %v", again, err)
+	}
+}
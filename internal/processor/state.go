@@ -0,0 +1,458 @@
+package processor
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jacaudi/tempest-influxdb/internal/tempest"
+)
+
+// stationState is the in-memory state kept for each station
+type stationState struct {
+	LastSeen      time.Time        `json:"last_seen"`
+	LastTimestamp map[string]int64 `json:"last_timestamp"`
+	Packets       map[string]int   `json:"packets"`
+
+	// LastWritten is the station timestamp of the last obs point written and
+	// Throttled counts obs points dropped by Min_Write_Interval
+	LastWritten int64 `json:"last_written"`
+	Throttled   int   `json:"throttled"`
+
+	// Silent is set by the watchdog once the station exceeds Station_Timeout
+	Silent bool `json:"silent"`
+
+	// ObsVersion is the apparent UDP API version of the station's latest
+	// obs, detected from its array layout
+	ObsVersion int `json:"obs_version,omitempty"`
+
+	// Battery is the battery voltage of the latest obs
+	Battery     float64 `json:"battery,omitempty"`
+	batterySeen bool
+
+	// LastSeq is the latest hub_status seq and SeqMissed counts the hub
+	// status reports its gaps show were never received
+	LastSeq   int `json:"last_seq"`
+	SeqMissed int `json:"seq_missed"`
+	seqSeen   bool
+
+	// LastPrecipEvent is the station timestamp of the latest rain start
+	// event and PrecipDebounced counts those dropped by Precip_Debounce
+	LastPrecipEvent int64 `json:"last_precip_event,omitempty"`
+	PrecipDebounced int   `json:"precip_debounced,omitempty"`
+
+	// Daily holds the running totals for the current local day
+	Daily tempest.DailyTotals `json:"daily"`
+
+	// TempRange holds the air temperature low and high of the current
+	// local day
+	TempRange tempest.TempRange `json:"temp_range"`
+
+	// strikes holds recent obs strike counts for the strike rate window
+	strikes []strikeSample
+
+	// wind holds recent rapid wind speeds for the METAR wind windows
+	wind []windSample
+
+	// rapidWind holds the latest rapid wind fields until merged onto an obs
+	rapidWind map[string]string
+
+	// rapidWindSecond is the timestamp of the last rapid wind and
+	// rapidWindSeq counts the rapid winds seen within it
+	rapidWindSecond int64
+	rapidWindSeq    int
+}
+
+// strikeSample is the strike count reported by one obs
+type strikeSample struct {
+	timestamp int64
+	count     int
+}
+
+// windSample is the wind speed in m/s reported by one rapid wind
+type windSample struct {
+	timestamp int64
+	speed     float64
+}
+
+// stationTracker holds per-station state shared by packet processors. All
+// reads and writes of station state go through mu.
+type stationTracker struct {
+	mu       sync.Mutex
+	stations map[string]*stationState
+}
+
+// newStationTracker creates an empty stationTracker
+func newStationTracker() *stationTracker {
+	return &stationTracker{stations: make(map[string]*stationState)}
+}
+
+// station returns the state for serial, creating it if needed. Callers must hold mu.
+func (t *stationTracker) station(serial string) *stationState {
+	state, ok := t.stations[serial]
+	if !ok {
+		state = &stationState{
+			LastTimestamp: make(map[string]int64),
+			Packets:       make(map[string]int),
+		}
+		t.stations[serial] = state
+	}
+	return state
+}
+
+// observe records that a report was received from a station
+func (t *stationTracker) observe(report tempest.Report, now time.Time) {
+	if t == nil || report.StationSerial == "" {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := t.station(report.StationSerial)
+	state.LastSeen = now
+	state.Packets[report.ReportType]++
+	if ts := report.Time(); ts != 0 {
+		state.LastTimestamp[report.ReportType] = ts
+	}
+}
+
+// snapshot returns a deep copy of every station's state
+func (t *stationTracker) snapshot() map[string]stationState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := make(map[string]stationState, len(t.stations))
+	for serial, state := range t.stations {
+		copied := *state
+		copied.LastTimestamp = make(map[string]int64, len(state.LastTimestamp))
+		for k, v := range state.LastTimestamp {
+			copied.LastTimestamp[k] = v
+		}
+		copied.Packets = make(map[string]int, len(state.Packets))
+		for k, v := range state.Packets {
+			copied.Packets[k] = v
+		}
+		copied.strikes = append([]strikeSample(nil), state.strikes...)
+		copied.wind = append([]windSample(nil), state.wind...)
+		copied.rapidWind = nil
+		out[serial] = copied
+	}
+	return out
+}
+
+// setBattery records the battery voltage of a station's latest obs
+func (t *stationTracker) setBattery(serial string, volts float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := t.station(serial)
+	state.Battery = volts
+	state.batterySeen = true
+}
+
+// setObsVersion records the obs layout version of a station's latest obs and
+// reports whether it differs from the one recorded before
+func (t *stationTracker) setObsVersion(serial string, version int) (changed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := t.station(serial)
+	changed = state.ObsVersion != version
+	state.ObsVersion = version
+	return changed
+}
+
+// allowObsWrite reports whether an obs point with the given station timestamp
+// is at least interval after the last one written for the station, recording
+// it as written if so and counting it as throttled otherwise
+func (t *stationTracker) allowObsWrite(serial string, timestamp int64, interval time.Duration) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := t.station(serial)
+	if state.LastWritten != 0 && time.Duration(timestamp-state.LastWritten)*time.Second < interval {
+		state.Throttled++
+		return false
+	}
+	state.LastWritten = timestamp
+	return true
+}
+
+// allowPrecipEvent records a rain start event and reports whether it should
+// be written, which it is unless the station's previous event was within
+// window of it. Each event restarts the window, so intermittent drizzle
+// produces a single event for as long as the gaps stay shorter than window.
+func (t *stationTracker) allowPrecipEvent(serial string, timestamp int64, window time.Duration) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := t.station(serial)
+	last := state.LastPrecipEvent
+	state.LastPrecipEvent = timestamp
+	if last != 0 && time.Duration(timestamp-last)*time.Second < window {
+		state.PrecipDebounced++
+		return false
+	}
+	return true
+}
+
+// strikeRate records an obs strike count and returns the total strikes the
+// station reported within window of timestamp, pruning older samples
+func (t *stationTracker) strikeRate(serial string, timestamp int64, count int, window time.Duration) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := t.station(serial)
+	state.strikes = append(state.strikes, strikeSample{timestamp: timestamp, count: count})
+
+	cutoff := timestamp - int64(window/time.Second)
+	kept := state.strikes[:0]
+	total := 0
+	for _, sample := range state.strikes {
+		if sample.timestamp > cutoff {
+			kept = append(kept, sample)
+			total += sample.count
+		}
+	}
+	state.strikes = kept
+	return total
+}
+
+// addWindSample records a rapid wind speed, pruning samples older than
+// window before timestamp
+func (t *stationTracker) addWindSample(serial string, timestamp int64, speed float64, window time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := t.station(serial)
+	state.wind = append(state.wind, windSample{timestamp: timestamp, speed: speed})
+
+	cutoff := timestamp - int64(window/time.Second)
+	kept := state.wind[:0]
+	for _, sample := range state.wind {
+		if sample.timestamp > cutoff {
+			kept = append(kept, sample)
+		}
+	}
+	state.wind = kept
+}
+
+// windStats returns the mean rapid wind speed within avgWindow of timestamp
+// and the highest within gustWindow, or false if there is no sample within
+// avgWindow. Samples after timestamp are ignored.
+func (t *stationTracker) windStats(serial string, timestamp int64, avgWindow time.Duration, gustWindow time.Duration) (avg float64, gust float64, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	avgCutoff := timestamp - int64(avgWindow/time.Second)
+	gustCutoff := timestamp - int64(gustWindow/time.Second)
+	sum, count := 0.0, 0
+	for _, sample := range t.station(serial).wind {
+		if sample.timestamp > timestamp {
+			continue
+		}
+		if sample.timestamp > gustCutoff && sample.speed > gust {
+			gust = sample.speed
+		}
+		if sample.timestamp > avgCutoff {
+			sum += sample.speed
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, 0, false
+	}
+	return sum / float64(count), gust, true
+}
+
+// hubSeq records a hub_status seq and returns how many reports were missed
+// since the previous one. A seq at least rollover below the last one is a
+// hub reboot or counter rollover, so counting restarts from it; a smaller
+// drop is a late or duplicate report and is ignored.
+func (t *stationTracker) hubSeq(serial string, seq int, rollover int) (missed int, rolledOver bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := t.station(serial)
+	if !state.seqSeen {
+		state.seqSeen = true
+		state.LastSeq = seq
+		return 0, false
+	}
+
+	delta := seq - state.LastSeq
+	switch {
+	case delta > 0:
+		missed = delta - 1
+		state.LastSeq = seq
+	case delta <= -rollover:
+		rolledOver = true
+		state.LastSeq = seq
+	}
+	state.SeqMissed += missed
+	return missed, rolledOver
+}
+
+// maxRapidWindSeq bounds the rapid_wind_seq tag to keep its cardinality low
+const maxRapidWindSeq = 10
+
+// nextRapidWindSeq returns the rapid_wind_seq of a rapid wind with the given
+// timestamp: 0 for the first in its second, counting up to maxRapidWindSeq-1
+// and wrapping for further ones in the same second
+func (t *stationTracker) nextRapidWindSeq(serial string, timestamp int64) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := t.station(serial)
+	if timestamp != state.rapidWindSecond {
+		state.rapidWindSecond = timestamp
+		state.rapidWindSeq = 0
+		return 0
+	}
+	state.rapidWindSeq = (state.rapidWindSeq + 1) % maxRapidWindSeq
+	return state.rapidWindSeq
+}
+
+// setRapidWind caches the latest rapid wind fields for a station
+func (t *stationTracker) setRapidWind(serial string, fields map[string]string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.station(serial).rapidWind = fields
+}
+
+// takeRapidWind returns and clears the cached rapid wind fields for a
+// station, so a stalled rapid wind feed is not repeated on every obs
+func (t *stationTracker) takeRapidWind(serial string) map[string]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := t.station(serial)
+	fields := state.rapidWind
+	state.rapidWind = nil
+	return fields
+}
+
+// checkSilent marks stations not seen within timeout of now as silent and
+// clears the mark on stations heard from again, returning the stations that
+// changed each way since the last check
+func (t *stationTracker) checkSilent(now time.Time, timeout time.Duration) (silenced []string, returned []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for serial, state := range t.stations {
+		// State can exist before any packet, e.g. from a cached strike rate
+		if state.LastSeen.IsZero() {
+			continue
+		}
+
+		silent := now.Sub(state.LastSeen) > timeout
+		switch {
+		case silent && !state.Silent:
+			silenced = append(silenced, serial)
+		case !silent && state.Silent:
+			returned = append(returned, serial)
+		}
+		state.Silent = silent
+	}
+
+	sort.Strings(silenced)
+	sort.Strings(returned)
+	return silenced, returned
+}
+
+// addDaily adds an obs's totals to the station's running totals for day,
+// returning the updated totals. If the obs starts a new day the previous
+// day's final totals are returned too, before being reset. A late obs from
+// a day before the running one is not added, since that day's totals were
+// already written, and ok is false.
+func (t *stationTracker) addDaily(serial string, day string, add tempest.DailyTotals) (current tempest.DailyTotals, finished *tempest.DailyTotals, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := t.station(serial)
+	if day < state.Daily.Day {
+		return state.Daily, nil, false
+	}
+	if day > state.Daily.Day {
+		if state.Daily.Day != "" {
+			previous := state.Daily
+			finished = &previous
+		}
+		state.Daily = tempest.DailyTotals{Day: day}
+	}
+	state.Daily.Add(add)
+	return state.Daily, finished, true
+}
+
+// addTemp adds an obs's air temperature to the station's range for day,
+// starting a new range when the day changes. It returns the updated range
+// and, if the day changed, the previous day's final range. As with addDaily,
+// a late obs from an earlier day is not added and ok is false.
+func (t *stationTracker) addTemp(serial string, day string, temp float64) (current tempest.TempRange, finished *tempest.TempRange, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := t.station(serial)
+	if day < state.TempRange.Day {
+		return state.TempRange, nil, false
+	}
+	if day > state.TempRange.Day {
+		if state.TempRange.Count > 0 {
+			previous := state.TempRange
+			finished = &previous
+		}
+		state.TempRange = tempest.TempRange{Day: day}
+	}
+	state.TempRange.Add(temp)
+	return state.TempRange, finished, true
+}
+
+// rollTempRanges resets the range of every station still on a day before
+// day, returning their final ranges by station
+func (t *stationTracker) rollTempRanges(day string) map[string]tempest.TempRange {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	finished := make(map[string]tempest.TempRange)
+	for serial, state := range t.stations {
+		if state.TempRange.Count == 0 || state.TempRange.Day >= day {
+			continue
+		}
+		finished[serial] = state.TempRange
+		state.TempRange = tempest.TempRange{Day: day}
+	}
+	return finished
+}
+
+// rollDaily resets the totals of every station still accumulating a day
+// before day, returning their final totals by station
+func (t *stationTracker) rollDaily(day string) map[string]tempest.DailyTotals {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	finished := make(map[string]tempest.DailyTotals)
+	for serial, state := range t.stations {
+		if state.Daily.Day == "" || state.Daily.Day >= day {
+			continue
+		}
+		finished[serial] = state.Daily
+		state.Daily = tempest.DailyTotals{Day: day}
+	}
+	return finished
+}
+
+// daily returns the running totals of every station accumulating any
+func (t *stationTracker) daily() map[string]tempest.DailyTotals {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	totals := make(map[string]tempest.DailyTotals)
+	for serial, state := range t.stations {
+		if state.Daily.Day != "" {
+			totals[serial] = state.Daily
+		}
+	}
+	return totals
+}
@@ -0,0 +1,314 @@
+package processor
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/jacaudi/tempest-influxdb/internal/tempest"
+)
+
+func TestStationTrackerObserve(t *testing.T) {
+	tracker := newStationTracker()
+	now := time.Unix(1640995260, 0)
+
+	tracker.observe(tempest.Report{StationSerial: "ST-1", ReportType: "rapid_wind", Ob: [3]float64{1640995203, 1, 2}}, now)
+	tracker.observe(tempest.Report{StationSerial: "ST-1", ReportType: "rapid_wind", Ob: [3]float64{1640995206, 1, 2}}, now)
+	tracker.observe(tempest.Report{ReportType: "rapid_wind"}, now)
+
+	snapshot := tracker.snapshot()
+	if len(snapshot) != 1 {
+		t.Fatalf("Expected 1 station, got %d", len(snapshot))
+	}
+
+	state := snapshot["ST-1"]
+	if state.Packets["rapid_wind"] != 2 {
+		t.Errorf("Expected 2 rapid_wind packets, got %d", state.Packets["rapid_wind"])
+	}
+	if state.LastTimestamp["rapid_wind"] != 1640995206 {
+		t.Errorf("Expected last timestamp 1640995206, got %d", state.LastTimestamp["rapid_wind"])
+	}
+	if !state.LastSeen.Equal(now) {
+		t.Errorf("Expected last seen %v, got %v", now, state.LastSeen)
+	}
+}
+
+func TestStationTrackerSnapshotIsCopy(t *testing.T) {
+	tracker := newStationTracker()
+	tracker.observe(tempest.Report{StationSerial: "ST-1", ReportType: "obs_st"}, time.Now())
+
+	snapshot := tracker.snapshot()
+	snapshot["ST-1"].Packets["obs_st"] = 99
+
+	if tracker.snapshot()["ST-1"].Packets["obs_st"] != 1 {
+		t.Error("Modifying a snapshot changed tracker state")
+	}
+}
+
+func TestStationTrackerAllowObsWrite(t *testing.T) {
+	tracker := newStationTracker()
+	interval := 50 * time.Second
+
+	if !tracker.allowObsWrite("ST-1", 1640995200, interval) {
+		t.Error("Expected first obs to be allowed")
+	}
+	if tracker.allowObsWrite("ST-1", 1640995210, interval) {
+		t.Error("Expected obs 10s later to be dropped")
+	}
+	if !tracker.allowObsWrite("ST-2", 1640995210, interval) {
+		t.Error("Expected another station's obs to be allowed")
+	}
+	if !tracker.allowObsWrite("ST-1", 1640995260, interval) {
+		t.Error("Expected obs 60s after the last written one to be allowed")
+	}
+
+	if throttled := tracker.snapshot()["ST-1"].Throttled; throttled != 1 {
+		t.Errorf("Expected 1 throttled obs, got %d", throttled)
+	}
+}
+
+func TestStationTrackerSetObsVersion(t *testing.T) {
+	tracker := newStationTracker()
+
+	for i, tt := range []struct {
+		version int
+		changed bool
+	}{
+		{1, true},
+		{1, false},
+		{2, true},
+	} {
+		if got := tracker.setObsVersion("ST-1", tt.version); got != tt.changed {
+			t.Errorf("Step %d: expected changed %v for version %d, got %v", i, tt.changed, tt.version, got)
+		}
+	}
+	if got := tracker.snapshot()["ST-1"].ObsVersion; got != 2 {
+		t.Errorf("Expected obs version 2, got %d", got)
+	}
+}
+
+func TestStationTrackerStrikeRate(t *testing.T) {
+	tracker := newStationTracker()
+	start := int64(1640995200)
+
+	// One obs a minute: 2 strikes, then 3, then nothing for a while
+	steps := []struct {
+		offset int64
+		count  int
+		want   int
+	}{
+		{0, 2, 2},
+		{60, 3, 5},
+		{120, 0, 5},
+		{599, 0, 5},
+		{600, 0, 3}, // the first sample has left the window
+		{660, 1, 1}, // so has the second
+		{1259, 0, 1},
+		{1260, 0, 0}, // the last strike is now 10 minutes old
+	}
+
+	for _, step := range steps {
+		got := tracker.strikeRate("ST-1", start+step.offset, step.count, 10*time.Minute)
+		if got != step.want {
+			t.Errorf("At +%ds expected rate %d, got %d", step.offset, step.want, got)
+		}
+	}
+
+	if other := tracker.strikeRate("ST-2", start, 0, 10*time.Minute); other != 0 {
+		t.Errorf("Expected stations to have separate windows, got %d", other)
+	}
+}
+
+func TestStationTrackerWindStats(t *testing.T) {
+	tracker := newStationTracker()
+	start := int64(1640995200)
+
+	if _, _, ok := tracker.windStats("ST-1", start, 2*time.Minute, 10*time.Minute); ok {
+		t.Error("Expected no wind stats without samples")
+	}
+
+	// A 12 m/s gust, then steady 4 and 6 m/s more than 2 minutes later
+	tracker.addWindSample("ST-1", start, 12, 10*time.Minute)
+	for offset := int64(200); offset <= 300; offset += 3 {
+		speed := 4.0
+		if offset%2 == 1 {
+			speed = 6
+		}
+		tracker.addWindSample("ST-1", start+offset, speed, 10*time.Minute)
+	}
+
+	avg, gust, ok := tracker.windStats("ST-1", start+300, 2*time.Minute, 10*time.Minute)
+	if !ok || math.Abs(avg-5) > 0.1 || gust != 12 {
+		t.Errorf("Expected a 5 m/s average and 12 m/s gust, got %v, %v, %v", avg, gust, ok)
+	}
+
+	// Adding a sample 10 minutes on prunes the old gust
+	tracker.addWindSample("ST-1", start+600, 3, 10*time.Minute)
+	if _, gust, _ := tracker.windStats("ST-1", start+600, 2*time.Minute, 10*time.Minute); gust != 6 {
+		t.Errorf("Expected the 12 m/s gust to have left the window, got %v", gust)
+	}
+	if got := len(tracker.snapshot()["ST-1"].wind); got != 35 {
+		t.Errorf("Expected 35 samples kept, got %d", got)
+	}
+}
+
+func TestStationTrackerHubSeq(t *testing.T) {
+	tracker := newStationTracker()
+
+	steps := []struct {
+		seq        int
+		missed     int
+		rolledOver bool
+	}{
+		{65530, 0, false}, // the first seq only sets the baseline
+		{65531, 0, false},
+		{65534, 2, false},
+		{65533, 0, false}, // late, not a gap or rollover
+		{0, 0, true},      // rolled over, not a gap of -65534
+		{1, 0, false},
+		{4, 2, false},
+	}
+
+	for _, step := range steps {
+		missed, rolledOver := tracker.hubSeq("HB-1", step.seq, 100)
+		if missed != step.missed || rolledOver != step.rolledOver {
+			t.Errorf("At seq %d expected %d missed and rollover %v, got %d and %v",
+				step.seq, step.missed, step.rolledOver, missed, rolledOver)
+		}
+	}
+
+	if got := tracker.snapshot()["HB-1"].SeqMissed; got != 4 {
+		t.Errorf("Expected 4 missed in total, got %d", got)
+	}
+}
+
+func TestStationTrackerNextRapidWindSeq(t *testing.T) {
+	tracker := newStationTracker()
+	start := int64(1640995200)
+
+	for want := 0; want < maxRapidWindSeq; want++ {
+		if got := tracker.nextRapidWindSeq("ST-1", start); got != want {
+			t.Errorf("Expected seq %d within the second, got %d", want, got)
+		}
+	}
+	if got := tracker.nextRapidWindSeq("ST-1", start); got != 0 {
+		t.Errorf("Expected the seq to wrap at %d, got %d", maxRapidWindSeq, got)
+	}
+	if got := tracker.nextRapidWindSeq("ST-1", start+3); got != 0 {
+		t.Errorf("Expected the seq to reset for a new second, got %d", got)
+	}
+	if got := tracker.nextRapidWindSeq("ST-2", start+3); got != 0 {
+		t.Errorf("Expected stations to count separately, got %d", got)
+	}
+}
+
+func TestStationTrackerCheckSilent(t *testing.T) {
+	tracker := newStationTracker()
+	start := time.Unix(1640995200, 0)
+	timeout := 5 * time.Minute
+
+	tracker.observe(tempest.Report{StationSerial: "ST-1", ReportType: "obs_st"}, start)
+	tracker.observe(tempest.Report{StationSerial: "ST-2", ReportType: "obs_st"}, start)
+
+	if silenced, returned := tracker.checkSilent(start.Add(time.Minute), timeout); len(silenced) != 0 || len(returned) != 0 {
+		t.Fatalf("Expected no changes within the timeout, got silenced %v returned %v", silenced, returned)
+	}
+
+	// ST-2 keeps reporting while ST-1 goes quiet past the timeout
+	tracker.observe(tempest.Report{StationSerial: "ST-2", ReportType: "obs_st"}, start.Add(4*time.Minute))
+	silenced, _ := tracker.checkSilent(start.Add(6*time.Minute), timeout)
+	if len(silenced) != 1 || silenced[0] != "ST-1" {
+		t.Fatalf("Expected ST-1 to go silent, got %v", silenced)
+	}
+	if !tracker.snapshot()["ST-1"].Silent {
+		t.Error("Expected ST-1 to be marked silent")
+	}
+
+	// A silent station is only reported once
+	if silenced, _ := tracker.checkSilent(start.Add(7*time.Minute), timeout); len(silenced) != 0 {
+		t.Errorf("Expected silence to be reported once, got %v", silenced)
+	}
+
+	tracker.observe(tempest.Report{StationSerial: "ST-1", ReportType: "obs_st"}, start.Add(8*time.Minute))
+	_, returned := tracker.checkSilent(start.Add(8*time.Minute), timeout)
+	if len(returned) != 1 || returned[0] != "ST-1" {
+		t.Errorf("Expected ST-1 to return, got %v", returned)
+	}
+}
+
+func TestStationTrackerAddTemp(t *testing.T) {
+	tracker := newStationTracker()
+
+	for _, temp := range []float64{12, 15.5, 21, 18, 9.5} {
+		tracker.addTemp("ST-1", "2024-06-01", temp)
+	}
+	got, finished, _ := tracker.addTemp("ST-1", "2024-06-01", 10)
+	if got.Min != 9.5 || got.Max != 21 || got.Count != 6 || finished != nil {
+		t.Errorf("Expected a 9.5 to 21 range over 6 obs, got %+v finishing %v", got, finished)
+	}
+
+	got, finished, _ = tracker.addTemp("ST-1", "2024-06-02", 8)
+	if got.Day != "2024-06-02" || got.Min != 8 || got.Max != 8 {
+		t.Errorf("Expected the range to restart on June 2nd, got %+v", got)
+	}
+	if finished == nil || finished.Day != "2024-06-01" || finished.Max != 21 {
+		t.Errorf("Expected June 1st's range to be returned as finished, got %+v", finished)
+	}
+	if got, _, _ := tracker.addTemp("ST-2", "2024-06-01", 30); got.Min != 30 || got.Max != 30 {
+		t.Errorf("Expected stations to be tracked separately, got %+v", got)
+	}
+
+	// A late obs from June 1st leaves June 2nd's range alone
+	got, finished, ok := tracker.addTemp("ST-1", "2024-06-01", 25)
+	if ok || finished != nil || got.Day != "2024-06-02" || got.Max != 8 {
+		t.Errorf("Expected a late obs to be left out, got %+v finishing %+v ok %v", got, finished, ok)
+	}
+	if got, finished, _ := tracker.addTemp("ST-1", "2024-06-02", 11); got.Count != 2 || got.Max != 11 || finished != nil {
+		t.Errorf("Expected June 2nd's range to continue, got %+v finishing %+v", got, finished)
+	}
+}
+
+func TestStationTrackerRollTempRanges(t *testing.T) {
+	tracker := newStationTracker()
+	tracker.addTemp("ST-1", "2024-06-01", 12)
+	tracker.addTemp("ST-2", "2024-06-02", 15)
+
+	finished := tracker.rollTempRanges("2024-06-02")
+	if len(finished) != 1 || finished["ST-1"].Max != 12 {
+		t.Fatalf("Expected only ST-1's June 1st range, got %+v", finished)
+	}
+	if got, previous, _ := tracker.addTemp("ST-1", "2024-06-02", 20); got.Count != 1 || previous != nil {
+		t.Errorf("Expected a rolled range to start the new day empty, got %+v finishing %v", got, previous)
+	}
+}
+
+func TestStationTrackerAddDaily(t *testing.T) {
+	tracker := newStationTracker()
+	rain := tempest.DailyTotals{Rain: 1}
+
+	tracker.addDaily("ST-1", "2024-06-01", rain)
+	if current, finished, _ := tracker.addDaily("ST-1", "2024-06-01", rain); current.Rain != 2 || finished != nil {
+		t.Errorf("Expected 2mm without a finished day, got %+v %+v", current, finished)
+	}
+
+	current, finished, _ := tracker.addDaily("ST-1", "2024-06-02", rain)
+	if finished == nil || finished.Day != "2024-06-01" || finished.Rain != 2 {
+		t.Errorf("Expected June 1st to finish with 2mm, got %+v", finished)
+	}
+	if current.Day != "2024-06-02" || current.Rain != 1 {
+		t.Errorf("Expected June 2nd to start with 1mm, got %+v", current)
+	}
+
+	if rolled := tracker.rollDaily("2024-06-02"); len(rolled) != 0 {
+		t.Errorf("Expected nothing to roll within the same day, got %v", rolled)
+	}
+
+	// A late obs from June 1st neither finishes June 2nd nor resets it
+	current, finished, ok := tracker.addDaily("ST-1", "2024-06-01", rain)
+	if ok || finished != nil || current.Day != "2024-06-02" || current.Rain != 1 {
+		t.Errorf("Expected a late obs to be left out, got %+v finishing %+v ok %v", current, finished, ok)
+	}
+	if current, finished, _ := tracker.addDaily("ST-1", "2024-06-02", rain); current.Rain != 2 || finished != nil {
+		t.Errorf("Expected June 2nd to continue with 2mm, got %+v finishing %+v", current, finished)
+	}
+}
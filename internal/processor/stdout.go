@@ -0,0 +1,37 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+	"github.com/jacaudi/tempest-influxdb/internal/influx"
+	"github.com/jacaudi/tempest-influxdb/internal/tempest"
+)
+
+// JSONWriter writes each point as a JSON tempest.Observation on its own
+// line, for piping into tools such as jq
+type JSONWriter struct {
+	config *config.Config
+
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONWriter creates a JSONWriter writing to out
+func NewJSONWriter(cfg *config.Config, out io.Writer) *JSONWriter {
+	return &JSONWriter{config: cfg, enc: json.NewEncoder(out)}
+}
+
+// Write writes m as one JSON line to stdout, or whichever output the
+// JSONWriter was created with
+func (w *JSONWriter) Write(_ context.Context, m *influx.Data) error {
+	obs := tempest.NewObservation(w.config, m)
+
+	// Lines from concurrent packets must not interleave
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.enc.Encode(obs)
+}
@@ -0,0 +1,68 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+	"github.com/jacaudi/tempest-influxdb/internal/logger"
+)
+
+func TestJSONWriter(t *testing.T) {
+	var out bytes.Buffer
+	cfg := &config.Config{Influx_Bucket: "test-bucket", Rapid_Wind: true}
+	service := newTestService(t, cfg)
+	service.writers = []Writer{NewJSONWriter(cfg, &out)}
+
+	wind := `{"serial_number": "ST-123456", "type": "rapid_wind", "ob": [1640995200, 5.5, 270]}`
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	for _, packet := range []string{testObsPacket, wind} {
+		service.processPacket(context.Background(), addr, []byte(packet), len(packet))
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected one JSON line per point, got %q", out.String())
+	}
+	for _, want := range []string{
+		`"measurement":"weather"`,
+		`"time":"2022-01-01T00:00:00Z"`,
+		`"tags":{"station":"ST-123456"}`,
+		`"temp":25.5`,
+		`"wind_direction":180`,
+	} {
+		if !strings.Contains(lines[0], want) {
+			t.Errorf("Expected %s in obs line %s", want, lines[0])
+		}
+	}
+	if !strings.Contains(lines[1], `"rapid_wind_speed":5.5`) {
+		t.Errorf("Expected rapid wind speed in %s", lines[1])
+	}
+}
+
+func TestNewPipelineJSONStdout(t *testing.T) {
+	tests := []struct {
+		noop bool
+		want int
+	}{
+		{false, 2},
+		{true, 1},
+	}
+
+	for _, tt := range tests {
+		cfg := &config.Config{Influx_URL: "http://localhost:8086", Buffer: 1024, JSON_Stdout: true, Noop: tt.noop}
+		ws, err := newPipeline(cfg, logger.New(&config.Config{}))
+		if err != nil {
+			t.Fatalf("newPipeline() error = %v", err)
+		}
+		if len(ws.writers) != tt.want {
+			t.Errorf("With noop %v expected %d writers, got %d", tt.noop, tt.want, len(ws.writers))
+		}
+		if _, ok := ws.writers[len(ws.writers)-1].(*JSONWriter); !ok {
+			t.Errorf("Expected a JSONWriter, got %T", ws.writers[len(ws.writers)-1])
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"net"
 	"net/http"
+
+	"github.com/jacaudi/tempest-influxdb/internal/influx"
 )
 
 // UDPListener interface for UDP operations
@@ -26,6 +28,11 @@ type Logger interface {
 	Warn(msg string, args ...interface{})
 }
 
+// Writer sends points to an output, such as InfluxDB over HTTP
+type Writer interface {
+	Write(ctx context.Context, m *influx.Data) error
+}
+
 // PacketProcessor interface for processing weather data packets
 type PacketProcessor interface {
 	ProcessPacket(ctx context.Context, addr *net.UDPAddr, data []byte, length int) error
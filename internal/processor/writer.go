@@ -0,0 +1,463 @@
+package processor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+	"github.com/jacaudi/tempest-influxdb/internal/influx"
+	"github.com/jacaudi/tempest-influxdb/internal/logger"
+	"github.com/samber/lo"
+)
+
+// runner is implemented by writers with background work, such as flushing
+// batches. run returns once stop is closed and any final work is done.
+type runner interface {
+	run(stop <-chan struct{})
+}
+
+// InfluxHTTPWriter writes points to the InfluxDB (or compatible) HTTP line
+// protocol API, with optional batching, retries and a disk spool
+type InfluxHTTPWriter struct {
+	config    *config.Config
+	logger    *logger.AppLogger
+	client    *http.Client
+	influxURL *url.URL
+	batcher   *batcher
+	spool     *spool
+
+	// breaker skips writes while InfluxDB keeps failing, if enabled
+	breaker *breaker
+
+	// replaying guards against concurrent spool replays
+	replaying atomic.Bool
+}
+
+// NewInfluxHTTPWriter creates an InfluxHTTPWriter
+func NewInfluxHTTPWriter(cfg *config.Config, appLogger *logger.AppLogger) (*InfluxHTTPWriter, error) {
+	influxURL, err := buildInfluxURL(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &InfluxHTTPWriter{
+		config:    cfg,
+		logger:    appLogger,
+		client:    createOptimizedHTTPClient(),
+		influxURL: influxURL,
+	}
+
+	// Pooled connections already avoid most lookups; the cache covers the
+	// reconnects after idle timeouts and server restarts
+	if cfg.DNS_Cache_TTL > 0 {
+		transport := w.client.Transport.(*http.Transport)
+		transport.DialContext = newCachingDialer(net.DefaultResolver, transport.DialContext, cfg.DNS_Cache_TTL).DialContext
+	}
+
+	switch {
+	case cfg.Spool_Dir != "" && cfg.Spool_Rotate:
+		w.spool, err = newRotatingSpool(cfg.Spool_Dir, cfg.Spool_Compress, cfg.Spool_Retention)
+	case cfg.Spool_Dir != "":
+		w.spool, err = newSpool(cfg.Spool_Dir, cfg.Spool_Compress)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Batch_Size > 0 {
+		w.batcher = newBatcher(cfg.Batch_Size, w.writeBatch)
+	}
+
+	if cfg.Breaker_Failure_Threshold > 0 {
+		w.breaker = newBreaker(cfg.Breaker_Failure_Threshold, cfg.Breaker_Cooldown)
+	}
+
+	return w, nil
+}
+
+// Write marshals m and posts it, or queues it when batching. Delivery
+// failures are retried, spooled and logged by the writer itself, so the
+// returned error is always nil.
+func (w *InfluxHTTPWriter) Write(ctx context.Context, m *influx.Data) error {
+	line := m.Marshal()
+	writeURL := w.pointURL(m)
+	if w.config.Verbose {
+		w.logger.Info("Posting data to InfluxDB",
+			"data", line,
+			"url", writeURL)
+	}
+
+	if w.batcher != nil {
+		w.batcher.add(ctx, writeURL, line)
+		return nil
+	}
+
+	w.write(ctx, writeURL, line)
+	return nil
+}
+
+// run flushes batches until stop is closed
+func (w *InfluxHTTPWriter) run(stop <-chan struct{}) {
+	if w.batcher == nil {
+		<-stop
+		return
+	}
+	w.batcher.run(stop, w.config.Batch_Interval)
+}
+
+// writeURL returns the InfluxDB write URL for the given bucket
+func (w *InfluxHTTPWriter) writeURL(bucket string) string {
+	u := *w.influxURL
+	if bucket != "" {
+		// Set query arguments, preserving existing parameters like org.
+		// VictoriaMetrics has no buckets, so db becomes a label there, and
+		// InfluxDB 3.x writes to the database named by db.
+		query := u.Query()
+		if w.config.UsesDB() {
+			query.Set("db", bucket)
+		} else {
+			query.Set("bucket", bucket)
+		}
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+// pointURL returns the write URL for m, honoring its bucket, organization
+// and precision
+func (w *InfluxHTTPWriter) pointURL(m *influx.Data) string {
+	writeURL := w.writeURL(m.Bucket)
+	if m.Org != "" && m.Org != w.config.Influx_Org && !w.config.UsesDB() {
+		writeURL = withQuery(writeURL, "org", m.Org)
+	}
+	if m.Precision != "" {
+		writeURL = withQuery(writeURL, "precision", precisionParam(w.config, m.Precision))
+	}
+	return writeURL
+}
+
+// v3Precisions are the InfluxDB 3.x write_lp names of each precision
+var v3Precisions = map[string]string{
+	config.PrecisionSeconds:      "second",
+	config.PrecisionMilliseconds: "millisecond",
+	config.PrecisionMicroseconds: "microsecond",
+	config.PrecisionNanoseconds:  "nanosecond",
+}
+
+// precisionParam returns the precision query argument for precision, which
+// InfluxDB 3.x spells out in full
+func precisionParam(cfg *config.Config, precision string) string {
+	if name, ok := v3Precisions[precision]; ok && cfg.Influx_Version == config.InfluxV3 && cfg.Output_Backend != config.BackendVictoriaMetrics {
+		return name
+	}
+	return precision
+}
+
+// withQuery returns writeURL with the named query argument replaced
+func withQuery(writeURL string, name string, value string) string {
+	u, err := url.Parse(writeURL)
+	if err != nil {
+		return writeURL
+	}
+	query := u.Query()
+	query.Set(name, value)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// writeBatch posts a batch of lines to InfluxDB. With Batch_Retry_Budget
+// set, one bad line no longer loses the whole batch: the lines InfluxDB
+// accepts are found and rewritten.
+func (w *InfluxHTTPWriter) writeBatch(ctx context.Context, writeURL string, lines []string) {
+	if w.config.Verbose {
+		w.logger.Info("Flushing batch to InfluxDB",
+			"lines", len(lines),
+			"url", writeURL)
+	}
+	rejection := w.write(ctx, writeURL, joinLines(lines))
+	if rejection == "" || w.config.Batch_Retry_Budget <= 0 {
+		return
+	}
+
+	budget := w.config.Batch_Retry_Budget
+	w.isolateRejected(ctx, writeURL, lines, rejection, &budget)
+}
+
+// write posts line protocol to InfluxDB, retrying failed attempts. Writes
+// that still fail with a transient error are spooled to disk if a spool is
+// configured, and spooled writes are replayed after the next success.
+//
+// Retries are idempotent: the body is marshalled once before the first
+// attempt and reused unchanged, and every point carries its station timestamp
+// as the InfluxDB time. If an attempt succeeded but its response was lost, the
+// retry overwrites the same (measurement, tags, time) points rather than
+// duplicating them.
+//
+// If InfluxDB rejects the write, which retrying won't change, it returns
+// InfluxDB's explanation.
+func (w *InfluxHTTPWriter) write(ctx context.Context, writeURL string, body string) (rejection string) {
+	for attempt := 0; ; attempt++ {
+		if w.breaker != nil && !w.breaker.allow(time.Now()) {
+			w.skipWrite(writeURL, body)
+			return ""
+		}
+
+		delivered, retry, rejection := w.post(ctx, writeURL, body)
+		w.recordOutcome(delivered, retry)
+		if delivered {
+			w.replaySpool(ctx)
+			return ""
+		}
+		if !retry {
+			return rejection
+		}
+		if attempt >= w.config.Write_Retries {
+			w.spoolWrite(writeURL, body)
+			return ""
+		}
+
+		backoff := retryBackoff(w.config.Retry_Backoff, attempt)
+		w.logger.Warn("Retrying InfluxDB write",
+			"attempt", attempt+1,
+			"backoff", backoff.String())
+
+		select {
+		case <-ctx.Done():
+			w.spoolWrite(writeURL, body)
+			return ""
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// maxRetryBackoff caps the delay between write retries, so a long run of
+// retries neither waits for hours nor overflows the doubling
+const maxRetryBackoff = 5 * time.Minute
+
+// retryBackoff returns the delay before retry attempt+1, base doubled each
+// attempt up to maxRetryBackoff
+func retryBackoff(base time.Duration, attempt int) time.Duration {
+	if base > maxRetryBackoff>>attempt {
+		return maxRetryBackoff
+	}
+	return base << attempt
+}
+
+// recordOutcome updates the breaker with the result of a write attempt.
+// Rejected points, such as a field type conflict, count as a success since
+// InfluxDB answered, which also ends a rejected probe; only transient
+// failures count against it.
+func (w *InfluxHTTPWriter) recordOutcome(delivered bool, retry bool) {
+	switch {
+	case w.breaker == nil:
+	case delivered || !retry:
+		w.breaker.success()
+	case retry:
+		if w.breaker.failure(time.Now()) {
+			w.logger.Warn("InfluxDB writes failing, skipping writes until the breaker cooldown ends",
+				"failures", w.config.Breaker_Failure_Threshold,
+				"cooldown", w.config.Breaker_Cooldown.String())
+		}
+	}
+}
+
+// skipWrite spools a write skipped while the breaker is open. It logs only
+// at debug level since every write is skipped until the cooldown ends.
+func (w *InfluxHTTPWriter) skipWrite(writeURL string, body string) {
+	if w.logger.DebugEnabled() {
+		w.logger.Debug("Breaker open, skipping InfluxDB write", "url", writeURL)
+	}
+	if w.spool == nil {
+		return
+	}
+	if err := w.spool.append(spoolRecord{URL: writeURL, Body: body}); err != nil {
+		w.logger.Error("Failed to spool write", "error", err.Error())
+	}
+}
+
+// spoolWrite saves an undeliverable write to the spool, if one is configured
+func (w *InfluxHTTPWriter) spoolWrite(writeURL string, body string) {
+	if w.spool == nil {
+		return
+	}
+
+	if err := w.spool.append(spoolRecord{URL: writeURL, Body: body}); err != nil {
+		w.logger.Error("Failed to spool write", "error", err.Error())
+		return
+	}
+	w.logger.Warn("Spooled undeliverable write", "url", writeURL)
+}
+
+// replaySpool resends spooled writes. Only one replay runs at a time and
+// records that still can't be delivered go back into the spool.
+func (w *InfluxHTTPWriter) replaySpool(ctx context.Context) {
+	if w.spool == nil || !w.replaying.CompareAndSwap(false, true) {
+		return
+	}
+	defer w.replaying.Store(false)
+
+	records, err := w.spool.take()
+	if err != nil {
+		w.logger.Error("Failed to read spool", "error", err.Error())
+	}
+	if len(records) == 0 {
+		return
+	}
+
+	w.logger.Info("Replaying spooled writes", "records", len(records))
+	for i, record := range records {
+		if delivered, _, _ := w.post(ctx, record.URL, record.Body); delivered {
+			continue
+		}
+		for _, remaining := range records[i:] {
+			w.spoolWrite(remaining.URL, remaining.Body)
+		}
+		return
+	}
+}
+
+// newRequest creates a write request for body with the configured headers
+func (w *InfluxHTTPWriter) newRequest(ctx context.Context, writeURL string, body string) (*http.Request, error) {
+	cfg := w.config
+
+	request, err := http.NewRequestWithContext(ctx, "POST", writeURL, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case cfg.Output_Backend == config.BackendVictoriaMetrics && cfg.Influx_Token != "":
+		request.Header.Set("Authorization", "Bearer "+cfg.Influx_Token)
+	case cfg.Output_Backend != config.BackendVictoriaMetrics && cfg.Influx_Version == config.InfluxV3:
+		request.Header.Set("Authorization", "Bearer "+cfg.Influx_Token)
+	case cfg.Output_Backend != config.BackendVictoriaMetrics:
+		request.Header.Set("Authorization", "Token "+cfg.Influx_Token)
+	}
+	request.Header.Set("Content-Type", lo.CoalesceOrEmpty(cfg.Content_Type, config.DefaultContentType))
+	request.Header.Set("Accept", "application/json")
+	if cfg.Idempotency_Key {
+		request.Header.Set("Idempotency-Key", idempotencyKey(body))
+	}
+	return request, nil
+}
+
+// post makes a single write request to InfluxDB and reports whether it was
+// delivered and, if not, whether the failure is worth retrying. When
+// InfluxDB rejects the write, rejection is its explanation.
+func (w *InfluxHTTPWriter) post(ctx context.Context, writeURL string, body string) (delivered bool, retry bool, rejection string) {
+	cfg := w.config
+	logger := w.logger
+
+	request, err := w.newRequest(ctx, writeURL, body)
+	if err != nil {
+		logger.Error("Failed to create HTTP request",
+			"error", err.Error(),
+			"url", writeURL)
+		return false, false, ""
+	}
+
+	if cfg.Noop {
+		logger.Info("NOOP mode - not posting to InfluxDB",
+			"url", writeURL)
+		return false, false, ""
+	}
+
+	// Use Lo library for safer HTTP request handling
+	resp, ok := lo.TryOr(func() (*http.Response, error) {
+		return w.client.Do(request)
+	}, nil)
+
+	if !ok || resp == nil {
+		if errors.Is(context.Cause(ctx), errDrainElapsed) {
+			logger.Warn("Abandoned InfluxDB write still in flight at the end of shutdown",
+				"influx_url", cfg.Influx_URL)
+			return false, true, ""
+		}
+		logger.Error("Failed to post data to InfluxDB",
+			"influx_url", cfg.Influx_URL)
+		return false, true, ""
+	}
+
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= 400 {
+		detail := errorResponse(resp.Body)
+		logger.Error("InfluxDB returned error status",
+			"status", resp.Status,
+			"status_code", resp.StatusCode,
+			"response", detail)
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			return false, true, ""
+		}
+		return false, false, detail
+	} else if cfg.Verbose {
+		logger.Info("Successfully posted data to InfluxDB",
+			"status", resp.Status,
+			"status_code", resp.StatusCode)
+	}
+	return true, false, ""
+}
+
+// maxErrorResponse limits how much of an error response is read and logged
+const maxErrorResponse = 1024
+
+// errorResponse returns the explanation in an error response body, such as
+// a field type conflict. InfluxDB v2 sends JSON with a message; other
+// backends send plain text, which is returned as is. Long bodies are
+// truncated.
+func errorResponse(body io.Reader) string {
+	data, _ := io.ReadAll(io.LimitReader(body, maxErrorResponse+1))
+	truncated := len(data) > maxErrorResponse
+	if truncated {
+		data = data[:maxErrorResponse]
+	}
+
+	var influxError struct {
+		Message string `json:"message"`
+	}
+	if !truncated && json.Unmarshal(data, &influxError) == nil && influxError.Message != "" {
+		return influxError.Message
+	}
+
+	detail := strings.TrimSpace(string(data))
+	if truncated {
+		detail += "..."
+	}
+	return detail
+}
+
+// idempotencyKey derives a stable key for a write body. Each line carries the
+// measurement, station tag and timestamp, so retries and spool replays of the
+// same points produce the same key while different points do not.
+func idempotencyKey(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+// buildInfluxURL parses the Influx URL, appends the API path and sets the
+// query arguments shared by every write
+func buildInfluxURL(cfg *config.Config) (*url.URL, error) {
+	influxURL, err := url.Parse(cfg.WriteURL())
+	if err != nil {
+		return nil, err
+	}
+
+	query := influxURL.Query()
+	// Some gateways reject an org parameter entirely, so omit it when unset
+	if cfg.Influx_Org != "" && !cfg.UsesDB() {
+		query.Set("org", cfg.Influx_Org)
+	}
+	query.Set("precision", precisionParam(cfg, lo.CoalesceOrEmpty(cfg.Precision, config.DefaultPrecision)))
+	influxURL.RawQuery = query.Encode()
+
+	return influxURL, nil
+}
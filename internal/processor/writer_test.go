@@ -0,0 +1,116 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+	"github.com/jacaudi/tempest-influxdb/internal/influx"
+	"github.com/jacaudi/tempest-influxdb/internal/logger"
+)
+
+// recordingWriter is a Writer that keeps every point written to it
+type recordingWriter struct {
+	mu     sync.Mutex
+	points []*influx.Data
+}
+
+func (w *recordingWriter) Write(_ context.Context, m *influx.Data) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.points = append(w.points, m)
+	return nil
+}
+
+func TestProcessPacketWritesToEveryWriter(t *testing.T) {
+	first := &recordingWriter{}
+	second := &recordingWriter{}
+	service := &WeatherService{
+		config:       &config.Config{Influx_Bucket: "test-bucket"},
+		logger:       logger.New(&config.Config{}),
+		writers:      []Writer{first, second},
+		stations:     newStationTracker(),
+		parseLatency: newParseLatency(),
+	}
+
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	service.processPacket(context.Background(), addr, []byte(testObsPacket), len(testObsPacket))
+
+	for _, writer := range []*recordingWriter{first, second} {
+		if len(writer.points) != 1 {
+			t.Fatalf("Expected 1 point, got %d", len(writer.points))
+		}
+		m := writer.points[0]
+		if m.Name != "weather" || m.Bucket != "test-bucket" || m.Tags["station"] != "ST-123456" {
+			t.Errorf("Unexpected point %+v", m)
+		}
+		if m.Fields["temp"] != "25.50" {
+			t.Errorf("Expected temp=25.50, got %s", m.Fields["temp"])
+		}
+	}
+}
+
+func TestWriteLogsErrorResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_, _ = w.Write([]byte(`{"code":"unprocessable entity","message":"failure writing points to database: partial write: field type conflict: input field \"temp\" on measurement \"weather\" is type integer, already exists as type float dropped=1"}`))
+	}))
+	defer server.Close()
+
+	service := newTestService(t, &config.Config{Influx_URL: server.URL})
+	var logs bytes.Buffer
+	writer := httpWriter(service)
+	writer.logger = &logger.AppLogger{Logger: slog.New(slog.NewJSONHandler(&logs, nil))}
+
+	writer.write(context.Background(), writer.writeURL("test-bucket"), "weather,station=ST-1 temp=1i 1\n")
+
+	if !strings.Contains(logs.String(), `"response":"failure writing points to database: partial write: field type conflict`) {
+		t.Errorf("Expected the error message to be logged, got %s", logs.String())
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		base    time.Duration
+		attempt int
+		want    time.Duration
+	}{
+		{time.Second, 0, time.Second},
+		{time.Second, 3, 8 * time.Second},
+		{time.Second, 10, maxRetryBackoff},
+		{time.Second, 70, maxRetryBackoff},
+		{time.Hour, 0, maxRetryBackoff},
+		{0, 70, 0},
+	}
+
+	for _, tt := range tests {
+		if got := retryBackoff(tt.base, tt.attempt); got != tt.want {
+			t.Errorf("retryBackoff(%s, %d) = %s, want %s", tt.base, tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestErrorResponse(t *testing.T) {
+	long := strings.Repeat("x", 2*maxErrorResponse)
+	tests := map[string]string{
+		`{"code":"invalid","message":"unable to parse 'weather temp=': missing field value"}`: "unable to parse 'weather temp=': missing field value",
+		"  bad request\n":        "bad request",
+		`{"error":"no message"}`: `{"error":"no message"}`,
+		long:                     long[:maxErrorResponse] + "...",
+	}
+
+	for body, want := range tests {
+		if got := errorResponse(strings.NewReader(body)); got != want {
+			t.Errorf("errorResponse(%.40q) = %.40q, want %.40q", body, got, want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package tempest
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+)
+
+// ObservationAvroSchema is the Avro schema of MarshalAvro's encoding. Field
+// values are a union of the types NewObservation produces.
+const ObservationAvroSchema = `{
+  "type": "record",
+  "name": "Observation",
+  "namespace": "tempest",
+  "fields": [
+    {"name": "measurement", "type": "string"},
+    {"name": "time", "type": {"type": "long", "logicalType": "timestamp-micros"}},
+    {"name": "tags", "type": {"type": "map", "values": "string"}},
+    {"name": "fields", "type": {"type": "map", "values": ["double", "long", "string"]}}
+  ]
+}`
+
+// Branches of the fields value union in ObservationAvroSchema
+const (
+	avroDouble = iota
+	avroLong
+	avroString
+)
+
+// MarshalAvro encodes o in the Avro binary encoding of
+// ObservationAvroSchema, without a container or schema registry header.
+// Map entries are written sorted by key so equal observations encode alike.
+func (o Observation) MarshalAvro() []byte {
+	b := appendAvroString(nil, o.Measurement)
+	b = appendAvroLong(b, o.Time.UnixMicro())
+
+	b = appendAvroLong(b, int64(len(o.Tags)))
+	for _, tag := range sortedKeys(o.Tags) {
+		b = appendAvroString(b, tag)
+		b = appendAvroString(b, o.Tags[tag])
+	}
+	if len(o.Tags) > 0 {
+		b = appendAvroLong(b, 0)
+	}
+
+	b = appendAvroLong(b, int64(len(o.Fields)))
+	for _, name := range sortedKeys(o.Fields) {
+		b = appendAvroString(b, name)
+		switch value := o.Fields[name].(type) {
+		case int64:
+			b = appendAvroLong(b, avroLong)
+			b = appendAvroLong(b, value)
+		case float64:
+			b = appendAvroLong(b, avroDouble)
+			b = binary.LittleEndian.AppendUint64(b, math.Float64bits(value))
+		default:
+			s, _ := value.(string)
+			b = appendAvroLong(b, avroString)
+			b = appendAvroString(b, s)
+		}
+	}
+	if len(o.Fields) > 0 {
+		b = appendAvroLong(b, 0)
+	}
+	return b
+}
+
+// appendAvroLong appends an Avro long, a zigzag encoded varint
+func appendAvroLong(b []byte, v int64) []byte {
+	return binary.AppendVarint(b, v)
+}
+
+// appendAvroString appends an Avro string, its length and then its bytes
+func appendAvroString(b []byte, s string) []byte {
+	return append(appendAvroLong(b, int64(len(s))), s...)
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,40 @@
+package tempest
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestObservationMarshalAvro(t *testing.T) {
+	obs := Observation{
+		Measurement: "w",
+		Time:        time.UnixMicro(1),
+		Tags:        map[string]string{"s": "A"},
+		Fields:      map[string]any{"t": int64(2), "c": "N", "f": 1.5},
+	}
+
+	want := []byte{
+		0x02, 'w', // measurement
+		0x02,                             // time
+		0x02, 0x02, 's', 0x02, 'A', 0x00, // tags
+		0x06,                       // 3 fields
+		0x02, 'c', 0x04, 0x02, 'N', // string branch
+		0x02, 'f', 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xf8, 0x3f, // double branch
+		0x02, 't', 0x02, 0x04, // long branch
+		0x00,
+	}
+	if got := obs.MarshalAvro(); !bytes.Equal(got, want) {
+		t.Errorf("Expected % x, got % x", want, got)
+	}
+
+	empty := Observation{Measurement: "w", Time: time.UnixMicro(0)}
+	if got := empty.MarshalAvro(); !bytes.Equal(got, []byte{0x02, 'w', 0x00, 0x00, 0x00}) {
+		t.Errorf("Expected empty maps as a zero count, got % x", got)
+	}
+
+	if !json.Valid([]byte(ObservationAvroSchema)) {
+		t.Error("Expected the Avro schema to be valid JSON")
+	}
+}
@@ -0,0 +1,155 @@
+package tempest
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+	"github.com/jacaudi/tempest-influxdb/internal/influx"
+)
+
+// WetBulb returns the wet bulb temperature in C for an air temperature in C
+// and relative humidity in %, using the Stull (2011) empirical approximation.
+//
+// The approximation is only valid for relative humidity between 5% and 99%
+// and air temperature between -20C and 50C, where it is accurate to within
+// roughly 0.3C at sea level pressure. It does not take station pressure into
+// account, so accuracy degrades at high altitude.
+func WetBulb(temp float64, rh float64) float64 {
+	return temp*math.Atan(0.151977*math.Sqrt(rh+8.313659)) +
+		math.Atan(temp+rh) -
+		math.Atan(rh-1.676331) +
+		0.00391838*math.Pow(rh, 1.5)*math.Atan(0.023101*rh) -
+		4.686035
+}
+
+// Standard atmosphere constants for PressureAltitude
+const (
+	standardPressure       = 1013.25 // hPa at sea level
+	pressureAltitudeScale  = 44307.694
+	pressureAltitudeFactor = 0.190284
+)
+
+// PressureAltitude returns the altitude in m at which the standard
+// atmosphere has the given station pressure in hPa, as used in aviation.
+// It is 0 at 1013.25 hPa and negative above it.
+func PressureAltitude(hpa float64) float64 {
+	return pressureAltitudeScale * (1 - math.Pow(hpa/standardPressure, pressureAltitudeFactor))
+}
+
+// Psychrometric constants for VaporPressure, HumidityRatio and Enthalpy
+const (
+	magnusCoefficient = 6.112    // hPa
+	magnusA           = 17.62    // dimensionless
+	magnusB           = 243.12   // C
+	waterAirMassRatio = 0.621945 // molar mass of water over dry air
+	dryAirHeat        = 1.006    // kJ/kg/C, specific heat of dry air
+	vaporLatentHeat   = 2501     // kJ/kg, latent heat of vaporization at 0C
+	vaporHeat         = 1.86     // kJ/kg/C, specific heat of water vapor
+)
+
+// VaporPressure returns the partial pressure of water vapor in hPa for an
+// air temperature in C and relative humidity in %, using the Magnus
+// formula for the saturation vapor pressure over water
+func VaporPressure(temp float64, rh float64) float64 {
+	saturation := magnusCoefficient * math.Exp(magnusA*temp/(magnusB+temp))
+	return saturation * rh / 100
+}
+
+// HumidityRatio returns the mass of water vapor per mass of dry air, in
+// kg/kg, for an air temperature in C, relative humidity in % and station
+// pressure in hPa
+func HumidityRatio(temp float64, rh float64, hpa float64) float64 {
+	e := VaporPressure(temp, rh)
+	return waterAirMassRatio * e / (hpa - e)
+}
+
+// Enthalpy returns the specific enthalpy of moist air in kJ/kg of dry air
+// for an air temperature in C, relative humidity in % and station pressure
+// in hPa, taking 0 kJ/kg as dry air at 0C
+func Enthalpy(temp float64, rh float64, hpa float64) float64 {
+	w := HumidityRatio(temp, rh, hpa)
+	return dryAirHeat*temp + w*(vaporLatentHeat+vaporHeat*temp)
+}
+
+// FrostDewPointSpread is how close in C the dew point must be to the air
+// temperature for the air to be moist enough to deposit dew or frost
+const FrostDewPointSpread = 3.0
+
+// DewPointHumidityValid reports whether relative humidity in percent is
+// within Dew_Point_Min_Humidity to 100, the range the dew point is
+// calculated for
+func DewPointHumidityValid(cfg *config.Config, humidity float64) bool {
+	return humidity >= cfg.Dew_Point_Min_Humidity && humidity <= 100
+}
+
+// FrostRisk reports whether frost is likely, meaning the air temperature in C
+// is at or below threshold and the dew point is within FrostDewPointSpread of
+// it. Cold, dry air is not a frost risk since nothing condenses.
+func FrostRisk(temp float64, dewPoint float64, threshold float64) bool {
+	return temp <= threshold && temp-dewPoint <= FrostDewPointSpread
+}
+
+// MagneticDirection applies a declination in degrees to a true-north wind
+// direction, normalizing the result into 0-359
+func MagneticDirection(direction int, declination float64) int {
+	magnetic := int(math.Round(float64(direction)+declination)) % 360
+	if magnetic < 0 {
+		magnetic += 360
+	}
+	return magnetic
+}
+
+// SetMETARWindFields sets wind_avg_2m and wind_gust_10m on m from speeds in
+// m/s, in the configured units
+func SetMETARWindFields(cfg *config.Config, m *influx.Data, avg float64, gust float64) {
+	m.Fields[FieldName(cfg, "wind_avg_2m")] = FormatField("wind_avg_2m", convertSpeed(cfg, avg))
+	m.Fields[FieldName(cfg, "wind_gust_10m")] = FormatField("wind_gust_10m", convertSpeed(cfg, gust))
+}
+
+// UVCategory returns the WHO exposure category for a UV index
+func UVCategory(uv float64) string {
+	switch {
+	case uv < 3:
+		return "low"
+	case uv < 6:
+		return "moderate"
+	case uv < 8:
+		return "high"
+	case uv < 11:
+		return "very_high"
+	default:
+		return "extreme"
+	}
+}
+
+// compassPoints names the eight principal wind directions, clockwise from north
+var compassPoints = []string{"N", "NE", "E", "SE", "S", "SW", "W", "NW"}
+
+// Compass returns the nearest principal compass point for a direction in degrees
+func Compass(degrees float64) string {
+	index := int(math.Round(math.Mod(degrees, 360)/45)) % len(compassPoints)
+	if index < 0 {
+		index += len(compassPoints)
+	}
+	return compassPoints[index]
+}
+
+// Conditions summarises an observation as text such as "Rain, 14.2C, W 5.3 m/s"
+// for status panels. Temperature and wind are given in C and m/s and written
+// in the configured unit system.
+func Conditions(cfg *config.Config, precip PrecipType, temp float64, windDirection float64, windSpeed float64) string {
+	units := UnitTags(cfg)
+
+	weather := "Dry"
+	if precip != PrecipNone {
+		weather = strings.ReplaceAll(precip.String(), "+", " and ")
+		weather = strings.ToUpper(weather[:1]) + weather[1:]
+	}
+
+	return fmt.Sprintf("%s, %.1f%s, %s %.1f %s",
+		weather,
+		convertTemp(cfg, temp), units["temp_unit"],
+		Compass(windDirection), convertSpeed(cfg, windSpeed), units["wind_unit"])
+}
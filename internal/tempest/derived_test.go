@@ -0,0 +1,219 @@
+package tempest
+
+import (
+	"bytes"
+	"log"
+	"math"
+	"testing"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+	"github.com/jacaudi/tempest-influxdb/internal/influx"
+)
+
+func TestWetBulb(t *testing.T) {
+	// Psychrometric reference at sea level: 30C / 50% RH -> 22.0C wet bulb
+	got := WetBulb(30, 50)
+	if math.Abs(got-22.0) > 0.5 {
+		t.Errorf("WetBulb(30, 50) = %.2f, want 22.0 +/- 0.5", got)
+	}
+}
+
+func TestPressureAltitude(t *testing.T) {
+	tests := []struct {
+		hpa  float64
+		want float64 // m
+	}{
+		{1013.25, 0},
+		{1000, 110.8}, // 364 ft
+		{843.1, 1524}, // 5000 ft
+	}
+	for _, tt := range tests {
+		if got := PressureAltitude(tt.hpa); math.Abs(got-tt.want) > 1 {
+			t.Errorf("PressureAltitude(%v) = %.1f, want %.1f", tt.hpa, got, tt.want)
+		}
+	}
+}
+
+func TestEnthalpy(t *testing.T) {
+	// Psychrometric chart value for 25C and 50% RH at sea level
+	if got := Enthalpy(25, 50, 1013.25); math.Abs(got-50.3) > 0.3 {
+		t.Errorf("Enthalpy(25, 50, 1013.25) = %.2f, want 50.3 +/- 0.3", got)
+	}
+	// Dry air has only sensible heat
+	if got := Enthalpy(20, 0, 1013.25); math.Abs(got-20.12) > 0.01 {
+		t.Errorf("Enthalpy(20, 0, 1013.25) = %.2f, want 20.12", got)
+	}
+	// Thinner air holds more vapor per kg at the same relative humidity
+	if HumidityRatio(25, 50, 850) <= HumidityRatio(25, 50, 1013.25) {
+		t.Error("Expected a higher humidity ratio at lower pressure")
+	}
+}
+
+func TestCompass(t *testing.T) {
+	tests := map[float64]string{0: "N", 22: "N", 23: "NE", 180: "S", 270: "W", 350: "N", 360: "N"}
+	for degrees, want := range tests {
+		if got := Compass(degrees); got != want {
+			t.Errorf("Compass(%v) = %s, want %s", degrees, got, want)
+		}
+	}
+}
+
+func TestConditions(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    *config.Config
+		precip PrecipType
+		want   string
+	}{
+		{"metric rain", &config.Config{}, PrecipRain, "Rain, 14.2C, W 5.3 m/s"},
+		{"dry", &config.Config{}, PrecipNone, "Dry, 14.2C, W 5.3 m/s"},
+		{"rain and hail", &config.Config{}, PrecipRainHail, "Rain and hail, 14.2C, W 5.3 m/s"},
+		{"imperial", &config.Config{Units: config.UnitsImperial}, PrecipRain, "Rain, 57.6F, W 11.9 mph"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Conditions(tt.cfg, tt.precip, 14.2, 268, 5.3); got != tt.want {
+				t.Errorf("Conditions() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseObservationFrostRisk(t *testing.T) {
+	cfg := &config.Config{Frost_Risk: true, Frost_Temp: config.DefaultFrostTemp}
+
+	tests := []struct {
+		name     string
+		temp     float64
+		humidity float64
+		want     string
+	}{
+		{"clear frost", 0.5, 92, "1"},
+		{"cold but dry", 1, 30, "0"},
+		{"moist but warm", 10, 95, "0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := Report{
+				ReportType: "obs_st",
+				Obs: [1][]float64{
+					{1640995200, 0, 0, 0, 0, 3, 1013.25, tt.temp, tt.humidity, 0, 0, 0, 0, 0, 0, 0, 2.7, 1},
+				},
+			}
+
+			m := influx.New()
+			if err := parseObservation(cfg, report, m); err != nil {
+				t.Fatalf("parseObservation() error = %v", err)
+			}
+			if m.Fields["frost_risk"] != tt.want {
+				t.Errorf("Expected frost_risk=%s, got %s", tt.want, m.Fields["frost_risk"])
+			}
+			if _, ok := m.Fields["dew_point"]; ok {
+				t.Error("Expected no dew_point field when only frost risk needs it")
+			}
+		})
+	}
+}
+
+func TestMagneticDirection(t *testing.T) {
+	tests := []struct {
+		direction   int
+		declination float64
+		want        int
+	}{
+		{350, 13, 3},
+		{10, -13, 357},
+		{180, 0, 180},
+		{359, 1, 0},
+		{90, 2.6, 93},
+	}
+
+	for _, tt := range tests {
+		if got := MagneticDirection(tt.direction, tt.declination); got != tt.want {
+			t.Errorf("MagneticDirection(%d, %v) = %d, want %d", tt.direction, tt.declination, got, tt.want)
+		}
+	}
+}
+
+func TestSetMETARWindFields(t *testing.T) {
+	cfg := &config.Config{Units: config.UnitsImperial, Field_Name_Map: map[string]string{"wind_gust_10m": "gust"}}
+	m := influx.New()
+
+	SetMETARWindFields(cfg, m, 4, 10)
+
+	if m.Fields["wind_avg_2m"] != "8.95" {
+		t.Errorf("Expected wind_avg_2m in mph, got %q", m.Fields["wind_avg_2m"])
+	}
+	if m.Fields["gust"] != "22.37" {
+		t.Errorf("Expected renamed wind_gust_10m in mph, got %v", m.Fields)
+	}
+}
+
+func TestParseObservationWindDeclination(t *testing.T) {
+	report := Report{
+		ReportType: "obs_st",
+		Obs: [1][]float64{
+			{1640995200, 1.5, 2.3, 3.8, 350, 3, 1013.25, 25.5, 65.0, 0, 0, 0, 0, 0, 0, 0, 2.7, 1},
+		},
+	}
+
+	m := influx.New()
+	if err := parseObservation(&config.Config{Wind_Declination: 13}, report, m); err != nil {
+		t.Fatalf("parseObservation() error = %v", err)
+	}
+	if m.Fields["wind_direction_magnetic"] != "3" {
+		t.Errorf("Expected wind_direction_magnetic=3, got %s", m.Fields["wind_direction_magnetic"])
+	}
+	if m.Fields["wind_direction"] != "350" {
+		t.Errorf("Expected wind_direction to stay 350, got %s", m.Fields["wind_direction"])
+	}
+
+	m = influx.New()
+	if err := parseObservation(&config.Config{}, report, m); err != nil {
+		t.Fatalf("parseObservation() error = %v", err)
+	}
+	if _, ok := m.Fields["wind_direction_magnetic"]; ok {
+		t.Error("Expected no wind_direction_magnetic without a declination")
+	}
+}
+
+func TestParseObservationImplausibleHumidity(t *testing.T) {
+	var logs bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&logs)
+
+	cfg := &config.Config{Dew_Point: true, Kelvin: true, Frost_Risk: true, Dew_Point_Min_Humidity: config.DefaultDewPointMinHumidity}
+	report := Report{
+		ReportType: "obs_st",
+		Obs: [1][]float64{
+			{1640995200, 1.5, 2.3, 3.8, 180, 3, 1013.25, 0.5, 0, 0, 0, 0, 0, 0, 0, 0, 2.7, 1},
+		},
+	}
+
+	m := influx.New()
+	if err := parseObservation(cfg, report, m); err != nil {
+		t.Fatalf("parseObservation() error = %v", err)
+	}
+	for _, name := range []string{"dew_point", "dew_point_kelvin", "frost_risk"} {
+		if _, ok := m.Fields[name]; ok {
+			t.Errorf("Expected no %s field at 0%% humidity, got %s", name, m.Fields[name])
+		}
+	}
+	if m.Fields["humidity"] != "0.00" {
+		t.Errorf("Expected humidity to still be written, got %q", m.Fields["humidity"])
+	}
+	if logs.Len() != 0 {
+		t.Errorf("Expected no log output, got %q", logs.String())
+	}
+}
+
+func TestUVCategory(t *testing.T) {
+	tests := map[float64]string{0: "low", 2.9: "low", 3: "moderate", 6.5: "high", 10: "very_high", 11: "extreme"}
+	for uv, want := range tests {
+		if got := UVCategory(uv); got != want {
+			t.Errorf("UVCategory(%v) = %s, want %s", uv, got, want)
+		}
+	}
+}
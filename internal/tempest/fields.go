@@ -0,0 +1,265 @@
+package tempest
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+	"github.com/jacaudi/tempest-influxdb/internal/influx"
+)
+
+// FieldType is the type a field is always formatted as
+type FieldType int
+
+const (
+	// FieldFloat fields are written with two decimal places
+	FieldFloat FieldType = iota
+	// FieldInt fields are rounded to whole numbers. They are written without
+	// the line protocol "i" suffix, so InfluxDB stores them as floats just as
+	// earlier releases did; adding the suffix would turn them into InfluxDB
+	// integers and conflict with existing data.
+	FieldInt
+	// FieldString fields are written as quoted line protocol strings
+	FieldString
+)
+
+// String returns the name of the field type
+func (f FieldType) String() string {
+	switch f {
+	case FieldInt:
+		return "int"
+	case FieldString:
+		return "string"
+	}
+	return "float"
+}
+
+// FieldSpec declares the type of every field the parser emits. A given field
+// is always formatted the same way regardless of its value, so it can never
+// flip between types and cause an InfluxDB schema conflict. No type carries
+// the "i" suffix: FieldInt only rounds, and InfluxDB stores every numeric
+// field as a float, deliberately, to match the data earlier releases wrote.
+var FieldSpec = map[string]FieldType{
+	"battery":                       FieldFloat,
+	"conditions":                    FieldString,
+	"debug":                         FieldInt,
+	"dew_point":                     FieldFloat,
+	"dew_point_kelvin":              FieldFloat,
+	"enthalpy":                      FieldFloat,
+	"fields_valid":                  FieldInt,
+	"frost_risk":                    FieldInt,
+	"fs_errors":                     FieldInt,
+	"fs_free":                       FieldInt,
+	"fs_size":                       FieldInt,
+	"fs_version":                    FieldInt,
+	"gdd":                           FieldFloat,
+	"humidity":                      FieldFloat,
+	"illuminance":                   FieldInt,
+	"mqtt_connection_attempts":      FieldInt,
+	"mqtt_connections":              FieldInt,
+	"p":                             FieldFloat,
+	"p_inhg":                        FieldFloat,
+	"precipitation":                 FieldFloat,
+	"precip_analysis":               FieldInt,
+	"precipitation_type":            FieldInt,
+	"precipitation_type_str":        FieldString,
+	"precip_start":                  FieldInt,
+	"pressure_altitude":             FieldFloat,
+	"radio_i2c_errors":              FieldInt,
+	"radio_network_id":              FieldInt,
+	"radio_reboots":                 FieldInt,
+	"radio_status":                  FieldInt,
+	"radio_version":                 FieldInt,
+	"rain_today":                    FieldFloat,
+	"raw_obs":                       FieldString,
+	"recv_time":                     FieldFloat,
+	"rapid_wind_direction":          FieldInt,
+	"rapid_wind_direction_magnetic": FieldInt,
+	"rapid_wind_speed":              FieldFloat,
+	"rssi":                          FieldInt,
+	"seq":                           FieldInt,
+	"solar_radiation":               FieldInt,
+	"strike_count":                  FieldInt,
+	"strike_distance":               FieldInt,
+	"strike_rate_10m":               FieldInt,
+	"strikes_today":                 FieldInt,
+	"temp":                          FieldFloat,
+	"temp_kelvin":                   FieldFloat,
+	"temp_max":                      FieldFloat,
+	"temp_min":                      FieldFloat,
+	"uptime":                        FieldInt,
+	"uv":                            FieldFloat,
+	"uv_category":                   FieldString,
+	"wet_bulb":                      FieldFloat,
+	"wind_avg":                      FieldFloat,
+	"wind_avg_2m":                   FieldFloat,
+	"wind_cardinal":                 FieldString,
+	"wind_gust_10m":                 FieldFloat,
+	"wind_direction":                FieldInt,
+	"wind_direction_magnetic":       FieldInt,
+	"wind_gust":                     FieldFloat,
+	"wind_lull":                     FieldFloat,
+	"wind_run_today":                FieldFloat,
+}
+
+// FormatField formats value using the type declared for name in FieldSpec.
+// Fields missing from the spec are formatted as floats.
+func FormatField(name string, value float64) string {
+	switch FieldSpec[name] {
+	case FieldInt:
+		return strconv.FormatInt(int64(math.Round(value)), 10)
+	case FieldString:
+		return quoteString(strconv.FormatFloat(value, 'f', -1, 64))
+	}
+	return strconv.FormatFloat(value, 'f', 2, 64)
+}
+
+// stringEscaper escapes the characters line protocol requires inside a
+// string field value
+var stringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// quoteString formats value as a line protocol string field
+func quoteString(value string) string {
+	return `"` + stringEscaper.Replace(value) + `"`
+}
+
+// setField formats value per FieldSpec and sets it on m. NaN and infinite
+// values, which derived calculations can produce for pathological input,
+// are left out since InfluxDB would reject the whole point over them. A
+// stuck sensor repeats them every obs, so they are only logged with Debug.
+func setField(cfg *config.Config, m *influx.Data, name string, value float64) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		if cfg.Debug {
+			log.Printf("Omitting field %s with non-finite value %g", name, value)
+		}
+		return
+	}
+	m.Fields[name] = FormatField(name, value)
+}
+
+// setStringField quotes value and sets it on m
+func setStringField(m *influx.Data, name string, value string) {
+	m.Fields[name] = quoteString(value)
+}
+
+// FieldName returns the name a field is written as, applying Field_Name_Map.
+// The Set*Fields helpers name fields with it, since they add to points
+// that have already been renamed.
+func FieldName(cfg *config.Config, name string) string {
+	if renamed, ok := cfg.Field_Name_Map[name]; ok {
+		return renamed
+	}
+	return name
+}
+
+// renameFields applies Field_Name_Map to every field on m
+func renameFields(cfg *config.Config, m *influx.Data) {
+	if len(cfg.Field_Name_Map) == 0 {
+		return
+	}
+
+	renamed := make(map[string]string, len(m.Fields))
+	for name, value := range m.Fields {
+		renamed[FieldName(cfg, name)] = value
+	}
+	m.Fields = renamed
+}
+
+// categoricalFields take only a handful of values, so they are safe to write
+// as tags
+var categoricalFields = map[string]bool{
+	"precipitation_type":     true,
+	"precipitation_type_str": true,
+	"uv_category":            true,
+	"wind_cardinal":          true,
+}
+
+// tagFields moves the fields listed in Tag_Fields to tags of the same name
+func tagFields(cfg *config.Config, m *influx.Data) {
+	for _, name := range cfg.Tag_Fields {
+		if value, ok := m.Fields[name]; ok {
+			m.Tags[name] = tagValue(name, value)
+			delete(m.Fields, name)
+		}
+	}
+}
+
+// tagValue converts a formatted field value to a tag value, dropping string
+// quoting
+func tagValue(name string, value string) string {
+	if FieldSpec[name] != FieldString {
+		return value
+	}
+	unquoted := strings.TrimSuffix(strings.TrimPrefix(value, `"`), `"`)
+	return strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(unquoted)
+}
+
+// HighCardinalityTagFields returns the Tag_Fields entries that are not
+// categorical. Every distinct tag value creates a new series, so continuous
+// values as tags quickly bloat the InfluxDB index.
+func HighCardinalityTagFields(cfg *config.Config) []string {
+	var high []string
+	for _, name := range cfg.Tag_Fields {
+		if !categoricalFields[name] {
+			high = append(high, name)
+		}
+	}
+	sort.Strings(high)
+	return high
+}
+
+// freeTextFields are string fields holding sentences or JSON, whose values
+// would make a new series almost every time and unreadable tags
+var freeTextFields = map[string]bool{
+	"conditions": true,
+	"raw_obs":    true,
+}
+
+// InvalidTagFields returns a problem for each Tag_Fields entry that is not a
+// field the parser emits or is free text unsuited to a tag
+func InvalidTagFields(cfg *config.Config) []string {
+	var problems []string
+	for _, name := range cfg.Tag_Fields {
+		switch _, ok := FieldSpec[name]; {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("TAG_FIELDS has unknown field %q", name))
+		case freeTextFields[name]:
+			problems = append(problems, fmt.Sprintf("TAG_FIELDS cannot include free text field %q", name))
+		}
+	}
+	return problems
+}
+
+// CollidingFieldNames returns a problem for each Field_Name_Map target that
+// is also a field the parser emits under its own name, since the rename
+// would overwrite that field. A target that is itself renamed away is fine.
+func CollidingFieldNames(cfg *config.Config) []string {
+	var problems []string
+	for field, name := range cfg.Field_Name_Map {
+		if _, emitted := FieldSpec[name]; !emitted {
+			continue
+		}
+		if _, renamed := cfg.Field_Name_Map[name]; !renamed {
+			problems = append(problems, fmt.Sprintf("FIELD_NAME_MAP renames %s to %s, which is already a field", field, name))
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// UnknownFieldNames returns the Field_Name_Map keys that are not fields the
+// parser emits, which are most likely typos
+func UnknownFieldNames(cfg *config.Config) []string {
+	var unknown []string
+	for name := range cfg.Field_Name_Map {
+		if _, ok := FieldSpec[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
@@ -0,0 +1,192 @@
+package tempest
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+)
+
+var fieldPatterns = map[FieldType]*regexp.Regexp{
+	FieldFloat:  regexp.MustCompile(`^-?\d+\.\d{2}$`),
+	FieldInt:    regexp.MustCompile(`^-?\d+$`),
+	FieldString: regexp.MustCompile(`^".*"$`),
+}
+
+func TestFormatFieldMatchesSpec(t *testing.T) {
+	// Every value, whole or fractional, must format with the declared type
+	values := []float64{0, 3, -7, 2.5, 1013.256}
+
+	for name, fieldType := range FieldSpec {
+		for _, value := range values {
+			got := FormatField(name, value)
+			if !fieldPatterns[fieldType].MatchString(got) {
+				t.Errorf("FormatField(%q, %v) = %q, not a %s", name, value, got, fieldType)
+			}
+		}
+	}
+}
+
+func TestIntFieldsHaveNoSuffix(t *testing.T) {
+	// Ints are written as InfluxDB floats, so they must never gain the "i"
+	for name, fieldType := range FieldSpec {
+		if fieldType != FieldInt {
+			continue
+		}
+		for _, value := range []float64{0, 42, -3.6} {
+			if got := FormatField(name, value); strings.HasSuffix(got, "i") {
+				t.Errorf("FormatField(%q, %v) = %q, want no integer suffix", name, value, got)
+			}
+		}
+	}
+}
+
+func TestParsedFieldsAreInSpec(t *testing.T) {
+	cfg := &config.Config{Rapid_Wind: true, Wet_Bulb: true, Emit_Raw: true, Dew_Point: true, Kelvin: true, Conditions_String: true, Hub_Status: true, Dual_Pressure: true, Frost_Risk: true, Emit_Debug_Field: true, Wind_Declination: 13, Categorical_Fields: true}
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+
+	packets := []string{
+		`{"serial_number": "ST-1", "type": "obs_st", "obs": [[1640995200, 1.5, 2.3, 3.8, 180, 3, 1013.25, 25.5, 65.0, 50000, 5.2, 800, 0.5, 0, 5, 2, 3.7, 1]]}`,
+		`{"serial_number": "ST-1", "type": "rapid_wind", "ob": [1640995200, 5.5, 270]}`,
+		`{"serial_number": "HB-1", "type": "hub_status", "uptime": 1670133, "rssi": -62, "timestamp": 1640995200, "seq": 48, "debug": 1, "fs": [1, 0, 15675411, 524288], "radio_stats": [2, 1, 0, 3, 2839], "mqtt_stats": [1, 0]}`,
+	}
+
+	for _, packet := range packets {
+		m, err := Parse(cfg, addr, []byte(packet), len(packet))
+		if err != nil {
+			t.Fatalf("Parse() error = %v", err)
+		}
+
+		for name, value := range m.Fields {
+			fieldType, ok := FieldSpec[name]
+			if !ok {
+				t.Errorf("Field %q is missing from FieldSpec", name)
+				continue
+			}
+			if !fieldPatterns[fieldType].MatchString(value) {
+				t.Errorf("Field %q = %q, not a %s", name, value, fieldType)
+			}
+		}
+	}
+}
+
+func TestFieldNameMap(t *testing.T) {
+	cfg := &config.Config{
+		Field_Name_Map: map[string]string{"temp": "temperature", "p": "pressure"},
+	}
+	packet := `{"serial_number": "ST-1", "type": "obs_st", "obs": [[1640995200, 1.5, 2.3, 3.8, 180, 3, 1013.25, 25.5, 65.0, 50000, 5.2, 800, 0.5, 0, 5, 2, 3.7, 1]]}`
+
+	m, err := Parse(cfg, nil, []byte(packet), len(packet))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if m.Fields["temperature"] != "25.50" || m.Fields["pressure"] != "1013.25" {
+		t.Errorf("Expected renamed temperature and pressure fields, got %v", m.Fields)
+	}
+	for _, name := range []string{"temp", "p"} {
+		if _, exists := m.Fields[name]; exists {
+			t.Errorf("Expected %s to be renamed", name)
+		}
+	}
+	if m.Fields["humidity"] != "65.00" {
+		t.Errorf("Expected unmapped humidity to keep its name, got %v", m.Fields)
+	}
+}
+
+func TestUnknownFieldNames(t *testing.T) {
+	cfg := &config.Config{
+		Field_Name_Map: map[string]string{"temp": "temperature", "tmep": "temperature", "pressure": "p"},
+	}
+
+	got := UnknownFieldNames(cfg)
+	if len(got) != 2 || got[0] != "pressure" || got[1] != "tmep" {
+		t.Errorf("Expected [pressure tmep], got %v", got)
+	}
+}
+
+func TestNonFiniteFieldsOmitted(t *testing.T) {
+	var logs bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&logs)
+
+	// Humidity this far below zero makes the wet bulb approximation NaN
+	packet := `{"serial_number": "ST-1", "type": "obs_st", "obs": [[1640995200, 1.5, 2.3, 3.8, 180, 3, 1013.25, 25.5, -50, 50000, 5.2, 800, 0.5, 0, 5, 2, 3.7, 1]]}`
+
+	m, err := Parse(&config.Config{Wet_Bulb: true}, nil, []byte(packet), len(packet))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if strings.Contains(logs.String(), "Omitting field") {
+		t.Errorf("Expected omitted fields to be logged only with debug, got %s", logs.String())
+	}
+
+	if value, ok := m.Fields["wet_bulb"]; ok {
+		t.Errorf("Expected NaN wet_bulb to be omitted, got %s", value)
+	}
+	if m.Fields["temp"] != "25.50" {
+		t.Errorf("Expected the rest of the point to be written, got temp=%s", m.Fields["temp"])
+	}
+	if line := m.Marshal(); strings.Contains(line, "NaN") || strings.Contains(line, "Inf") {
+		t.Errorf("Line protocol contains a non-finite value: %s", line)
+	}
+}
+
+func TestTagFields(t *testing.T) {
+	cfg := &config.Config{Categorical_Fields: true, Tag_Fields: []string{"precipitation_type_str", "precipitation_type"}}
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	packet := `{"serial_number": "ST-1", "type": "obs_st", "obs": [[1640995200, 1.5, 2.3, 3.8, 180, 3, 1013.25, 25.5, 65.0, 50000, 5.2, 800, 0.5, 3, 5, 2, 3.7, 1]]}`
+
+	m, err := Parse(cfg, addr, []byte(packet), len(packet))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	for name, want := range map[string]string{"precipitation_type_str": "rain+hail", "precipitation_type": "3"} {
+		if _, ok := m.Fields[name]; ok {
+			t.Errorf("Expected %s to be moved out of the fields", name)
+		}
+		if m.Tags[name] != want {
+			t.Errorf("Expected tag %s=%s, got %q", name, want, m.Tags[name])
+		}
+	}
+	if m.Fields["wind_cardinal"] != `"S"` {
+		t.Errorf("Expected wind_cardinal to stay a field, got %q", m.Fields["wind_cardinal"])
+	}
+}
+
+func TestHighCardinalityTagFields(t *testing.T) {
+	cfg := &config.Config{Tag_Fields: []string{"wind_cardinal", "temp", "uv_category", "humidity"}}
+
+	got := HighCardinalityTagFields(cfg)
+	if len(got) != 2 || got[0] != "humidity" || got[1] != "temp" {
+		t.Errorf("HighCardinalityTagFields() = %v, want [humidity temp]", got)
+	}
+}
+
+func TestInvalidTagFields(t *testing.T) {
+	cfg := &config.Config{Tag_Fields: []string{"wind_cardinal", "temperature", "conditions", "temp"}}
+
+	got := InvalidTagFields(cfg)
+	if len(got) != 2 || !strings.Contains(got[0], `"temperature"`) || !strings.Contains(got[1], `"conditions"`) {
+		t.Errorf("InvalidTagFields() = %v, want the unknown and free text fields", got)
+	}
+}
+
+func TestCollidingFieldNames(t *testing.T) {
+	cfg := &config.Config{Field_Name_Map: map[string]string{
+		"temp":      "humidity",
+		"humidity":  "rh",
+		"uv":        "illuminance",
+		"dew_point": "dewpoint",
+	}}
+
+	got := CollidingFieldNames(cfg)
+	if len(got) != 1 || !strings.Contains(got[0], "uv to illuminance") {
+		t.Errorf("CollidingFieldNames() = %v, want only the uv rename", got)
+	}
+}
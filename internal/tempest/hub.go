@@ -0,0 +1,61 @@
+package tempest
+
+import (
+	"log"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+	"github.com/jacaudi/tempest-influxdb/internal/influx"
+)
+
+// Field names for each position of the hub_status diagnostic arrays. Hubs on
+// older firmware send shorter arrays, so only the positions present are
+// written.
+var (
+	hubRadioStatsFields = []string{
+		"radio_version",
+		"radio_reboots",
+		"radio_i2c_errors",
+		"radio_status",
+		"radio_network_id",
+	}
+	hubMqttStatsFields = []string{
+		"mqtt_connection_attempts",
+		"mqtt_connections",
+	}
+	hubFsFields = []string{
+		"fs_version",
+		"fs_errors",
+		"fs_free",
+		"fs_size",
+	}
+)
+
+// parseHubStatus parses hub_status diagnostics
+func parseHubStatus(cfg *config.Config, report Report, m *influx.Data) {
+	if cfg.Debug {
+		log.Printf("HUB_STATUS %+v", report)
+	}
+
+	m.Timestamp = scaleTimestamp(cfg, float64(report.Timestamp))
+	setField(cfg, m, "uptime", float64(report.Uptime))
+	setField(cfg, m, "rssi", report.RSSI)
+	setField(cfg, m, "seq", float64(report.Seq))
+
+	setArrayFields(cfg, m, hubRadioStatsFields, report.Radio_Stats)
+	setArrayFields(cfg, m, hubMqttStatsFields, report.Mqtt_Stats)
+	setArrayFields(cfg, m, hubFsFields, report.Fs)
+
+	// Zero means debugging is off, which isn't worth a field on every point
+	if cfg.Emit_Debug_Field && report.Debug != 0 {
+		setField(cfg, m, "debug", float64(report.Debug))
+	}
+}
+
+// setArrayFields sets a field for each value in values that has a name,
+// ignoring positions missing from short arrays and extra positions from newer
+// firmware
+func setArrayFields(cfg *config.Config, m *influx.Data, names []string, values []float64) {
+	for i := 0; i < len(names) && i < len(values); i++ {
+		setField(cfg, m, names[i], values[i])
+	}
+}
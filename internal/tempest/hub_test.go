@@ -0,0 +1,100 @@
+package tempest
+
+import (
+	"testing"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+)
+
+func TestParseHubStatus(t *testing.T) {
+	cfg := &config.Config{Influx_Bucket: "test-bucket", Hub_Status: true}
+	packet := `{"serial_number": "HB-00000001", "type": "hub_status", "firmware_revision": "35", "uptime": 1670133, "rssi": -62, "timestamp": 1495724691, "reset_flags": "BOR,PIN,POR", "seq": 48, "fs": [1, 0, 15675411, 524288], "radio_stats": [2, 1, 0, 3, 2839], "mqtt_stats": [1, 0]}`
+
+	m, err := Parse(cfg, nil, []byte(packet), len(packet))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if m.Name != "weather" || m.Tags["hub"] != "HB-00000001" || m.Timestamp != 1495724691 {
+		t.Errorf("Unexpected point %+v", m)
+	}
+
+	want := map[string]string{
+		"uptime":                   "1670133",
+		"rssi":                     "-62",
+		"seq":                      "48",
+		"radio_version":            "2",
+		"radio_reboots":            "1",
+		"radio_i2c_errors":         "0",
+		"radio_status":             "3",
+		"radio_network_id":         "2839",
+		"mqtt_connection_attempts": "1",
+		"mqtt_connections":         "0",
+		"fs_version":               "1",
+		"fs_errors":                "0",
+		"fs_free":                  "15675411",
+		"fs_size":                  "524288",
+	}
+	for field, value := range want {
+		if m.Fields[field] != value {
+			t.Errorf("Expected %s=%s, got %q", field, value, m.Fields[field])
+		}
+	}
+}
+
+func TestParseHubStatusShortArrays(t *testing.T) {
+	cfg := &config.Config{Influx_Bucket: "test-bucket", Hub_Status: true}
+	packet := `{"serial_number": "HB-00000001", "type": "hub_status", "uptime": 60, "timestamp": 1495724691, "radio_stats": [2, 1], "mqtt_stats": []}`
+
+	m, err := Parse(cfg, nil, []byte(packet), len(packet))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if m.Fields["radio_reboots"] != "1" {
+		t.Errorf("Expected radio_reboots=1, got %q", m.Fields["radio_reboots"])
+	}
+	for _, field := range []string{"radio_status", "mqtt_connection_attempts", "fs_free"} {
+		if _, ok := m.Fields[field]; ok {
+			t.Errorf("Expected no %s field for a short or missing array", field)
+		}
+	}
+}
+
+func TestParseHubStatusDisabled(t *testing.T) {
+	packet := `{"serial_number": "HB-00000001", "type": "hub_status", "uptime": 60, "timestamp": 1495724691}`
+
+	m, err := Parse(&config.Config{}, nil, []byte(packet), len(packet))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if m != nil {
+		t.Errorf("Expected hub status to be ignored by default, got %+v", m)
+	}
+}
+
+func TestParseHubStatusDebugField(t *testing.T) {
+	cfg := &config.Config{Influx_Bucket: "test-bucket", Hub_Status: true, Emit_Debug_Field: true}
+
+	tests := []struct {
+		name   string
+		packet string
+		want   string
+	}{
+		{"debug enabled", `{"serial_number": "HB-00000001", "type": "hub_status", "timestamp": 1495724691, "debug": 1}`, "1"},
+		{"debug off", `{"serial_number": "HB-00000001", "type": "hub_status", "timestamp": 1495724691, "debug": 0}`, ""},
+		{"debug absent", `{"serial_number": "HB-00000001", "type": "hub_status", "timestamp": 1495724691}`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Parse(cfg, nil, []byte(tt.packet), len(tt.packet))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := m.Fields["debug"]; got != tt.want {
+				t.Errorf("Expected debug field %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
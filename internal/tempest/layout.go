@@ -0,0 +1,36 @@
+package tempest
+
+import "fmt"
+
+// ObsLayout is the obs_st array layout sent by a generation of Tempest
+// firmware. WeatherFlow has only ever appended values to the array, so each
+// layout extends the one before it.
+type ObsLayout struct {
+	// Version is the apparent UDP API version, counting from 1
+	Version int
+	// Length is the number of values in the array
+	Length int
+	// PrecipAnalysis is the index of the precipitation analysis type, or -1
+	// if the layout has none
+	PrecipAnalysis int
+}
+
+// ObsLayouts are the known obs_st layouts, oldest first
+var ObsLayouts = []ObsLayout{
+	{Version: 1, Length: 18, PrecipAnalysis: -1},
+	{Version: 2, Length: 19, PrecipAnalysis: 18},
+}
+
+// DetectObsLayout returns the layout of an obs_st report: the newest layout
+// its array is long enough for. Arrays longer than every known layout come
+// from firmware newer than this collector and use the newest layout, with
+// the extra values ignored.
+func DetectObsLayout(report Report) (ObsLayout, error) {
+	length := len(report.Obs[0])
+	for i := len(ObsLayouts) - 1; i >= 0; i-- {
+		if length >= ObsLayouts[i].Length {
+			return ObsLayouts[i], nil
+		}
+	}
+	return ObsLayout{}, fmt.Errorf("%w: expected %d fields, got %d", ErrInsufficientData, ObsLayouts[0].Length, length)
+}
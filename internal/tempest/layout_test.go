@@ -0,0 +1,35 @@
+package tempest
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDetectObsLayout(t *testing.T) {
+	tests := []struct {
+		length         int
+		version        int
+		precipAnalysis int
+	}{
+		{18, 1, -1},
+		{19, 2, 18},
+		{21, 2, 18}, // values from newer firmware are ignored
+	}
+
+	for _, tt := range tests {
+		report := Report{ReportType: "obs_st", Obs: [1][]float64{make([]float64, tt.length)}}
+		layout, err := DetectObsLayout(report)
+		if err != nil {
+			t.Fatalf("DetectObsLayout() with %d fields error = %v", tt.length, err)
+		}
+		if layout.Version != tt.version || layout.PrecipAnalysis != tt.precipAnalysis {
+			t.Errorf("With %d fields expected version %d and precip_analysis at %d, got %+v",
+				tt.length, tt.version, tt.precipAnalysis, layout)
+		}
+	}
+
+	_, err := DetectObsLayout(Report{ReportType: "obs_st", Obs: [1][]float64{make([]float64, 17)}})
+	if !errors.Is(err, ErrInsufficientData) {
+		t.Errorf("Expected ErrInsufficientData for a short obs, got %v", err)
+	}
+}
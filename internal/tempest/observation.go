@@ -0,0 +1,61 @@
+package tempest
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+	"github.com/jacaudi/tempest-influxdb/internal/influx"
+)
+
+// Observation is a parsed point with typed field values, for outputs other
+// than line protocol
+type Observation struct {
+	Measurement string            `json:"measurement"`
+	Time        time.Time         `json:"time"`
+	Tags        map[string]string `json:"tags"`
+	Fields      map[string]any    `json:"fields"`
+}
+
+// NewObservation converts a point to an Observation. Field values become
+// float64, int64 or string according to how they were formatted, so renamed
+// fields keep their types.
+func NewObservation(cfg *config.Config, m *influx.Data) Observation {
+	precision := m.Precision
+	if precision == "" {
+		precision = cfg.Precision
+	}
+	scale, ok := precisionScale[precision]
+	if !ok {
+		scale = 1
+	}
+
+	obs := Observation{
+		Measurement: m.Name,
+		Time:        time.Unix(0, m.Timestamp*(int64(time.Second)/scale)).UTC(),
+		Tags:        make(map[string]string, len(m.Tags)),
+		Fields:      make(map[string]any, len(m.Fields)),
+	}
+	for tag, value := range m.Tags {
+		obs.Tags[tag] = value
+	}
+	for name, value := range m.Fields {
+		obs.Fields[name] = fieldValue(value)
+	}
+	return obs
+}
+
+// fieldValue converts a formatted line protocol field value to its Go value
+func fieldValue(value string) any {
+	if len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+		return strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(value[1 : len(value)-1])
+	}
+	if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return f
+	}
+	return value
+}
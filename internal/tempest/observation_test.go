@@ -0,0 +1,47 @@
+package tempest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+	"github.com/jacaudi/tempest-influxdb/internal/influx"
+)
+
+func TestNewObservation(t *testing.T) {
+	cfg := &config.Config{Precision: config.PrecisionMilliseconds}
+	m := influx.New()
+	m.Name = "weather"
+	m.Timestamp = 1640995200500
+	m.Tags["station"] = "ST-123456"
+	m.Fields["temp"] = "25.50"
+	m.Fields["wind_direction"] = "180"
+	m.Fields["wind_cardinal"] = `"S"`
+	m.Fields["conditions"] = `"say \"hi\""`
+
+	obs := NewObservation(cfg, m)
+
+	if obs.Measurement != "weather" || obs.Tags["station"] != "ST-123456" {
+		t.Errorf("Unexpected measurement or tags: %+v", obs)
+	}
+	if want := time.Unix(1640995200, 5e8).UTC(); !obs.Time.Equal(want) {
+		t.Errorf("Expected time %v, got %v", want, obs.Time)
+	}
+	want := map[string]any{"temp": 25.5, "wind_direction": int64(180), "wind_cardinal": "S", "conditions": `say "hi"`}
+	if !reflect.DeepEqual(obs.Fields, want) {
+		t.Errorf("Expected fields %v, got %v", want, obs.Fields)
+	}
+}
+
+func TestNewObservationPointPrecision(t *testing.T) {
+	m := influx.New()
+	m.Timestamp = 1640995200123456789
+	m.Precision = config.PrecisionNanoseconds
+
+	obs := NewObservation(&config.Config{}, m)
+
+	if got := obs.Time.UnixNano(); got != m.Timestamp {
+		t.Errorf("Expected the point's own precision to be used, got %d", got)
+	}
+}
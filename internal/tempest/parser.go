@@ -8,6 +8,7 @@ import (
 	"log"
 	"math"
 	"net"
+	"strings"
 
 	"github.com/de-wax/go-pkg/dewpoint"
 	"github.com/jacaudi/tempest-influxdb/internal/config"
@@ -45,24 +46,65 @@ var PrecipitationTypeStrings = []string{"none", "rain", "hail", "rain+hail"}
 
 // Report represents a weather report from Tempest station
 type Report struct {
-	StationSerial    string       `json:"serial_number,omitempty"`
-	ReportType       string       `json:"type"`
-	HubSerial        string       `json:"hub_sn,omitempty"`
-	Obs              [1][]float64 `json:"obs,omitempty"`
-	Ob               [3]float64   `json:"ob,omitempty"`
-	FirmwareRevision int
-	Uptime           int       `json:"uptime,omitempty"`
-	Timestamp        int       `json:"timestamp,omitempty"`
-	ResetFlags       string    `json:"reset_flags,omitempty"`
-	Seq              int       `json:"seq,omitempty"`
-	Fs               []float64 `json:"fs,omitempty"`
-	Radio_Stats      []float64 `json:"radio_stats,omitempty"`
-	Mqtt_Stats       []float64 `json:"mqtt_stats,omitempty"`
-	Voltage          float64   `json:"voltage,omitempty"`
-	RSSI             float64   `json:"rssi,omitempty"`
-	HubRSSI          float64   `json:"hub_rssi,omitempty"`
-	SensorStatus     int       `json:"sensor_status,omitempty"`
-	Debug            int       `json:"debug,omitempty"`
+	StationSerial    string           `json:"serial_number,omitempty"`
+	ReportType       string           `json:"type"`
+	HubSerial        string           `json:"hub_sn,omitempty"`
+	Obs              [1][]float64     `json:"obs,omitempty"`
+	Ob               [3]float64       `json:"ob,omitempty"`
+	Evt              []float64        `json:"evt,omitempty"`
+	FirmwareRevision FirmwareRevision `json:"firmware_revision,omitempty"`
+	Uptime           int              `json:"uptime,omitempty"`
+	Timestamp        int              `json:"timestamp,omitempty"`
+	ResetFlags       string           `json:"reset_flags,omitempty"`
+	Seq              int              `json:"seq,omitempty"`
+	Fs               []float64        `json:"fs,omitempty"`
+	Radio_Stats      []float64        `json:"radio_stats,omitempty"`
+	Mqtt_Stats       []float64        `json:"mqtt_stats,omitempty"`
+	Voltage          float64          `json:"voltage,omitempty"`
+	RSSI             float64          `json:"rssi,omitempty"`
+	HubRSSI          float64          `json:"hub_rssi,omitempty"`
+	SensorStatus     int              `json:"sensor_status,omitempty"`
+	Debug            int              `json:"debug,omitempty"`
+
+	// obsNull records which obs values were null in the original JSON
+	obsNull []bool
+}
+
+// FirmwareRevision is a device's firmware revision, which obs_st sends as a
+// number and hub_status as a string
+type FirmwareRevision string
+
+// UnmarshalJSON accepts the revision as either a number or a string
+func (f *FirmwareRevision) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	*f = FirmwareRevision(strings.Trim(string(data), `"`))
+	return nil
+}
+
+// precisionScale is the number of timestamp units per second for each
+// InfluxDB write precision
+var precisionScale = map[string]int64{
+	config.PrecisionSeconds:      1,
+	config.PrecisionMilliseconds: 1e3,
+	config.PrecisionMicroseconds: 1e6,
+	config.PrecisionNanoseconds:  1e9,
+}
+
+// scaleTimestamp converts a station timestamp in (possibly fractional)
+// seconds to the configured write precision. Whole seconds and the fraction
+// are scaled separately so sub-second parts survive at finer precisions
+// instead of being truncated, and float rounding can't disturb the seconds.
+func scaleTimestamp(cfg *config.Config, seconds float64) int64 {
+	scale, ok := precisionScale[cfg.Precision]
+	if !ok {
+		scale = 1
+	}
+
+	whole := math.Floor(seconds)
+	fraction := math.Round((seconds - whole) * float64(scale))
+	return int64(whole)*scale + int64(fraction)
 }
 
 // parseObservation parses Tempest observation data
@@ -89,8 +131,9 @@ func parseObservation(cfg *config.Config, report Report, m *influx.Data) error {
 	}
 	var observation Obs
 
-	if len(report.Obs[0]) < 18 {
-		return fmt.Errorf("%w: expected 18 fields, got %d", ErrInsufficientData, len(report.Obs[0]))
+	layout, err := DetectObsLayout(report)
+	if err != nil {
+		return err
 	}
 
 	data := report.Obs[0]
@@ -103,48 +146,144 @@ func parseObservation(cfg *config.Config, report Report, m *influx.Data) error {
 	observation.StationPressure = data[6]
 	observation.AirTemperature = data[7]
 	observation.RelativeHumidity = data[8]
-	observation.Illuminance = int(math.Round(data[9]))
+	observation.Illuminance = int(math.Round(clampReading(cfg, "illuminance", data[9], MaxIlluminance)))
 	observation.UV = data[10]
-	observation.SolarRadiation = int(math.Round(data[11]))
+	observation.SolarRadiation = int(math.Round(clampReading(cfg, "solar_radiation", data[11], MaxSolarRadiation)))
 	observation.PrecipitationAccumulation = data[12]
 	observation.PrecipitationType = int(math.Round(data[13]))
 	observation.StrikeAvgDistance = int(math.Round(data[14]))
 	observation.StrikeCount = int(math.Round(data[15]))
 	observation.Battery = data[16]
 	observation.Interval = int(math.Round(data[17]))
+
+	// Calibrate before anything is derived so corrections carry through
+	observation.AirTemperature += cfg.Temp_Offset
+	if cfg.Humidity_Offset != 0 {
+		observation.RelativeHumidity = math.Max(0, math.Min(100, observation.RelativeHumidity+cfg.Humidity_Offset))
+	}
 	if cfg.Debug {
 		log.Printf("OBS_ST %+v %+v", report, observation)
 	}
 
-	// Calculate Dew Point from RH and Temp
-	dp, err := dewpoint.Calculate(observation.AirTemperature, observation.RelativeHumidity)
-	if err != nil {
-		log.Printf("dewpoint.Calculate(%f, %f): %v", observation.AirTemperature, observation.RelativeHumidity, err)
+	// Calculate Dew Point from RH and Temp. Implausible humidity from a
+	// failing sensor would log an error every obs, so it is skipped instead
+	// and the dew point and fields derived from it are omitted.
+	var dp float64
+	validDewPoint := DewPointHumidityValid(cfg, observation.RelativeHumidity)
+	if (cfg.Dew_Point || cfg.Frost_Risk) && validDewPoint {
+		dp, err = dewpoint.Calculate(observation.AirTemperature, observation.RelativeHumidity)
+		if err != nil {
+			log.Printf("dewpoint.Calculate(%f, %f): %v", observation.AirTemperature, observation.RelativeHumidity, err)
+		}
 	}
 
-	m.Timestamp = observation.Timestamp
+	m.Timestamp = scaleTimestamp(cfg, data[0])
 	// Set fields and sort into alphabetical order to keep InfluxDB happy
-	m.Fields = map[string]string{
-		"battery":            fmt.Sprintf("%.2f", observation.Battery),
-		"dew_point":          fmt.Sprintf("%.2f", dp),
-		"humidity":           fmt.Sprintf("%.2f", observation.RelativeHumidity),
-		"illuminance":        fmt.Sprintf("%d", observation.Illuminance),
-		"p":                  fmt.Sprintf("%.2f", observation.StationPressure),
-		"precipitation":      fmt.Sprintf("%.2f", observation.PrecipitationAccumulation),
-		"precipitation_type": fmt.Sprintf("%d", observation.PrecipitationType),
-		"solar_radiation":    fmt.Sprintf("%d", observation.SolarRadiation),
-		"strike_count":       fmt.Sprintf("%d", observation.StrikeCount),
-		"strike_distance":    fmt.Sprintf("%d", observation.StrikeAvgDistance),
-		"temp":               fmt.Sprintf("%.2f", observation.AirTemperature),
-		"uv":                 fmt.Sprintf("%.2f", observation.UV),
-		"wind_avg":           fmt.Sprintf("%.2f", observation.WindAvg),
-		"wind_direction":     fmt.Sprintf("%d", observation.WindDirection),
-		"wind_gust":          fmt.Sprintf("%.2f", observation.WindGust),
-		"wind_lull":          fmt.Sprintf("%.2f", observation.WindLull),
+	// Field types come from FieldSpec; Marshal sorts fields alphabetically
+	setField(cfg, m, "battery", observation.Battery)
+	if cfg.Dew_Point && validDewPoint {
+		setField(cfg, m, "dew_point", convertTemp(cfg, dp))
+	}
+	setField(cfg, m, "fields_valid", float64(ValidFieldCount(report)))
+	setField(cfg, m, "humidity", observation.RelativeHumidity)
+	setField(cfg, m, "illuminance", float64(observation.Illuminance))
+	setField(cfg, m, "p", convertPressure(cfg, observation.StationPressure))
+	// Dashboards shared across regions can read inHg without a units switch
+	if cfg.Dual_Pressure {
+		setField(cfg, m, "p_inhg", hpaToInHg(observation.StationPressure))
+	}
+	setField(cfg, m, "precipitation", convertPrecip(cfg, observation.PrecipitationAccumulation))
+	setField(cfg, m, "precipitation_type", float64(observation.PrecipitationType))
+	setField(cfg, m, "solar_radiation", float64(observation.SolarRadiation))
+	setField(cfg, m, "strike_count", float64(observation.StrikeCount))
+	setField(cfg, m, "strike_distance", float64(convertDistance(cfg, observation.StrikeAvgDistance)))
+	setField(cfg, m, "temp", convertTemp(cfg, observation.AirTemperature))
+	setField(cfg, m, "uv", observation.UV)
+	setField(cfg, m, "wind_avg", convertSpeed(cfg, observation.WindAvg))
+	setField(cfg, m, "wind_direction", float64(observation.WindDirection))
+	if cfg.Wind_Declination != 0 {
+		setField(cfg, m, "wind_direction_magnetic", float64(MagneticDirection(observation.WindDirection, cfg.Wind_Declination)))
+	}
+	setField(cfg, m, "wind_gust", convertSpeed(cfg, observation.WindGust))
+	setField(cfg, m, "wind_lull", convertSpeed(cfg, observation.WindLull))
+
+	// Newer firmware appends the precipitation analysis type
+	if layout.PrecipAnalysis >= 0 {
+		setField(cfg, m, "precip_analysis", data[layout.PrecipAnalysis])
+	}
+
+	// Kelvin fields are SI regardless of the configured unit system
+	if cfg.Kelvin {
+		setField(cfg, m, "temp_kelvin", celsiusToKelvin(observation.AirTemperature))
+		if cfg.Dew_Point && validDewPoint {
+			setField(cfg, m, "dew_point_kelvin", celsiusToKelvin(dp))
+		}
+	}
+
+	if cfg.Frost_Risk && validDewPoint {
+		frost := 0.0
+		if FrostRisk(observation.AirTemperature, dp, cfg.Frost_Temp) {
+			frost = 1
+		}
+		setField(cfg, m, "frost_risk", frost)
+	}
+
+	if cfg.Wet_Bulb {
+		setField(cfg, m, "wet_bulb", convertTemp(cfg, WetBulb(observation.AirTemperature, observation.RelativeHumidity)))
+	}
+
+	if cfg.Pressure_Altitude {
+		setField(cfg, m, "pressure_altitude", convertAltitude(cfg, PressureAltitude(observation.StationPressure)))
+	}
+
+	// Enthalpy is SI regardless of the configured unit system
+	if cfg.Enthalpy {
+		setField(cfg, m, "enthalpy", Enthalpy(observation.AirTemperature, observation.RelativeHumidity, observation.StationPressure))
+	}
+
+	if cfg.Categorical_Fields {
+		setStringField(m, "precipitation_type_str", PrecipType(observation.PrecipitationType).String())
+		setStringField(m, "wind_cardinal", Compass(float64(observation.WindDirection)))
+		setStringField(m, "uv_category", UVCategory(observation.UV))
+	}
+
+	if cfg.Conditions_String {
+		conditions := Conditions(cfg, PrecipType(observation.PrecipitationType), observation.AirTemperature,
+			float64(observation.WindDirection), observation.WindAvg)
+		setStringField(m, "conditions", conditions)
+	}
+
+	if cfg.Emit_Raw {
+		raw, err := rawObs(report)
+		if err != nil {
+			return fmt.Errorf("encoding raw obs: %w", err)
+		}
+		setStringField(m, "raw_obs", raw)
+	}
+
+	if cfg.Honor_Sensor_Status {
+		omitFailedSensorFields(report, m)
 	}
 	return nil
 }
 
+// rawObs JSON encodes the obs array as received, keeping nulls as null
+func rawObs(report Report) (string, error) {
+	values := make([]any, len(report.Obs[0]))
+	for i, value := range report.Obs[0] {
+		if i < len(report.obsNull) && report.obsNull[i] {
+			continue
+		}
+		values[i] = value
+	}
+
+	raw, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
 // parseRapidWind parses Tempest rapid wind data
 func parseRapidWind(cfg *config.Config, report Report, m *influx.Data) error {
 	type RapidWind struct {
@@ -166,31 +305,158 @@ func parseRapidWind(cfg *config.Config, report Report, m *influx.Data) error {
 		log.Printf("RAPID_WIND %+v %+v", report, rapidWind)
 	}
 
-	m.Timestamp = rapidWind.Timestamp
-	m.Fields = map[string]string{
-		"rapid_wind_speed":     fmt.Sprintf("%.2f", rapidWind.WindSpeed),
-		"rapid_wind_direction": fmt.Sprintf("%d", rapidWind.WindDirection),
+	m.Timestamp = scaleTimestamp(cfg, report.Ob[0])
+	setField(cfg, m, "rapid_wind_speed", convertSpeed(cfg, rapidWind.WindSpeed))
+	setField(cfg, m, "rapid_wind_direction", float64(rapidWind.WindDirection))
+	if cfg.Wind_Declination != 0 {
+		setField(cfg, m, "rapid_wind_direction_magnetic", float64(MagneticDirection(rapidWind.WindDirection, cfg.Wind_Declination)))
 	}
 	return nil
 }
 
+// parsePrecipEvent parses an evt_precip rain start event
+func parsePrecipEvent(cfg *config.Config, report Report, m *influx.Data) error {
+	if len(report.Evt) < 1 {
+		return fmt.Errorf("%w: expected 1 field, got %d", ErrInsufficientData, len(report.Evt))
+	}
+
+	m.Timestamp = scaleTimestamp(cfg, report.Evt[0])
+	setField(cfg, m, "precip_start", 1)
+	return nil
+}
+
+// Time returns the station timestamp of the report in seconds, or 0 if the
+// report type carries none
+func (r Report) Time() int64 {
+	switch r.ReportType {
+	case "obs_st":
+		if len(r.Obs[0]) > 0 {
+			return int64(r.Obs[0][0])
+		}
+	case "rapid_wind":
+		return int64(r.Ob[0])
+	case "evt_precip", "evt_strike":
+		if len(r.Evt) > 0 {
+			return int64(r.Evt[0])
+		}
+	}
+	return int64(r.Timestamp)
+}
+
+// StrikeCount returns the lightning strikes counted during an obs_st report's
+// interval, or 0 for other report types
+func (r Report) StrikeCount() int {
+	if r.ReportType == "obs_st" && len(r.Obs[0]) > 15 {
+		return int(math.Round(r.Obs[0][15]))
+	}
+	return 0
+}
+
+// Battery returns the battery voltage of an obs_st report, or false if the
+// report has none or it was sent as null
+func (r Report) Battery() (float64, bool) {
+	const batteryIndex = 16
+	if r.ReportType != "obs_st" || len(r.Obs[0]) <= batteryIndex {
+		return 0, false
+	}
+	if batteryIndex < len(r.obsNull) && r.obsNull[batteryIndex] {
+		return 0, false
+	}
+	return r.Obs[0][batteryIndex], true
+}
+
+// AirTemperature returns the air temperature in C of an obs_st report, or
+// false if the report has none or it was sent as null
+func (r Report) AirTemperature() (float64, bool) {
+	const tempIndex = 7
+	if r.ReportType != "obs_st" || len(r.Obs[0]) <= tempIndex {
+		return 0, false
+	}
+	if tempIndex < len(r.obsNull) && r.obsNull[tempIndex] {
+		return 0, false
+	}
+	return r.Obs[0][tempIndex], true
+}
+
+// DecodeReport decodes a raw UDP payload into a Report
+func DecodeReport(b []byte) (Report, error) {
+	var report Report
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	err := decoder.Decode(&report)
+	return report, err
+}
+
 // Parse parses weather data from Tempest station
 func Parse(cfg *config.Config, addr *net.UDPAddr, b []byte, n int) (m *influx.Data, err error) {
-	var report Report
-	decoder := json.NewDecoder(bytes.NewReader(b[:n]))
-	err = decoder.Decode(&report)
+	report, err := DecodeReport(b[:n])
 	if err != nil {
 		err = fmt.Errorf("ERROR Could not Unmarshal %d bytes from %v: %v: %v", n, addr, err, string(b[:n]))
 		return
 	}
 
+	return ParseReport(cfg, addr, report)
+}
+
+// Bucket returns the bucket a report type is written to. Entries in the
+// Influx_Buckets routing table win, then the legacy rapid wind bucket, then
+// the default bucket.
+func Bucket(cfg *config.Config, reportType string) string {
+	if bucket, ok := cfg.Influx_Buckets[reportType]; ok {
+		return bucket
+	}
+	if reportType == "rapid_wind" && cfg.Influx_Bucket_Rapid_Wind != "" {
+		return cfg.Influx_Bucket_Rapid_Wind
+	}
+	return cfg.Influx_Bucket
+}
+
+// Org returns the organization a report type is written to, from the
+// Influx_Orgs routing table or else the default organization
+func Org(cfg *config.Config, reportType string) string {
+	if org, ok := cfg.Influx_Orgs[reportType]; ok {
+		return org
+	}
+	return cfg.Influx_Org
+}
+
+// RapidWindFields returns the fields a rapid_wind report would be written
+// with, for merging onto another point
+func RapidWindFields(cfg *config.Config, report Report) (map[string]string, error) {
+	m := influx.New()
+	if err := parseRapidWind(cfg, report, m); err != nil {
+		return nil, fmt.Errorf("parsing rapid wind: %w", err)
+	}
+	renameFields(cfg, m)
+	return m.Fields, nil
+}
+
+// Measurement returns the measurement a report type is written to. Everything
+// shares "weather" unless Measurement_Per_Type is set, in which case reports
+// other than obs_st are named after their type.
+func Measurement(cfg *config.Config, reportType string) string {
+	if cfg.Measurement_Per_Type && reportType != "obs_st" {
+		return reportType
+	}
+	return "weather"
+}
+
+// ParseReport converts a decoded report into InfluxDB data. It returns nil
+// data for report types that are not written.
+func ParseReport(cfg *config.Config, addr *net.UDPAddr, report Report) (m *influx.Data, err error) {
 	m = influx.New()
 
-	m.Bucket = cfg.Influx_Bucket
+	m.Bucket = Bucket(cfg, report.ReportType)
+	m.Org = Org(cfg, report.ReportType)
 
 	switch report.ReportType {
 	case "obs_st":
-		m.Name = "weather"
+		if cfg.Skip_Zero_Obs && IsWarmupObs(report) {
+			if cfg.Debug {
+				log.Printf("Skipping warm-up obs from %s with zero temperature, pressure and humidity", report.StationSerial)
+			}
+			return nil, nil
+		}
+		m.Name = Measurement(cfg, report.ReportType)
 		if err = parseObservation(cfg, report, m); err != nil {
 			return nil, fmt.Errorf("parsing observation: %w", err)
 		}
@@ -199,20 +465,98 @@ func Parse(cfg *config.Config, addr *net.UDPAddr, b []byte, n int) (m *influx.Da
 		if !cfg.Rapid_Wind {
 			return nil, nil
 		}
-		m.Name = "weather"
+		m.Name = Measurement(cfg, report.ReportType)
 		if err = parseRapidWind(cfg, report, m); err != nil {
 			return nil, fmt.Errorf("parsing rapid wind: %w", err)
 		}
 		m.Tags["station"] = report.StationSerial
-		if cfg.Influx_Bucket_Rapid_Wind != "" {
-			m.Bucket = cfg.Influx_Bucket_Rapid_Wind
+	case "hub_status":
+		if !cfg.Hub_Status {
+			return nil, nil
 		}
+		m.Name = Measurement(cfg, report.ReportType)
+		parseHubStatus(cfg, report, m)
+		m.Tags["hub"] = report.StationSerial
 
-	case "hub_status", "evt_precip", "evt_strike":
+	case "evt_precip":
+		if !cfg.Precip_Events {
+			return nil, nil
+		}
+		m.Name = Measurement(cfg, report.ReportType)
+		if err = parsePrecipEvent(cfg, report, m); err != nil {
+			return nil, fmt.Errorf("parsing precip event: %w", err)
+		}
+		m.Tags["station"] = report.StationSerial
+	case "evt_strike":
 		return nil, nil
 	default:
 		return nil, nil
 	}
 
+	// Only obs_st and rapid_wind carry unit dependent values
+	if cfg.Unit_Tags && (report.ReportType == "obs_st" || report.ReportType == "rapid_wind") {
+		for tag, value := range UnitTags(cfg) {
+			m.Tags[tag] = value
+		}
+	}
+
+	tagFields(cfg, m)
+	renameFields(cfg, m)
+
+	staticTags(cfg, m)
+
+	// Only the IP is used; the ephemeral source port would explode cardinality
+	if cfg.Emit_Source_IP && addr != nil {
+		m.Tags["source_ip"] = addr.IP.String()
+	}
+
+	commonTags(cfg, m, report)
+
 	return
 }
+
+// staticTags adds the collector and schema tags, which are the same on every
+// point
+func staticTags(cfg *config.Config, m *influx.Data) {
+	if cfg.Collector_ID != "" {
+		m.Tags["collector"] = cfg.Collector_ID
+	}
+	if cfg.Schema_Tag != "" {
+		m.Tags["schema"] = cfg.Schema_Tag
+	}
+}
+
+// commonTags adds the Common_Tags entries to m, so every measurement can be
+// joined on them. Empty values are skipped and tags already set, such as the
+// station serial, are never replaced.
+func commonTags(cfg *config.Config, m *influx.Data, report Report) {
+	for _, entry := range cfg.Common_Tags {
+		name, value, static := strings.Cut(entry, "=")
+		if !static {
+			value = reportTag(name, report)
+		}
+		if _, set := m.Tags[name]; set || value == "" {
+			continue
+		}
+		m.Tags[name] = value
+	}
+}
+
+// reportTag returns the value of a report tag named in Common_Tags, or ""
+// if the report doesn't carry it
+func reportTag(name string, report Report) string {
+	switch name {
+	case config.CommonTagStation:
+		if report.ReportType != "hub_status" {
+			return report.StationSerial
+		}
+	case config.CommonTagHub:
+		if report.ReportType == "hub_status" {
+			return report.StationSerial
+		}
+		return report.HubSerial
+	case config.CommonTagFirmwareRevision:
+		return string(report.FirmwareRevision)
+	}
+	return ""
+}
@@ -3,7 +3,9 @@ package tempest
 import (
 	"errors"
 	"net"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/jacaudi/tempest-influxdb/internal/config"
 	"github.com/jacaudi/tempest-influxdb/internal/influx"
@@ -32,7 +34,7 @@ func TestPrecipType_String(t *testing.T) {
 }
 
 func TestParseObservationSuccess(t *testing.T) {
-	cfg := &config.Config{Debug: false}
+	cfg := &config.Config{Debug: false, Dew_Point: true}
 	report := Report{
 		ReportType: "obs_st",
 		Obs: [1][]float64{
@@ -238,6 +240,32 @@ func TestParseValidRapidWindReport(t *testing.T) {
 	}
 }
 
+func TestParsePrecipEvent(t *testing.T) {
+	jsonData := `{"serial_number": "ST-123456", "type": "evt_precip", "hub_sn": "HB-1", "evt": [1640995200]}`
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+
+	m, err := Parse(&config.Config{Influx_Bucket: "test-bucket"}, addr, []byte(jsonData), len(jsonData))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if m != nil {
+		t.Error("Expected no point when precip_events is disabled")
+	}
+
+	m, err = Parse(&config.Config{Influx_Bucket: "test-bucket", Precip_Events: true}, addr, []byte(jsonData), len(jsonData))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if m.Timestamp != 1640995200 || m.Tags["station"] != "ST-123456" || m.Fields["precip_start"] != "1" {
+		t.Errorf("Unexpected precip event point %+v", m)
+	}
+
+	empty := `{"serial_number": "ST-123456", "type": "evt_precip", "evt": []}`
+	if _, err := Parse(&config.Config{Precip_Events: true}, addr, []byte(empty), len(empty)); !errors.Is(err, ErrInsufficientData) {
+		t.Errorf("Expected ErrInsufficientData for an empty evt, got %v", err)
+	}
+}
+
 func TestParseRapidWindDisabled(t *testing.T) {
 	cfg := &config.Config{
 		Debug:         false,
@@ -356,3 +384,464 @@ func BenchmarkParseRapidWindReport(b *testing.B) {
 		_, _ = Parse(cfg, addr, []byte(jsonData), len(jsonData))
 	}
 }
+
+func TestParseObservationWetBulb(t *testing.T) {
+	report := Report{
+		ReportType: "obs_st",
+		Obs: [1][]float64{
+			{1640995200, 1.5, 2.3, 3.8, 180, 3, 1013.25, 30.0, 50.0, 50000, 5.2, 800, 0.5, 0, 5, 2, 3.7, 1},
+		},
+	}
+
+	m := influx.New()
+	if err := parseObservation(&config.Config{}, report, m); err != nil {
+		t.Fatalf("parseObservation() error = %v", err)
+	}
+	if _, exists := m.Fields["wet_bulb"]; exists {
+		t.Error("Expected no wet_bulb field when disabled")
+	}
+
+	m = influx.New()
+	if err := parseObservation(&config.Config{Wet_Bulb: true}, report, m); err != nil {
+		t.Fatalf("parseObservation() error = %v", err)
+	}
+	if m.Fields["wet_bulb"] != "22.30" {
+		t.Errorf("Expected wet_bulb=22.30, got %s", m.Fields["wet_bulb"])
+	}
+}
+
+func TestParseObservationEnthalpy(t *testing.T) {
+	report := Report{
+		ReportType: "obs_st",
+		Obs: [1][]float64{
+			{1640995200, 1.5, 2.3, 3.8, 180, 3, 1013.25, 25.0, 50.0, 50000, 5.2, 800, 0.5, 0, 5, 2, 3.7, 1},
+		},
+	}
+
+	m := influx.New()
+	if err := parseObservation(&config.Config{}, report, m); err != nil {
+		t.Fatalf("parseObservation() error = %v", err)
+	}
+	if _, exists := m.Fields["enthalpy"]; exists {
+		t.Error("Expected no enthalpy field when disabled")
+	}
+
+	// kJ/kg even with imperial units
+	m = influx.New()
+	if err := parseObservation(&config.Config{Enthalpy: true, Units: config.UnitsImperial}, report, m); err != nil {
+		t.Fatalf("parseObservation() error = %v", err)
+	}
+	if m.Fields["enthalpy"] != "50.25" {
+		t.Errorf("Expected enthalpy=50.25, got %s", m.Fields["enthalpy"])
+	}
+}
+
+func TestParseObservationPressureAltitude(t *testing.T) {
+	report := Report{
+		ReportType: "obs_st",
+		Obs: [1][]float64{
+			{1640995200, 1.5, 2.3, 3.8, 180, 3, 1000, 30.0, 50.0, 50000, 5.2, 800, 0.5, 0, 5, 2, 3.7, 1},
+		},
+	}
+
+	m := influx.New()
+	if err := parseObservation(&config.Config{}, report, m); err != nil {
+		t.Fatalf("parseObservation() error = %v", err)
+	}
+	if _, exists := m.Fields["pressure_altitude"]; exists {
+		t.Error("Expected no pressure_altitude field when disabled")
+	}
+
+	tests := []struct {
+		units string
+		want  string
+	}{
+		{config.UnitsMetric, "110.84"},
+		{config.UnitsImperial, "363.64"},
+	}
+	for _, tt := range tests {
+		m = influx.New()
+		if err := parseObservation(&config.Config{Pressure_Altitude: true, Units: tt.units}, report, m); err != nil {
+			t.Fatalf("parseObservation() error = %v", err)
+		}
+		if m.Fields["pressure_altitude"] != tt.want {
+			t.Errorf("With %s units expected pressure_altitude=%s, got %s", tt.units, tt.want, m.Fields["pressure_altitude"])
+		}
+	}
+}
+
+func TestParseSchemaTag(t *testing.T) {
+	cfg := &config.Config{Influx_Bucket: "test-bucket", Hub_Status: true, Schema_Tag: "v2"}
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+
+	obs := `{"serial_number": "ST-123456", "type": "obs_st", "obs": [[1640995200, 1.5, 2.3, 3.8, 180, 3, 1013.25, 25.5, 65.0, 50000, 5.2, 800, 0.5, 0, 5, 2, 3.7, 1]]}`
+	for _, jsonData := range []string{
+		obs,
+		`{"serial_number": "HB-123456", "type": "hub_status", "firmware_revision": "177", "uptime": 1000, "rssi": -60, "timestamp": 1640995200, "seq": 1}`,
+	} {
+		m, err := Parse(cfg, addr, []byte(jsonData), len(jsonData))
+		if err != nil {
+			t.Fatalf("Parse() error = %v", err)
+		}
+		if m.Tags["schema"] != "v2" {
+			t.Errorf("Expected schema tag v2 on %s, got %q", m.Name, m.Tags["schema"])
+		}
+	}
+
+	m, err := Parse(&config.Config{Influx_Bucket: "test-bucket"}, addr, []byte(obs), len(obs))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if _, ok := m.Tags["schema"]; ok {
+		t.Error("Expected no schema tag when unset")
+	}
+}
+
+func TestParseCollectorTag(t *testing.T) {
+	cfg := &config.Config{Influx_Bucket: "test-bucket", Collector_ID: "collector-1"}
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+
+	jsonData := `{"serial_number": "ST-123456", "type": "obs_st", "obs": [[1640995200, 1.5, 2.3, 3.8, 180, 3, 1013.25, 25.5, 65.0, 50000, 5.2, 800, 0.5, 0, 5, 2, 3.7, 1]]}`
+
+	m, err := Parse(cfg, addr, []byte(jsonData), len(jsonData))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if m.Tags["collector"] != "collector-1" {
+		t.Errorf("Expected collector tag collector-1, got %s", m.Tags["collector"])
+	}
+}
+
+func TestParseCommonTags(t *testing.T) {
+	cfg := &config.Config{
+		Influx_Bucket:        "test-bucket",
+		Rapid_Wind:           true,
+		Hub_Status:           true,
+		Measurement_Per_Type: true,
+		Collector_ID:         "collector-1",
+		Common_Tags:          []string{"station", "hub", "firmware_revision", "location=backyard", "region=", "collector=spoofed"},
+	}
+
+	packets := map[string]string{
+		"weather":    `{"serial_number": "ST-123456", "type": "obs_st", "hub_sn": "HB-1", "firmware_revision": 129, "obs": [[1640995200, 1.5, 2.3, 3.8, 180, 3, 1013.25, 25.5, 65.0, 50000, 5.2, 800, 0.5, 0, 5, 2, 3.7, 1]]}`,
+		"rapid_wind": `{"serial_number": "ST-123456", "type": "rapid_wind", "hub_sn": "HB-1", "ob": [1640995200, 2.3, 180]}`,
+		"hub_status": `{"serial_number": "HB-1", "type": "hub_status", "firmware_revision": "35", "uptime": 1670133, "rssi": -62, "timestamp": 1640995200, "seq": 48}`,
+	}
+	want := map[string]map[string]string{
+		"weather":    {"station": "ST-123456", "hub": "HB-1", "firmware_revision": "129", "location": "backyard", "collector": "collector-1"},
+		"rapid_wind": {"station": "ST-123456", "hub": "HB-1", "location": "backyard", "collector": "collector-1"},
+		"hub_status": {"hub": "HB-1", "firmware_revision": "35", "location": "backyard", "collector": "collector-1"},
+	}
+
+	for measurement, packet := range packets {
+		m, err := Parse(cfg, nil, []byte(packet), len(packet))
+		if err != nil {
+			t.Fatalf("Parse(%s) error = %v", measurement, err)
+		}
+		if m.Name != measurement {
+			t.Errorf("Expected measurement %s, got %s", measurement, m.Name)
+		}
+		if !reflect.DeepEqual(m.Tags, want[measurement]) {
+			t.Errorf("Expected %s tags %v, got %v", measurement, want[measurement], m.Tags)
+		}
+	}
+
+	totals := DailyTotalsPoint(cfg, "ST-123456", time.Unix(1640995200, 0), DailyTotals{})
+	if totals.Tags["station"] != "ST-123456" || totals.Tags["location"] != "backyard" {
+		t.Errorf("Expected common tags on daily totals, got %v", totals.Tags)
+	}
+}
+
+func TestParseUnitTags(t *testing.T) {
+	cfg := &config.Config{Influx_Bucket: "test-bucket", Units: config.UnitsImperial, Unit_Tags: true}
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+
+	jsonData := `{"serial_number": "ST-123456", "type": "obs_st", "obs": [[1640995200, 1.5, 2.3, 3.8, 180, 3, 1013.25, 25.5, 65.0, 50000, 5.2, 800, 0.5, 0, 5, 2, 3.7, 1]]}`
+
+	m, err := Parse(cfg, addr, []byte(jsonData), len(jsonData))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if m.Tags["temp_unit"] != "F" || m.Tags["wind_unit"] != "mph" || m.Tags["pressure_unit"] != "inHg" {
+		t.Errorf("Expected imperial unit tags, got %v", m.Tags)
+	}
+
+	if m.Fields["temp"] != "77.90" {
+		t.Errorf("Expected temp=77.90, got %s", m.Fields["temp"])
+	}
+}
+
+func TestScaleTimestamp(t *testing.T) {
+	tests := []struct {
+		precision string
+		seconds   float64
+		want      int64
+	}{
+		{"", 1640995200, 1640995200},
+		{config.PrecisionSeconds, 1640995200, 1640995200},
+		{config.PrecisionMilliseconds, 1640995200, 1640995200000},
+		{config.PrecisionMilliseconds, 1640995200.123, 1640995200123},
+		{config.PrecisionMicroseconds, 1640995200.5, 1640995200500000},
+		{config.PrecisionNanoseconds, 1640995200.25, 1640995200250000000},
+	}
+
+	for _, tt := range tests {
+		got := scaleTimestamp(&config.Config{Precision: tt.precision}, tt.seconds)
+		if got != tt.want {
+			t.Errorf("scaleTimestamp(%q, %f) = %d, want %d", tt.precision, tt.seconds, got, tt.want)
+		}
+	}
+}
+
+func TestParseRapidWindFractionalTimestamp(t *testing.T) {
+	cfg := &config.Config{Precision: config.PrecisionMilliseconds}
+	report := Report{
+		ReportType: "rapid_wind",
+		Ob:         [3]float64{1640995200.123, 5.5, 270},
+	}
+
+	m := influx.New()
+	if err := parseRapidWind(cfg, report, m); err != nil {
+		t.Fatalf("parseRapidWind() error = %v", err)
+	}
+
+	if m.Timestamp != 1640995200123 {
+		t.Errorf("Expected timestamp 1640995200123, got %d", m.Timestamp)
+	}
+}
+
+func TestParseSourceIPTag(t *testing.T) {
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	jsonData := `{"serial_number": "ST-123456", "type": "obs_st", "obs": [[1640995200, 1.5, 2.3, 3.8, 180, 3, 1013.25, 25.5, 65.0, 50000, 5.2, 800, 0.5, 0, 5, 2, 3.7, 1]]}`
+
+	m, err := Parse(&config.Config{}, addr, []byte(jsonData), len(jsonData))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if _, ok := m.Tags["source_ip"]; ok {
+		t.Error("Expected no source_ip tag when disabled")
+	}
+
+	m, err = Parse(&config.Config{Emit_Source_IP: true}, addr, []byte(jsonData), len(jsonData))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if m.Tags["source_ip"] != "192.168.1.100" {
+		t.Errorf("Expected source_ip=192.168.1.100, got %s", m.Tags["source_ip"])
+	}
+}
+
+func TestParseObservationPrecipAnalysis(t *testing.T) {
+	obs := []float64{1640995200, 1.5, 2.3, 3.8, 180, 3, 1013.25, 25.5, 65.0, 50000, 5.2, 800, 0.5, 0, 5, 2, 3.7, 1}
+
+	t.Run("18 fields", func(t *testing.T) {
+		m := influx.New()
+		if err := parseObservation(&config.Config{}, Report{Obs: [1][]float64{obs}}, m); err != nil {
+			t.Fatalf("parseObservation() error = %v", err)
+		}
+		if _, ok := m.Fields["precip_analysis"]; ok {
+			t.Error("Expected no precip_analysis field for 18 element obs")
+		}
+	})
+
+	t.Run("19 fields", func(t *testing.T) {
+		m := influx.New()
+		extended := append(append([]float64{}, obs...), 1)
+		if err := parseObservation(&config.Config{}, Report{Obs: [1][]float64{extended}}, m); err != nil {
+			t.Fatalf("parseObservation() error = %v", err)
+		}
+		if m.Fields["precip_analysis"] != "1" {
+			t.Errorf("Expected precip_analysis=1, got %q", m.Fields["precip_analysis"])
+		}
+		if m.Fields["temp"] != "25.50" {
+			t.Errorf("Expected temp=25.50, got %s", m.Fields["temp"])
+		}
+	})
+}
+
+func TestParseObservationKelvin(t *testing.T) {
+	report := Report{
+		Obs: [1][]float64{
+			{1640995200, 1.5, 2.3, 3.8, 180, 3, 1013.25, 0.0, 100.0, 50000, 5.2, 800, 0.5, 0, 5, 2, 3.7, 1},
+		},
+	}
+
+	m := influx.New()
+	if err := parseObservation(&config.Config{Kelvin: true, Dew_Point: true, Units: config.UnitsImperial}, report, m); err != nil {
+		t.Fatalf("parseObservation() error = %v", err)
+	}
+
+	if m.Fields["temp_kelvin"] != "273.15" {
+		t.Errorf("Expected temp_kelvin=273.15, got %s", m.Fields["temp_kelvin"])
+	}
+	// At 100% humidity the dew point equals the air temperature
+	if m.Fields["dew_point_kelvin"] != "273.15" {
+		t.Errorf("Expected dew_point_kelvin=273.15, got %s", m.Fields["dew_point_kelvin"])
+	}
+}
+
+func TestBucketRouting(t *testing.T) {
+	cfg := &config.Config{
+		Influx_Bucket:            "default",
+		Influx_Bucket_Rapid_Wind: "legacy-wind",
+		Influx_Buckets: map[string]string{
+			"obs_st":     "observations",
+			"rapid_wind": "wind",
+			"hub_status": "hubs",
+		},
+	}
+
+	tests := map[string]string{
+		"obs_st":     "observations",
+		"rapid_wind": "wind",
+		"hub_status": "hubs",
+		"evt_strike": "default",
+	}
+	for reportType, want := range tests {
+		if got := Bucket(cfg, reportType); got != want {
+			t.Errorf("Bucket(%s) = %s, want %s", reportType, got, want)
+		}
+	}
+
+	// Without a table entry the legacy rapid wind bucket still applies
+	delete(cfg.Influx_Buckets, "rapid_wind")
+	if got := Bucket(cfg, "rapid_wind"); got != "legacy-wind" {
+		t.Errorf("Bucket(rapid_wind) = %s, want legacy-wind", got)
+	}
+}
+
+func TestOrgRouting(t *testing.T) {
+	cfg := &config.Config{
+		Influx_Org:  "users",
+		Influx_Orgs: map[string]string{"hub_status": "ops"},
+	}
+
+	tests := map[string]string{
+		"obs_st":     "users",
+		"hub_status": "ops",
+	}
+	for reportType, want := range tests {
+		if got := Org(cfg, reportType); got != want {
+			t.Errorf("Org(%s) = %s, want %s", reportType, got, want)
+		}
+	}
+}
+
+func TestParseMeasurementPerType(t *testing.T) {
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	obs := `{"serial_number": "ST-123456", "type": "obs_st", "obs": [[1640995200, 1.5, 2.3, 3.8, 180, 3, 1013.25, 25.5, 65.0, 50000, 5.2, 800, 0.5, 0, 5, 2, 3.7, 1]]}`
+	wind := `{"serial_number": "ST-123456", "type": "rapid_wind", "ob": [1640995200, 5.5, 270]}`
+
+	tests := []struct {
+		name    string
+		perType bool
+		payload string
+		want    string
+	}{
+		{"combined obs", false, obs, "weather"},
+		{"combined rapid wind", false, wind, "weather"},
+		{"per type obs", true, obs, "weather"},
+		{"per type rapid wind", true, wind, "rapid_wind"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Influx_Bucket: "test-bucket", Rapid_Wind: true, Measurement_Per_Type: tt.perType}
+
+			m, err := Parse(cfg, addr, []byte(tt.payload), len(tt.payload))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if m.Name != tt.want {
+				t.Errorf("Expected measurement %s, got %s", tt.want, m.Name)
+			}
+		})
+	}
+}
+
+func TestParseObservationEmitRaw(t *testing.T) {
+	cfg := &config.Config{Influx_Bucket: "test-bucket", Emit_Raw: true}
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+
+	raw := `[1640995200,1.5,2.3,3.8,180,3,1013.256,25.55,65,50000,5.2,800,0.123456,0,null,2,3.7,1]`
+	jsonData := `{"serial_number": "ST-123456", "type": "obs_st", "obs": [` + raw + `]}`
+
+	m, err := Parse(cfg, addr, []byte(jsonData), len(jsonData))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	want := `"` + raw + `"`
+	if m.Fields["raw_obs"] != want {
+		t.Errorf("Expected raw_obs=%s, got %s", want, m.Fields["raw_obs"])
+	}
+}
+
+func TestParseObservationCalibration(t *testing.T) {
+	addr, _ := net.ResolveUDPAddr("udp", "192.168.1.100:50222")
+	jsonData := `{"serial_number": "ST-123456", "type": "obs_st", "obs": [[1640995200, 1.5, 2.3, 3.8, 180, 3, 1013.25, 25.5, 98.0, 50000, 5.2, 800, 0.5, 0, 5, 2, 3.7, 1]]}`
+
+	base, err := Parse(&config.Config{Influx_Bucket: "test-bucket", Dew_Point: true}, addr, []byte(jsonData), len(jsonData))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	cfg := &config.Config{Influx_Bucket: "test-bucket", Dew_Point: true, Temp_Offset: -1, Humidity_Offset: 5}
+	m, err := Parse(cfg, addr, []byte(jsonData), len(jsonData))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if m.Fields["temp"] != "24.50" {
+		t.Errorf("Expected temp=24.50, got %s", m.Fields["temp"])
+	}
+	// Humidity is clamped at 100 after the offset
+	if m.Fields["humidity"] != "100.00" {
+		t.Errorf("Expected humidity=100.00, got %s", m.Fields["humidity"])
+	}
+	// At 100% RH the dew point equals the calibrated temperature
+	if m.Fields["dew_point"] != "24.50" || m.Fields["dew_point"] == base.Fields["dew_point"] {
+		t.Errorf("Expected calibrated dew_point=24.50, got %s (uncalibrated %s)", m.Fields["dew_point"], base.Fields["dew_point"])
+	}
+}
+
+func TestParseObservationDewPointDisabled(t *testing.T) {
+	report := Report{
+		Obs: [1][]float64{
+			{1640995200, 1.5, 2.3, 3.8, 180, 3, 1013.25, 25.5, 65.0, 50000, 5.2, 800, 0.5, 0, 5, 2, 3.7, 1},
+		},
+	}
+
+	m := influx.New()
+	if err := parseObservation(&config.Config{Dew_Point: false, Kelvin: true}, report, m); err != nil {
+		t.Fatalf("parseObservation() error = %v", err)
+	}
+
+	for _, field := range []string{"dew_point", "dew_point_kelvin"} {
+		if value, exists := m.Fields[field]; exists {
+			t.Errorf("Expected %s to be omitted, got %s", field, value)
+		}
+	}
+	if m.Fields["temp"] != "25.50" {
+		t.Errorf("Expected temp=25.50, got %s", m.Fields["temp"])
+	}
+}
+
+func TestParseObservationConditions(t *testing.T) {
+	report := Report{
+		ReportType: "obs_st",
+		Obs: [1][]float64{
+			{1640995200, 1.5, 5.3, 6.8, 268, 3, 1013.25, 14.2, 80.0, 5000, 0.5, 40, 0.5, 1, 0, 0, 2.6, 1},
+		},
+	}
+
+	m := influx.New()
+	if err := parseObservation(&config.Config{Conditions_String: true}, report, m); err != nil {
+		t.Fatalf("parseObservation() error = %v", err)
+	}
+	if want := `"Rain, 14.2C, W 5.3 m/s"`; m.Fields["conditions"] != want {
+		t.Errorf("Expected conditions=%s, got %s", want, m.Fields["conditions"])
+	}
+}
@@ -0,0 +1,153 @@
+package tempest
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+	"github.com/jacaudi/tempest-influxdb/internal/influx"
+)
+
+// Sensor failure bits reported in the sensor_status bitfield
+const (
+	SensorLightningFailed    = 0x00000001
+	SensorLightningNoise     = 0x00000002
+	SensorLightningDisturber = 0x00000004
+	SensorPressureFailed     = 0x00000008
+	SensorTemperatureFailed  = 0x00000010
+	SensorHumidityFailed     = 0x00000020
+	SensorWindFailed         = 0x00000040
+	SensorPrecipFailed       = 0x00000080
+	SensorLightUVFailed      = 0x00000100
+)
+
+// Physical maxima for light readings. Direct sunlight peaks around 120000 lux
+// and 1400 W/m², so anything beyond these is a bogus reading.
+const (
+	MaxIlluminance    = 200000 // lux
+	MaxSolarRadiation = 1500   // W/m²
+)
+
+// ObsFieldCount is the number of values in an obs_st observation
+const ObsFieldCount = 18
+
+// obsSensor maps each obs_st index to the sensor failure bit that makes it
+// unreliable. Indexes without a sensor (timestamp, battery, interval) are 0.
+var obsSensor = [ObsFieldCount]int{
+	0,                       // timestamp
+	SensorWindFailed,        // wind lull
+	SensorWindFailed,        // wind avg
+	SensorWindFailed,        // wind gust
+	SensorWindFailed,        // wind direction
+	SensorWindFailed,        // wind sample interval
+	SensorPressureFailed,    // station pressure
+	SensorTemperatureFailed, // air temperature
+	SensorHumidityFailed,    // relative humidity
+	SensorLightUVFailed,     // illuminance
+	SensorLightUVFailed,     // uv
+	SensorLightUVFailed,     // solar radiation
+	SensorPrecipFailed,      // precipitation accumulation
+	SensorPrecipFailed,      // precipitation type
+	SensorLightningFailed,   // strike avg distance
+	SensorLightningFailed,   // strike count
+	0,                       // battery
+	0,                       // interval
+}
+
+// sensorFields lists the emitted obs_st fields that depend on each sensor, so
+// they can be left out when sensor_status flags the sensor as failed
+var sensorFields = []struct {
+	bit    int
+	fields []string
+}{
+	{SensorWindFailed, []string{"wind_avg", "wind_direction", "wind_direction_magnetic", "wind_gust", "wind_lull", "wind_cardinal", "conditions"}},
+	{SensorPressureFailed, []string{"p", "p_inhg", "pressure_altitude", "enthalpy"}},
+	{SensorTemperatureFailed, []string{"temp", "temp_kelvin", "dew_point", "dew_point_kelvin", "wet_bulb", "frost_risk", "enthalpy", "conditions"}},
+	{SensorHumidityFailed, []string{"humidity", "dew_point", "dew_point_kelvin", "wet_bulb", "frost_risk", "enthalpy"}},
+	{SensorPrecipFailed, []string{"precipitation", "precipitation_type", "precipitation_type_str", "precip_analysis", "conditions"}},
+	{SensorLightUVFailed, []string{"illuminance", "uv", "uv_category", "solar_radiation"}},
+	{SensorLightningFailed, []string{"strike_count", "strike_distance"}},
+}
+
+// omitFailedSensorFields removes the fields sensor_status flags as coming
+// from a failed sensor, including values derived from them
+func omitFailedSensorFields(report Report, m *influx.Data) {
+	for _, sensor := range sensorFields {
+		if report.SensorStatus&sensor.bit == 0 {
+			continue
+		}
+		for _, field := range sensor.fields {
+			delete(m.Fields, field)
+		}
+	}
+}
+
+// UnmarshalJSON decodes a Report, additionally recording which obs values
+// were sent as null since they otherwise decode indistinguishably from zero
+func (r *Report) UnmarshalJSON(data []byte) error {
+	type plain Report
+	if err := json.Unmarshal(data, (*plain)(r)); err != nil {
+		return err
+	}
+
+	var raw struct {
+		Obs [][]*float64 `json:"obs"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	r.obsNull = nil
+	if len(raw.Obs) > 0 {
+		r.obsNull = make([]bool, len(raw.Obs[0]))
+		for i, value := range raw.Obs[0] {
+			r.obsNull[i] = value == nil
+		}
+	}
+	return nil
+}
+
+// ValidFieldCount returns how many of the expected obs_st values are present.
+// A value is invalid if it was sent as null or if sensor_status flags the
+// sensor that produced it as failed, so genuine zeros such as no rain still
+// count as valid.
+func ValidFieldCount(report Report) int {
+	valid := 0
+	for i := 0; i < ObsFieldCount && i < len(report.Obs[0]); i++ {
+		if i < len(report.obsNull) && report.obsNull[i] {
+			continue
+		}
+		if report.SensorStatus&obsSensor[i] != 0 {
+			continue
+		}
+		valid++
+	}
+	return valid
+}
+
+// IsWarmupObs reports whether an obs_st report has zero air temperature,
+// station pressure and relative humidity at once, which happens while the
+// sensors warm up after boot. Any one of them can legitimately be zero (0 C,
+// bone dry air) but pressure never is, and all three together is impossible.
+func IsWarmupObs(report Report) bool {
+	data := report.Obs[0]
+	if len(data) < ObsFieldCount {
+		return false
+	}
+	return data[6] == 0 && data[7] == 0 && data[8] == 0
+}
+
+// clampReading limits a sensor reading to 0..max so bogus values neither
+// reach InfluxDB nor overflow int conversion. A faulty sensor is clamped on
+// every obs, so clamping is only logged with Debug.
+func clampReading(cfg *config.Config, name string, value float64, max float64) float64 {
+	if value >= 0 && value <= max {
+		return value
+	}
+	clamped := math.Max(0, math.Min(max, value))
+	if cfg.Debug {
+		log.Printf("Clamping %s reading %g to %g", name, value, clamped)
+	}
+	return clamped
+}
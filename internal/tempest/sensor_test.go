@@ -0,0 +1,210 @@
+package tempest
+
+import (
+	"bytes"
+	"log"
+	"testing"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+)
+
+func TestValidFieldCount(t *testing.T) {
+	full := `{"type": "obs_st", "obs": [[1640995200, 0, 0, 0, 0, 3, 1013.25, 25.5, 65.0, 0, 0, 0, 0, 0, 0, 0, 3.7, 1]]}`
+
+	tests := []struct {
+		name         string
+		json         string
+		sensorStatus int
+		want         int
+	}{
+		{"fully populated with genuine zeros", full, 0, ObsFieldCount},
+		{"failed pressure sensor", full, SensorPressureFailed, ObsFieldCount - 1},
+		{"failed wind sensor", full, SensorWindFailed, ObsFieldCount - 5},
+		{"lightning noise is not a failure", full, SensorLightningNoise, ObsFieldCount},
+		{
+			"null values",
+			`{"type": "obs_st", "obs": [[1640995200, 0, 0, 0, 0, 3, null, null, 65.0, 0, 0, 0, 0, 0, 0, 0, 3.7, 1]]}`,
+			0,
+			ObsFieldCount - 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := DecodeReport([]byte(tt.json))
+			if err != nil {
+				t.Fatalf("DecodeReport() error = %v", err)
+			}
+			report.SensorStatus = tt.sensorStatus
+
+			if got := ValidFieldCount(report); got != tt.want {
+				t.Errorf("ValidFieldCount() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidFieldCountDirectReport(t *testing.T) {
+	report := Report{Obs: [1][]float64{make([]float64, ObsFieldCount)}}
+
+	if got := ValidFieldCount(report); got != ObsFieldCount {
+		t.Errorf("ValidFieldCount() = %d, want %d", got, ObsFieldCount)
+	}
+}
+
+func TestReportBattery(t *testing.T) {
+	tests := []struct {
+		name   string
+		json   string
+		want   float64
+		wantOK bool
+	}{
+		{"obs", `{"type": "obs_st", "obs": [[1640995200, 0, 0, 0, 0, 3, 1013.25, 25.5, 65.0, 0, 0, 0, 0, 0, 0, 0, 2.41, 1]]}`, 2.41, true},
+		{"null battery", `{"type": "obs_st", "obs": [[1640995200, 0, 0, 0, 0, 3, 1013.25, 25.5, 65.0, 0, 0, 0, 0, 0, 0, 0, null, 1]]}`, 0, false},
+		{"short obs", `{"type": "obs_st", "obs": [[1640995200, 0, 0]]}`, 0, false},
+		{"rapid wind", `{"type": "rapid_wind", "ob": [1640995200, 2.3, 180]}`, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := DecodeReport([]byte(tt.json))
+			if err != nil {
+				t.Fatalf("DecodeReport() error = %v", err)
+			}
+			if got, ok := report.Battery(); got != tt.want || ok != tt.wantOK {
+				t.Errorf("Battery() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestReportAirTemperature(t *testing.T) {
+	tests := []struct {
+		name   string
+		json   string
+		want   float64
+		wantOK bool
+	}{
+		{"obs", `{"type": "obs_st", "obs": [[1640995200, 0, 0, 0, 0, 3, 1013.25, -4.5, 65.0, 0, 0, 0, 0, 0, 0, 0, 2.41, 1]]}`, -4.5, true},
+		{"null temperature", `{"type": "obs_st", "obs": [[1640995200, 0, 0, 0, 0, 3, 1013.25, null, 65.0, 0, 0, 0, 0, 0, 0, 0, 2.41, 1]]}`, 0, false},
+		{"short obs", `{"type": "obs_st", "obs": [[1640995200, 0, 0]]}`, 0, false},
+		{"rapid wind", `{"type": "rapid_wind", "ob": [1640995200, 2.3, 180]}`, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := DecodeReport([]byte(tt.json))
+			if err != nil {
+				t.Fatalf("DecodeReport() error = %v", err)
+			}
+			if got, ok := report.AirTemperature(); got != tt.want || ok != tt.wantOK {
+				t.Errorf("AirTemperature() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestSkipZeroObs(t *testing.T) {
+	cfg := &config.Config{Influx_Bucket: "test-bucket", Skip_Zero_Obs: true}
+
+	tests := []struct {
+		name    string
+		payload string
+		skipped bool
+	}{
+		{
+			name:    "warm-up obs",
+			payload: `{"serial_number": "ST-1", "type": "obs_st", "obs": [[1640995200, 0, 0, 0, 0, 3, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2.6, 1]]}`,
+			skipped: true,
+		},
+		{
+			name:    "calm dry freezing obs",
+			payload: `{"serial_number": "ST-1", "type": "obs_st", "obs": [[1640995200, 0, 0, 0, 0, 3, 1013.25, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2.6, 1]]}`,
+			skipped: false,
+		},
+		{
+			name:    "normal obs",
+			payload: `{"serial_number": "ST-1", "type": "obs_st", "obs": [[1640995200, 1.5, 2.3, 3.8, 180, 3, 1013.25, 25.5, 65.0, 50000, 5.2, 800, 0.5, 0, 5, 2, 3.7, 1]]}`,
+			skipped: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Parse(cfg, nil, []byte(tt.payload), len(tt.payload))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if (m == nil) != tt.skipped {
+				t.Errorf("Expected skipped=%v, got point %v", tt.skipped, m)
+			}
+		})
+	}
+}
+
+func TestClampLightReadings(t *testing.T) {
+	var logs bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&logs)
+
+	cfg := &config.Config{Influx_Bucket: "test-bucket"}
+	payload := `{"serial_number": "ST-1", "type": "obs_st", "obs": [[1640995200, 1.5, 2.3, 3.8, 180, 3, 1013.25, 25.5, 65.0, 1e300, 5.2, -40, 0.5, 0, 5, 2, 3.7, 1]]}`
+
+	m, err := Parse(cfg, nil, []byte(payload), len(payload))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if logs.Len() != 0 {
+		t.Errorf("Expected clamping to be logged only with debug, got %s", logs.String())
+	}
+
+	if m.Fields["illuminance"] != "200000" {
+		t.Errorf("Expected illuminance clamped to 200000, got %s", m.Fields["illuminance"])
+	}
+	if m.Fields["solar_radiation"] != "0" {
+		t.Errorf("Expected solar_radiation clamped to 0, got %s", m.Fields["solar_radiation"])
+	}
+}
+
+func TestHonorSensorStatus(t *testing.T) {
+	packet := `{"serial_number": "ST-1", "type": "obs_st", "sensor_status": 8, "obs": [[1640995200, 1.5, 2.3, 3.8, 180, 3, 1013.25, 25.5, 65.0, 50000, 5.2, 800, 0.5, 0, 5, 2, 3.7, 1]]}`
+
+	m, err := Parse(&config.Config{Dew_Point: true}, nil, []byte(packet), len(packet))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if _, ok := m.Fields["p"]; !ok {
+		t.Error("Expected p to be written when sensor status is ignored")
+	}
+
+	m, err = Parse(&config.Config{Dew_Point: true, Honor_Sensor_Status: true}, nil, []byte(packet), len(packet))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if _, ok := m.Fields["p"]; ok {
+		t.Errorf("Expected p to be omitted for a failed pressure sensor, got %s", m.Fields["p"])
+	}
+	for _, field := range []string{"temp", "humidity", "dew_point", "wind_avg"} {
+		if _, ok := m.Fields[field]; !ok {
+			t.Errorf("Expected %s to remain", field)
+		}
+	}
+}
+
+func TestHonorSensorStatusWind(t *testing.T) {
+	packet := `{"serial_number": "ST-1", "type": "obs_st", "sensor_status": 64, "obs": [[1640995200, 1.5, 2.3, 3.8, 180, 3, 1013.25, 25.5, 65.0, 50000, 5.2, 800, 0.5, 0, 5, 2, 3.7, 1]]}`
+	cfg := &config.Config{Honor_Sensor_Status: true, Wind_Declination: 10, Categorical_Fields: true}
+
+	m, err := Parse(cfg, nil, []byte(packet), len(packet))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	for _, field := range []string{"wind_avg", "wind_direction", "wind_direction_magnetic", "wind_cardinal"} {
+		if value, ok := m.Fields[field]; ok {
+			t.Errorf("Expected %s to be omitted for a failed wind sensor, got %s", field, value)
+		}
+	}
+	if _, ok := m.Fields["temp"]; !ok {
+		t.Error("Expected temp to remain")
+	}
+}
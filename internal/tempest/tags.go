@@ -0,0 +1,117 @@
+package tempest
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+	"github.com/jacaudi/tempest-influxdb/internal/influx"
+)
+
+// identityTags tell apart points that would otherwise share a series and
+// timestamp and overwrite each other: the device a point came from, and the
+// rapid wind counter within a second. They are never dropped by Max_Tags.
+var identityTags = []string{"station", "hub", "rapid_wind_seq"}
+
+// ConfiguredTags returns the tags the configuration can put on an obs
+// point, highest priority first, as an estimate of the series cardinality
+// it adds. Static tags and tags from the report count alike, since each
+// distinct combination of values is a separate series.
+func ConfiguredTags(cfg *config.Config) []string {
+	names := map[string]bool{"station": true}
+	if cfg.Unit_Tags {
+		for tag := range UnitTags(cfg) {
+			names[tag] = true
+		}
+	}
+	for _, name := range cfg.Tag_Fields {
+		names[name] = true
+	}
+	if cfg.Collector_ID != "" {
+		names["collector"] = true
+	}
+	if cfg.Schema_Tag != "" {
+		names["schema"] = true
+	}
+	if cfg.Emit_Source_IP {
+		names["source_ip"] = true
+	}
+	if cfg.Rapid_Wind_Seq {
+		names["rapid_wind_seq"] = true
+	}
+	for _, entry := range cfg.Common_Tags {
+		name, _, _ := strings.Cut(entry, "=")
+		names[name] = true
+	}
+
+	tags := make([]string, 0, len(names))
+	for name := range names {
+		tags = append(tags, name)
+	}
+	return rankTags(cfg, tags)
+}
+
+// LimitTags removes the lowest priority tags of m beyond Max_Tags and
+// returns their names, lowest priority last. It does nothing when Max_Tags
+// is 0.
+func LimitTags(cfg *config.Config, m *influx.Data) []string {
+	if cfg.Max_Tags <= 0 || len(m.Tags) <= cfg.Max_Tags {
+		return nil
+	}
+
+	names := make([]string, 0, len(m.Tags))
+	for name := range m.Tags {
+		names = append(names, name)
+	}
+	_, dropped := SplitTags(cfg, names)
+	for _, name := range dropped {
+		delete(m.Tags, name)
+	}
+	return dropped
+}
+
+// SplitTags ranks names with rankTags and splits them into those kept under
+// Max_Tags and those dropped. Identity tags are always kept and don't count
+// against Max_Tags.
+func SplitTags(cfg *config.Config, names []string) (kept []string, dropped []string) {
+	ranked := rankTags(cfg, names)
+	if cfg.Max_Tags <= 0 {
+		return ranked, nil
+	}
+
+	limit := cfg.Max_Tags
+	for _, name := range ranked {
+		if slices.Contains(identityTags, name) {
+			limit++
+		}
+	}
+	if len(ranked) <= limit {
+		return ranked, nil
+	}
+	return ranked[:limit], ranked[limit:]
+}
+
+// rankTags sorts names highest priority first: the identity tags, then
+// Tag_Priority entries in the order listed, then the rest by name
+func rankTags(cfg *config.Config, names []string) []string {
+	rank := make(map[string]int, len(cfg.Tag_Priority)+len(identityTags))
+	for _, name := range append(append([]string{}, identityTags...), cfg.Tag_Priority...) {
+		if _, ok := rank[name]; !ok {
+			rank[name] = len(rank)
+		}
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		ri, iRanked := rank[names[i]]
+		rj, jRanked := rank[names[j]]
+		switch {
+		case iRanked && jRanked:
+			return ri < rj
+		case iRanked != jRanked:
+			return iRanked
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
@@ -0,0 +1,86 @@
+package tempest
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+	"github.com/jacaudi/tempest-influxdb/internal/influx"
+)
+
+func TestLimitTags(t *testing.T) {
+	newPoint := func() *influx.Data {
+		m := influx.New()
+		m.Tags["station"] = "ST-1"
+		m.Tags["collector"] = "garage"
+		m.Tags["schema"] = "v2"
+		m.Tags["source_ip"] = "192.168.1.100"
+		return m
+	}
+
+	tests := []struct {
+		name     string
+		priority []string
+		kept     map[string]string
+		dropped  []string
+	}{
+		{
+			name:     "configured priority",
+			priority: []string{"source_ip", "schema"},
+			kept:     map[string]string{"station": "ST-1", "source_ip": "192.168.1.100", "schema": "v2"},
+			dropped:  []string{"collector"},
+		},
+		{
+			name:    "by name by default",
+			kept:    map[string]string{"station": "ST-1", "collector": "garage", "schema": "v2"},
+			dropped: []string{"source_ip"},
+		},
+		{
+			name:     "station outside the limit",
+			priority: []string{"schema", "collector", "source_ip"},
+			kept:     map[string]string{"station": "ST-1", "schema": "v2", "collector": "garage"},
+			dropped:  []string{"source_ip"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newPoint()
+			dropped := LimitTags(&config.Config{Max_Tags: 2, Tag_Priority: tt.priority}, m)
+			if !reflect.DeepEqual(m.Tags, tt.kept) {
+				t.Errorf("Expected tags %v, got %v", tt.kept, m.Tags)
+			}
+			if !reflect.DeepEqual(dropped, tt.dropped) {
+				t.Errorf("Expected %v dropped, got %v", tt.dropped, dropped)
+			}
+		})
+	}
+
+	m := newPoint()
+	if dropped := LimitTags(&config.Config{}, m); dropped != nil || len(m.Tags) != 4 {
+		t.Errorf("Expected no limit without max_tags, dropped %v", dropped)
+	}
+
+	// Rapid wind keeps its seq so same-second points stay distinct
+	m = influx.New()
+	m.Tags["station"] = "ST-1"
+	m.Tags["rapid_wind_seq"] = "1"
+	m.Tags["collector"] = "garage"
+	if dropped := LimitTags(&config.Config{Max_Tags: 1, Tag_Priority: []string{"collector"}}, m); dropped != nil || len(m.Tags) != 3 {
+		t.Errorf("Expected identity tags to be kept beyond max_tags, dropped %v", dropped)
+	}
+}
+
+func TestConfiguredTags(t *testing.T) {
+	cfg := &config.Config{
+		Collector_ID:   "garage",
+		Emit_Source_IP: true,
+		Common_Tags:    []string{"hub", "location=backyard"},
+		Tag_Priority:   []string{"location"},
+	}
+
+	want := []string{"station", "hub", "location", "collector", "source_ip"}
+	if got := ConfiguredTags(cfg); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,145 @@
+package tempest
+
+import (
+	"math"
+	"time"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+	"github.com/jacaudi/tempest-influxdb/internal/influx"
+)
+
+// DailyTotals accumulates a station's obs over one local calendar day
+type DailyTotals struct {
+	Day     string  `json:"day"`      // local date, YYYY-MM-DD
+	Rain    float64 `json:"rain"`     // mm
+	WindRun float64 `json:"wind_run"` // km
+	Strikes int     `json:"strikes"`
+}
+
+// dayFormat is the layout of DailyTotals.Day
+const dayFormat = "2006-01-02"
+
+// Day returns the local calendar day of t in the DailyTotals.Day format
+func Day(t time.Time) string {
+	return t.Local().Format(dayFormat)
+}
+
+// DayEnd returns the last second of a DailyTotals.Day, which is used as the
+// timestamp of a day's final totals
+func DayEnd(day string) (time.Time, error) {
+	start, err := time.ParseInLocation(dayFormat, day, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return start.AddDate(0, 0, 1).Add(-time.Second), nil
+}
+
+// ObsTotals returns what an obs_st report adds to the daily totals: the rain
+// over its interval, the wind run at its average wind speed over the interval
+// and its strike count
+func ObsTotals(report Report) DailyTotals {
+	data := report.Obs[0]
+	if len(data) < ObsFieldCount {
+		return DailyTotals{}
+	}
+
+	interval := time.Duration(math.Round(data[17])) * time.Minute
+	return DailyTotals{
+		Rain:    data[12],
+		WindRun: data[2] * interval.Seconds() / 1000,
+		Strikes: report.StrikeCount(),
+	}
+}
+
+// Add adds another report's totals to d
+func (d *DailyTotals) Add(other DailyTotals) {
+	d.Rain += other.Rain
+	d.WindRun += other.WindRun
+	d.Strikes += other.Strikes
+}
+
+// SetDailyTotalsFields sets the daily total fields on m in the configured
+// units
+func SetDailyTotalsFields(cfg *config.Config, m *influx.Data, totals DailyTotals) {
+	values := map[string]float64{
+		"rain_today":     convertPrecip(cfg, totals.Rain),
+		"wind_run_today": convertLength(cfg, totals.WindRun),
+		"strikes_today":  float64(totals.Strikes),
+	}
+	for name, value := range values {
+		m.Fields[FieldName(cfg, name)] = FormatField(name, value)
+	}
+}
+
+// TempRange is a station's lowest and highest air temperature in C over one
+// local calendar day
+type TempRange struct {
+	Day   string  `json:"day"` // local date, YYYY-MM-DD
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Count int     `json:"count"` // obs included
+}
+
+// Add widens r to include temp, starting the range if it is empty
+func (r *TempRange) Add(temp float64) {
+	if r.Count == 0 {
+		r.Min, r.Max = temp, temp
+	} else {
+		r.Min = math.Min(r.Min, temp)
+		r.Max = math.Max(r.Max, temp)
+	}
+	r.Count++
+}
+
+// SetTempRangeFields sets temp_min and temp_max on m in the configured
+// units
+func SetTempRangeFields(cfg *config.Config, m *influx.Data, r TempRange) {
+	m.Fields[FieldName(cfg, "temp_min")] = FormatField("temp_min", convertTemp(cfg, r.Min))
+	m.Fields[FieldName(cfg, "temp_max")] = FormatField("temp_max", convertTemp(cfg, r.Max))
+}
+
+// GrowingDegreeDays returns the growing degree days in C days of a day with
+// temperature range r, by the averaging method: the mean of the low and
+// high less base, or 0 if the mean is below base
+func GrowingDegreeDays(r TempRange, base float64) float64 {
+	if r.Count == 0 {
+		return 0
+	}
+	return math.Max(0, (r.Min+r.Max)/2-base)
+}
+
+// SetGDDField sets gdd on m from r, in degree days of the configured
+// temperature unit
+func SetGDDField(cfg *config.Config, m *influx.Data, r TempRange) {
+	m.Fields[FieldName(cfg, "gdd")] = FormatField("gdd", convertDegreeDays(cfg, GrowingDegreeDays(r, cfg.GDD_Base_Temp)))
+}
+
+// GDDPoint builds a point carrying only a station's growing degree days for
+// the day of r, for writing a finished day's value
+func GDDPoint(cfg *config.Config, serial string, at time.Time, r TempRange) *influx.Data {
+	m := stationPoint(cfg, serial, at)
+	SetGDDField(cfg, m, r)
+	return m
+}
+
+// stationPoint builds an obs_st point for a station at a time, with the tags
+// every obs carries but no fields
+func stationPoint(cfg *config.Config, serial string, at time.Time) *influx.Data {
+	m := influx.New()
+	m.Name = Measurement(cfg, "obs_st")
+	m.Bucket = Bucket(cfg, "obs_st")
+	m.Org = Org(cfg, "obs_st")
+	m.Timestamp = scaleTimestamp(cfg, float64(at.Unix()))
+	m.Tags["station"] = serial
+	staticTags(cfg, m)
+	commonTags(cfg, m, Report{StationSerial: serial, ReportType: "obs_st"})
+	return m
+}
+
+// DailyTotalsPoint builds a point carrying only a station's daily totals, for
+// writing them without a coincident obs
+func DailyTotalsPoint(cfg *config.Config, serial string, at time.Time, totals DailyTotals) *influx.Data {
+	m := stationPoint(cfg, serial, at)
+	SetDailyTotalsFields(cfg, m, totals)
+	return m
+}
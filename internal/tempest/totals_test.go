@@ -0,0 +1,93 @@
+package tempest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+	"github.com/jacaudi/tempest-influxdb/internal/influx"
+)
+
+func TestObsTotals(t *testing.T) {
+	// 0.5mm of rain, 2.3 m/s average wind over 1 minute and 2 strikes
+	report := Report{
+		ReportType: "obs_st",
+		Obs:        [1][]float64{{1640995200, 1.5, 2.3, 3.8, 180, 3, 1013.25, 25.5, 65.0, 50000, 5.2, 800, 0.5, 0, 5, 2, 3.7, 1}},
+	}
+
+	totals := ObsTotals(report)
+	if totals.Rain != 0.5 || totals.Strikes != 2 {
+		t.Errorf("Unexpected totals %+v", totals)
+	}
+	if want := 2.3 * 60 / 1000; totals.WindRun != want {
+		t.Errorf("Expected wind run %f km, got %f", want, totals.WindRun)
+	}
+}
+
+func TestDailyTotalsPoint(t *testing.T) {
+	end, err := DayEnd("2024-06-01")
+	if err != nil {
+		t.Fatalf("DayEnd() error = %v", err)
+	}
+	if want := time.Date(2024, 6, 1, 23, 59, 59, 0, time.Local); !end.Equal(want) {
+		t.Errorf("Expected day end %v, got %v", want, end)
+	}
+
+	cfg := &config.Config{Influx_Bucket: "test-bucket", Units: config.UnitsImperial, Schema_Tag: "3"}
+	m := DailyTotalsPoint(cfg, "ST-1", end, DailyTotals{Day: "2024-06-01", Rain: 25.4, WindRun: 1.609344, Strikes: 3})
+
+	if m.Name != "weather" || m.Bucket != "test-bucket" || m.Tags["station"] != "ST-1" || m.Tags["schema"] != "3" || m.Timestamp != end.Unix() {
+		t.Errorf("Unexpected point %+v", m)
+	}
+	want := map[string]string{"rain_today": "1.00", "wind_run_today": "1.00", "strikes_today": "3"}
+	for field, value := range want {
+		if m.Fields[field] != value {
+			t.Errorf("Expected %s=%s, got %s", field, value, m.Fields[field])
+		}
+	}
+}
+
+func TestTempRange(t *testing.T) {
+	var r TempRange
+	for _, temp := range []float64{-2, 5, 3} {
+		r.Add(temp)
+	}
+	if r.Min != -2 || r.Max != 5 || r.Count != 3 {
+		t.Errorf("Unexpected range %+v", r)
+	}
+
+	m := influx.New()
+	SetTempRangeFields(&config.Config{Units: config.UnitsImperial}, m, r)
+	if m.Fields["temp_min"] != "28.40" || m.Fields["temp_max"] != "41.00" {
+		t.Errorf("Expected temp_min=28.40 and temp_max=41.00, got %v", m.Fields)
+	}
+}
+
+func TestGrowingDegreeDays(t *testing.T) {
+	tests := []struct {
+		name     string
+		min, max float64
+		base     float64
+		want     float64
+	}{
+		{"warm day", 12, 28, 10, 10},
+		{"mean below base", 2, 14, 10, 0},
+		{"base 0", -4, 10, 0, 3},
+	}
+	for _, tt := range tests {
+		r := TempRange{Day: "2024-06-01", Min: tt.min, Max: tt.max, Count: 2}
+		if got := GrowingDegreeDays(r, tt.base); got != tt.want {
+			t.Errorf("%s: expected %v GDD, got %v", tt.name, tt.want, got)
+		}
+	}
+	if got := GrowingDegreeDays(TempRange{}, 10); got != 0 {
+		t.Errorf("Expected 0 GDD for an empty range, got %v", got)
+	}
+
+	// Fahrenheit degree days are 9/5 as many
+	m := influx.New()
+	SetGDDField(&config.Config{Units: config.UnitsImperial, GDD_Base_Temp: 10}, m, TempRange{Min: 12, Max: 28, Count: 2})
+	if m.Fields["gdd"] != "18.00" {
+		t.Errorf("Expected gdd=18.00 in imperial units, got %s", m.Fields["gdd"])
+	}
+}
@@ -0,0 +1,151 @@
+package tempest
+
+import (
+	"math"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+)
+
+// unitTags describes each unit system as tags so consumers know what they're reading
+var unitTags = map[string]map[string]string{
+	config.UnitsMetric: {
+		"distance_unit": "km",
+		"precip_unit":   "mm",
+		"pressure_unit": "hPa",
+		"temp_unit":     "C",
+		"wind_unit":     "m/s",
+	},
+	config.UnitsImperial: {
+		"distance_unit": "mi",
+		"precip_unit":   "in",
+		"pressure_unit": "inHg",
+		"temp_unit":     "F",
+		"wind_unit":     "mph",
+	},
+}
+
+// UnitTags returns the unit tags for the configured unit system, with any
+// Field_Units overrides applied
+func UnitTags(cfg *config.Config) map[string]string {
+	tags, ok := unitTags[cfg.Units]
+	if !ok {
+		tags = unitTags[config.UnitsMetric]
+	}
+	if len(cfg.Field_Units) == 0 {
+		return tags
+	}
+
+	overridden := make(map[string]string, len(tags))
+	for tag, unit := range tags {
+		overridden[tag] = unit
+	}
+	for quantity, unit := range cfg.Field_Units {
+		overridden[quantity+"_unit"] = unit
+	}
+	return overridden
+}
+
+// unitConversions converts each quantity from the metric unit the station
+// reports in to every unit in config.SupportedUnits
+var unitConversions = map[string]map[string]func(float64) float64{
+	config.QuantityTemp: {
+		"C": func(c float64) float64 { return c },
+		"F": func(c float64) float64 { return c*9/5 + 32 },
+		"K": celsiusToKelvin,
+	},
+	config.QuantityWind: {
+		"m/s":   func(ms float64) float64 { return ms },
+		"km/h":  func(ms float64) float64 { return ms * 3.6 },
+		"mph":   func(ms float64) float64 { return ms * 2.2369362921 },
+		"knots": func(ms float64) float64 { return ms * 1.9438444924 },
+	},
+	config.QuantityPressure: {
+		"hPa":  func(hpa float64) float64 { return hpa },
+		"kPa":  func(hpa float64) float64 { return hpa / 10 },
+		"inHg": hpaToInHg,
+		"mmHg": func(hpa float64) float64 { return hpa * 0.750061683 },
+	},
+	config.QuantityPrecip: {
+		"mm": func(mm float64) float64 { return mm },
+		"in": func(mm float64) float64 { return mm / 25.4 },
+	},
+	config.QuantityDistance: {
+		"km": func(km float64) float64 { return km },
+		"mi": func(km float64) float64 { return km * 0.621371192 },
+	},
+}
+
+// targetUnit returns the unit a quantity is emitted in: its Field_Units
+// override if set, otherwise the unit of the configured unit system
+func targetUnit(cfg *config.Config, quantity string) string {
+	if unit, ok := cfg.Field_Units[quantity]; ok {
+		return unit
+	}
+	return UnitTags(cfg)[quantity+"_unit"]
+}
+
+// convert converts a value of quantity from its metric unit to unit. Units
+// are validated when config is loaded, so an unknown unit passes the value
+// through unchanged.
+func convert(quantity string, value float64, unit string) float64 {
+	if conversion, ok := unitConversions[quantity][unit]; ok {
+		return conversion(value)
+	}
+	return value
+}
+
+// convertTemp converts a temperature in C to the configured unit
+func convertTemp(cfg *config.Config, c float64) float64 {
+	return convert(config.QuantityTemp, c, targetUnit(cfg, config.QuantityTemp))
+}
+
+// convertDegreeDays converts degree days in C to the configured temperature
+// unit. Only the size of a degree matters, so Kelvin is unchanged.
+func convertDegreeDays(cfg *config.Config, c float64) float64 {
+	return convertTemp(cfg, c) - convertTemp(cfg, 0)
+}
+
+// celsiusToKelvin converts a temperature in C to K
+func celsiusToKelvin(c float64) float64 {
+	return c + 273.15
+}
+
+// convertSpeed converts a speed in m/s to the configured unit
+func convertSpeed(cfg *config.Config, ms float64) float64 {
+	return convert(config.QuantityWind, ms, targetUnit(cfg, config.QuantityWind))
+}
+
+// convertPressure converts a pressure in hPa to the configured unit
+func convertPressure(cfg *config.Config, hpa float64) float64 {
+	return convert(config.QuantityPressure, hpa, targetUnit(cfg, config.QuantityPressure))
+}
+
+// convertAltitude converts an altitude in m to feet for imperial units,
+// following the unit system as there is no Field_Units quantity for it
+func convertAltitude(cfg *config.Config, m float64) float64 {
+	if cfg.Units == config.UnitsImperial {
+		return m / 0.3048
+	}
+	return m
+}
+
+// hpaToInHg converts a pressure in hPa to inHg
+func hpaToInHg(hpa float64) float64 {
+	return hpa * 0.0295299830714
+}
+
+// convertPrecip converts a precipitation amount in mm to the configured unit
+func convertPrecip(cfg *config.Config, mm float64) float64 {
+	return convert(config.QuantityPrecip, mm, targetUnit(cfg, config.QuantityPrecip))
+}
+
+// convertLength converts a length in km to the configured unit
+func convertLength(cfg *config.Config, km float64) float64 {
+	return convert(config.QuantityDistance, km, targetUnit(cfg, config.QuantityDistance))
+}
+
+// convertDistance converts a distance in km to the configured unit, rounded
+// to whole units to keep the field an integer
+func convertDistance(cfg *config.Config, km int) int {
+	return int(math.Round(convertLength(cfg, float64(km))))
+}
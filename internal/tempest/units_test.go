@@ -0,0 +1,125 @@
+package tempest
+
+import (
+	"math"
+	"testing"
+
+	"github.com/jacaudi/tempest-influxdb/internal/config"
+)
+
+func TestUnitConversions(t *testing.T) {
+	cfg := &config.Config{Units: config.UnitsImperial}
+
+	tests := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"temp", convertTemp(cfg, 100), 212},
+		{"speed", convertSpeed(cfg, 1), 2.2369},
+		{"pressure", convertPressure(cfg, 1013.25), 29.92},
+		{"precip", convertPrecip(cfg, 25.4), 1},
+		{"distance", float64(convertDistance(cfg, 16)), 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if math.Abs(tt.got-tt.want) > 0.01 {
+				t.Errorf("got %.4f, want %.4f", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnitConversionsMetricPassthrough(t *testing.T) {
+	cfg := &config.Config{}
+
+	if convertTemp(cfg, 25.5) != 25.5 || convertSpeed(cfg, 3) != 3 || convertPressure(cfg, 1000) != 1000 {
+		t.Error("Expected metric values to pass through unchanged")
+	}
+}
+
+func TestUnitTags(t *testing.T) {
+	tests := []struct {
+		units    string
+		tempUnit string
+	}{
+		{"", "C"},
+		{config.UnitsMetric, "C"},
+		{config.UnitsImperial, "F"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.units, func(t *testing.T) {
+			tags := UnitTags(&config.Config{Units: tt.units})
+			if tags["temp_unit"] != tt.tempUnit {
+				t.Errorf("Expected temp_unit=%s, got %s", tt.tempUnit, tags["temp_unit"])
+			}
+		})
+	}
+}
+
+func TestParseObservationDualPressure(t *testing.T) {
+	packet := `{"serial_number": "ST-1", "type": "obs_st", "obs": [[1640995200, 1.5, 2.3, 3.8, 180, 3, 1013.25, 25.5, 65.0, 50000, 5.2, 800, 0.5, 0, 5, 2, 3.7, 1]]}`
+
+	m, err := Parse(&config.Config{Dual_Pressure: true}, nil, []byte(packet), len(packet))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if m.Fields["p"] != "1013.25" {
+		t.Errorf("Expected p=1013.25, got %s", m.Fields["p"])
+	}
+	if m.Fields["p_inhg"] != "29.92" {
+		t.Errorf("Expected p_inhg=29.92, got %s", m.Fields["p_inhg"])
+	}
+
+	m, err = Parse(&config.Config{}, nil, []byte(packet), len(packet))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if _, ok := m.Fields["p_inhg"]; ok {
+		t.Error("Expected no p_inhg field without dual pressure")
+	}
+}
+
+func TestFieldUnits(t *testing.T) {
+	// Aviation style: knots and mmHg with Celsius kept from the metric system
+	cfg := &config.Config{Field_Units: map[string]string{"wind": "knots", "pressure": "mmHg"}}
+
+	tests := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"knots wind", convertSpeed(cfg, 10), 19.44},
+		{"mmHg pressure", convertPressure(cfg, 1013.25), 760.0},
+		{"temp unchanged", convertTemp(cfg, 25.5), 25.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if math.Abs(tt.got-tt.want) > 0.01 {
+				t.Errorf("got %.4f, want %.4f", tt.got, tt.want)
+			}
+		})
+	}
+
+	tags := UnitTags(cfg)
+	if tags["wind_unit"] != "knots" || tags["pressure_unit"] != "mmHg" || tags["temp_unit"] != "C" {
+		t.Errorf("Expected unit tags to reflect overrides, got %v", tags)
+	}
+	if unitTags[config.UnitsMetric]["wind_unit"] != "m/s" {
+		t.Error("Overrides modified the shared metric unit tags")
+	}
+}
+
+func TestSupportedUnitsHaveConversions(t *testing.T) {
+	for quantity, units := range config.SupportedUnits {
+		for _, unit := range units {
+			if _, ok := unitConversions[quantity][unit]; !ok {
+				t.Errorf("No conversion for %s in %s", quantity, unit)
+			}
+		}
+	}
+}